@@ -3,10 +3,15 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"math/big"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"github.com/daobrussels/cw/pkg/common/ethrequest"
 	"github.com/daobrussels/cw/pkg/common/supply"
@@ -57,65 +62,527 @@ const (
 	`
 )
 
+const (
+	usage = `usage: deploy <command> [flags]
+
+commands:
+  deploy          deploy a community, resumes from the state file if it exists
+  verify          check that code exists at every address of a community
+  fund-paymaster  deposit funds for the paymaster of a community
+  register-token  register the token and price oracle of the token paymaster
+  deposit-tokens  deposit community tokens of the supply wallet to pay for the gas of an account
+  create-account  create an account for an owner
+  create-profile  create a profile for an owner
+  status          show balances, paymaster deposit and owners of a community
+  migrate         replace a contract of a community with a new deployment and update its manifest
+
+run "deploy <command> -h" for the flags of a command`
+)
+
+type command struct {
+	flags *flag.FlagSet
+	run   func(ctx context.Context) error
+}
+
+// shared flags
+var (
+	env       *string
+	chainPath *string
+	path      *string
+	dryRun    *bool
+)
+
 func main() {
-	ctx := context.Background()
+	// an interrupt cancels the calls in flight, a partial deployment is resumed from its state file
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// deploy is the default command
+	name := "deploy"
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name = args[0]
+		args = args[1:]
+	}
+
+	// commands are instantiated on demand since they share flag variables
+	commands := map[string]func() *command{
+		"deploy":         deployCommand,
+		"verify":         verifyCommand,
+		"fund-paymaster": fundPaymasterCommand,
+		"register-token": registerTokenCommand,
+		"deposit-tokens": depositTokensCommand,
+		"create-account": func() *command {
+			return createCommand("create-account", "account", (*community.Community).CreateAccount)
+		},
+		"create-profile": func() *command {
+			return createCommand("create-profile", "profile", (*community.Community).CreateProfile)
+		},
+		"status":  statusCommand,
+		"migrate": migrateCommand,
+	}
+
+	newCmd, ok := commands[name]
+	if !ok {
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+
+	cmd := newCmd()
 
-	log.Default().Println("deploying...")
+	cmd.flags.Parse(args)
 
-	env := flag.String(
+	err := cmd.run(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// newFlagSet returns a flag set with the flags shared by all commands
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+
+	env = fs.String(
 		"env",
 		".env",
 		"specify path to env",
 	)
 
-	chain := flag.String(
+	chainPath = fs.String(
 		"chain",
 		"./config/chain/test.chain.json",
 		"specify path to a *.chain.json file",
 	)
 
-	flag.Parse()
+	path = fs.String(
+		"c",
+		"",
+		"specify path to a *.community.json file",
+	)
 
-	conf, err := config.NewConfig(ctx, *chain, *env)
-	if err != nil {
-		log.Default().Println(fmt.Sprintf("invalid or missing chain config file at %s", *chain))
-		log.Default().Println("should be:")
-		log.Default().Println(chainTemplate)
-		log.Default().Println("")
-		log.Default().Println("put at the base of the project")
-		log.Fatal(err)
+	dryRun = fs.Bool(
+		"dry-run",
+		false,
+		"only estimate the gas of the transactions, nothing is sent",
+	)
+
+	return fs
+}
+
+// setup loads the config and supply wallet, the chain is taken from the community file when there is one
+func setup(ctx context.Context) (*supply.Supply, *ethrequest.EthService, *community.CommunityAddress, error) {
+	var addr *community.CommunityAddress
+	var conf *config.Config
+	var err error
+
+	if *path != "" {
+		addr, err = community.ReadConfig(*path)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		conf, err = config.NewConfigWChain(ctx, *env, addr.Chain)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	} else {
+		conf, err = config.NewConfig(ctx, *chainPath, *env)
+		if err != nil {
+			log.Default().Println(fmt.Sprintf("invalid or missing chain config file at %s", *chainPath))
+			log.Default().Println("should be:")
+			log.Default().Println(chainTemplate)
+			log.Default().Println("")
+			log.Default().Println("put at the base of the project")
+			return nil, nil, nil, err
+		}
 	}
 
 	s, err := supply.New(conf.SupplyWalletKey)
 	if err != nil {
-		log.Fatal(err)
+		return nil, nil, nil, err
 	}
 
-	maddress := common.HexToAddress(s.Address)
-
 	es, err := ethrequest.NewEthService(conf.Chain.RPC[0])
 	if err != nil {
-		log.Fatal(err)
+		return nil, nil, nil, err
 	}
-	defer es.Close()
 
-	c, err := community.Deploy(es, s.PrivateKey, maddress, conf.Chain)
-	if err != nil {
-		log.Fatal(err)
+	if addr == nil {
+		addr = &community.CommunityAddress{Chain: conf.Chain}
 	}
 
-	addr := c.ExportAddress()
+	return s, es, addr, nil
+}
 
-	b, err := json.Marshal(addr)
+// open binds to the community described by the -c flag
+func open(ctx context.Context) (*community.Community, func(), error) {
+	if *path == "" {
+		return nil, nil, errors.New("missing -c flag")
+	}
+
+	s, es, addr, err := setup(ctx)
 	if err != nil {
-		log.Fatal(err)
+		return nil, nil, err
 	}
 
-	// write bytes to file
-	err = os.WriteFile(fmt.Sprintf("%s.community.json", addr.Gateway.Hex()), b, 0644)
+	c, err := community.New(es, s.PrivateKey, common.HexToAddress(s.Address), *addr)
 	if err != nil {
-		log.Fatal(err)
+		es.Close()
+		return nil, nil, err
+	}
+
+	c.DryRun = *dryRun
+
+	return c, es.Close, nil
+}
+
+func deployCommand() *command {
+	fs := newFlagSet("deploy")
+
+	state := fs.String(
+		"state",
+		"deploy.state.json",
+		"specify path to the file where deployment progress is saved",
+	)
+
+	return &command{fs, func(ctx context.Context) error {
+		log.Default().Println("deploying...")
+
+		s, es, addr, err := setup(ctx)
+		if err != nil {
+			return err
+		}
+		defer es.Close()
+
+		// resume from a previous partial deployment
+		b, err := os.ReadFile(*state)
+		if err == nil {
+			err = json.Unmarshal(b, addr)
+			if err != nil {
+				return err
+			}
+
+			log.Default().Println(fmt.Sprintf("resuming from %s...", *state))
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+
+		c := community.Prepare(es, s.PrivateKey, common.HexToAddress(s.Address), addr.Chain)
+		c.DryRun = *dryRun
+
+		err = c.Resume(ctx, *addr, func(progress community.CommunityAddress) error {
+			return writeJSON(*state, progress)
+		})
+		if err != nil {
+			return err
+		}
+
+		if c.DryRun {
+			printEstimates(c)
+			return nil
+		}
+
+		final := c.ExportAddress()
+
+		err = writeJSON(fmt.Sprintf("%s%s", final.Gateway.Hex(), community.ConfigSuffix), final)
+		if err != nil {
+			return err
+		}
+
+		// the deployment is complete, there is nothing left to resume
+		err = os.Remove(*state)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		log.Default().Println("community deployed...")
+
+		return nil
+	}}
+}
+
+func verifyCommand() *command {
+	fs := newFlagSet("verify")
+
+	return &command{fs, func(ctx context.Context) error {
+		c, done, err := open(ctx)
+		if err != nil {
+			return err
+		}
+		defer done()
+
+		contracts, err := c.VerifyCode(ctx)
+		if err != nil {
+			return err
+		}
+
+		missing := 0
+		for _, contract := range contracts {
+			status := "ok"
+			if !contract.Deployed {
+				status = "missing"
+				missing++
+			}
+
+			fmt.Printf("%-18s %s %s\n", contract.Name, contract.Address.Hex(), status)
+		}
+
+		if missing > 0 {
+			return fmt.Errorf("%d contracts have no code", missing)
+		}
+
+		return nil
+	}}
+}
+
+func fundPaymasterCommand() *command {
+	fs := newFlagSet("fund-paymaster")
+
+	amount := fs.String(
+		"amount",
+		"",
+		"specify the amount of wei to deposit",
+	)
+
+	return &command{fs, func(ctx context.Context) error {
+		value, ok := new(big.Int).SetString(*amount, 10)
+		if !ok || value.Sign() <= 0 {
+			return errors.New("invalid -amount")
+		}
+
+		c, done, err := open(ctx)
+		if err != nil {
+			return err
+		}
+		defer done()
+
+		err = c.FundPaymaster(ctx, value)
+		if err != nil {
+			return err
+		}
+
+		if c.DryRun {
+			printEstimates(c)
+			return nil
+		}
+
+		log.Default().Println(fmt.Sprintf("paymaster funded with %s wei", value))
+
+		return nil
+	}}
+}
+
+func registerTokenCommand() *command {
+	fs := newFlagSet("register-token")
+
+	return &command{fs, func(ctx context.Context) error {
+		c, done, err := open(ctx)
+		if err != nil {
+			return err
+		}
+		defer done()
+
+		err = c.RegisterPaymasterToken(ctx)
+		if err != nil {
+			return err
+		}
+
+		if c.DryRun {
+			printEstimates(c)
+			return nil
+		}
+
+		log.Default().Println(fmt.Sprintf("token %s registered with oracle %s", c.TokenPaymaster.Token.Hex(), c.TokenPaymaster.Oracle.Hex()))
+
+		return nil
+	}}
+}
+
+func depositTokensCommand() *command {
+	fs := newFlagSet("deposit-tokens")
+
+	account := fs.String(
+		"account",
+		"",
+		"specify the address of the account whose gas is paid",
+	)
+
+	amount := fs.String(
+		"amount",
+		"",
+		"specify the amount of tokens to deposit, in their smallest unit",
+	)
+
+	return &command{fs, func(ctx context.Context) error {
+		if !common.IsHexAddress(*account) {
+			return errors.New("invalid -account")
+		}
+
+		value, ok := new(big.Int).SetString(*amount, 10)
+		if !ok || value.Sign() <= 0 {
+			return errors.New("invalid -amount")
+		}
+
+		c, done, err := open(ctx)
+		if err != nil {
+			return err
+		}
+		defer done()
+
+		err = c.DepositTokensFor(ctx, common.HexToAddress(*account), value)
+		if err != nil {
+			return err
+		}
+
+		if c.DryRun {
+			printEstimates(c)
+			return nil
+		}
+
+		log.Default().Println(fmt.Sprintf("%s tokens deposited for %s", value, *account))
+
+		return nil
+	}}
+}
+
+// createCommand returns a command which creates something for an owner and prints its address
+func createCommand(name, what string, create func(*community.Community, context.Context, common.Address) (*common.Address, error)) *command {
+	fs := newFlagSet(name)
+
+	owner := fs.String(
+		"owner",
+		"",
+		fmt.Sprintf("specify the address of the owner of the %s", what),
+	)
+
+	return &command{fs, func(ctx context.Context) error {
+		if !common.IsHexAddress(*owner) {
+			return errors.New("invalid -owner")
+		}
+
+		c, done, err := open(ctx)
+		if err != nil {
+			return err
+		}
+		defer done()
+
+		addr, err := create(c, ctx, common.HexToAddress(*owner))
+		if err != nil {
+			return err
+		}
+
+		if c.DryRun {
+			printEstimates(c)
+			return nil
+		}
+
+		fmt.Println(addr.Hex())
+
+		return nil
+	}}
+}
+
+func statusCommand() *command {
+	fs := newFlagSet("status")
+
+	return &command{fs, func(ctx context.Context) error {
+		c, done, err := open(ctx)
+		if err != nil {
+			return err
+		}
+		defer done()
+
+		st, err := c.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("supply wallet      %s\n", st.Supply.Hex())
+		fmt.Printf("supply balance     %s\n", st.SupplyBalance)
+		fmt.Printf("paymaster deposit  %s\n", st.PaymasterDeposit)
+		fmt.Printf("paymaster owner    %s\n", st.PaymasterOwner.Hex())
+
+		return nil
+	}}
+}
+
+func migrateCommand() *command {
+	fs := newFlagSet("migrate")
+
+	contract := fs.String(
+		"contract",
+		"",
+		fmt.Sprintf("specify the contract to replace: %s, %s, %s or %s",
+			community.ContractPaymaster,
+			community.ContractAccountFactory,
+			community.ContractGratitudeFactory,
+			community.ContractProfileFactory,
+		),
+	)
+
+	return &command{fs, func(ctx context.Context) error {
+		c, done, err := open(ctx)
+		if err != nil {
+			return err
+		}
+		defer done()
+
+		// the community file is updated in place so that stations pick up the new contract
+		err = c.Migrate(ctx, *contract, func(progress community.CommunityAddress) error {
+			return writeJSON(*path, progress)
+		})
+		if err != nil {
+			return err
+		}
+
+		if c.DryRun {
+			printEstimates(c)
+			return nil
+		}
+
+		log.Default().Println(fmt.Sprintf("%s migrated to %s (smartcontracts %s)...",
+			*contract,
+			c.Manifest().Contracts[*contract].Address.Hex(),
+			community.ContractsVersion(),
+		))
+
+		if *contract == community.ContractPaymaster {
+			log.Default().Println("the new paymaster has no deposit, run fund-paymaster before serving it")
+		}
+
+		return nil
+	}}
+}
+
+// printEstimates prints the gas of the transactions collected during a dry run
+func printEstimates(c *community.Community) {
+	total := new(big.Int)
+
+	for _, tx := range c.DryRunTxs() {
+		cost := new(big.Int).Mul(new(big.Int).SetUint64(tx.Gas()), tx.GasPrice())
+		total.Add(total, cost)
+
+		to := "(contract creation)"
+		if tx.To() != nil {
+			to = tx.To().Hex()
+		}
+
+		fmt.Printf("%-42s gas %-10d cost %s wei\n", to, tx.Gas(), cost)
+	}
+
+	for _, tx := range c.DryRunUnestimated() {
+		fmt.Printf("%-42s %s not estimated, %s\n", tx.To.Hex(), tx.Method, tx.Reason)
+	}
+
+	fmt.Printf("total cost %s wei\n", total)
+}
+
+// writeJSON writes the value to a file as json
+func writeJSON(path string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
 	}
 
-	log.Default().Println("community deployed...")
+	return os.WriteFile(path, b, 0644)
 }
@@ -2,16 +2,24 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/daobrussels/cw/pkg/config"
+	"github.com/daobrussels/cw/pkg/logger"
+	"github.com/daobrussels/cw/pkg/metrics"
+	"golang.org/x/exp/slog"
 )
 
 func main() {
-	ctx := context.Background()
-
-	log.Default().Println("events starting up...")
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	env := flag.String(
 		"env",
@@ -19,14 +27,60 @@ func main() {
 		"specify whether to use a dot env file or not",
 	)
 	_ = flag.String("url", "http://localhost:8545", "specify the url to use")
+
+	metricsPort := flag.Int(
+		"metrics-port",
+		9091,
+		"specify port to serve prometheus metrics on under /metrics, 0 to disable",
+	)
+
+	logFormat := flag.String(
+		"log-format",
+		logger.FormatText,
+		"specify the format of the logs, text or json",
+	)
+
+	logLevel := flag.String(
+		"log-level",
+		"info",
+		"specify the minimum level of the logs, debug, info, warn or error",
+	)
+
 	flag.Parse()
 
-	_, err := config.NewConfig(ctx, "chain.json", *env)
+	err := logger.Setup(os.Stderr, *logFormat, *logLevel)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	slog.Info("events starting up...")
+
+	_, err = config.NewConfig(ctx, "chain.json", *env)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *metricsPort > 0 {
+		msrv := metrics.NewServer(*metricsPort)
+
+		go func() {
+			err := msrv.ListenAndServe()
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("unable to serve metrics", err)
+			}
+		}()
+
+		defer func() {
+			sctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			msrv.Shutdown(sctx)
+		}()
+	}
+
 	// TODO: implement the events server
 
-	log.Default().Println("events shutting down...")
+	<-ctx.Done()
+
+	slog.Info("events shutting down...")
 }
@@ -2,24 +2,39 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"flag"
-	"fmt"
 	"log"
+	"math/big"
+	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/daobrussels/cw/pkg/admin"
+	"github.com/daobrussels/cw/pkg/auth"
+	"github.com/daobrussels/cw/pkg/breaker"
 	"github.com/daobrussels/cw/pkg/common/ethrequest"
 	"github.com/daobrussels/cw/pkg/common/supply"
 	"github.com/daobrussels/cw/pkg/community"
 	"github.com/daobrussels/cw/pkg/config"
+	"github.com/daobrussels/cw/pkg/cw"
+	"github.com/daobrussels/cw/pkg/events"
+	"github.com/daobrussels/cw/pkg/logger"
+	"github.com/daobrussels/cw/pkg/metrics"
+	"github.com/daobrussels/cw/pkg/ratelimit"
 	"github.com/daobrussels/cw/pkg/router"
+	"github.com/daobrussels/cw/pkg/server"
 	"github.com/ethereum/go-ethereum/common"
+	"golang.org/x/exp/slog"
 )
 
 func main() {
-	ctx := context.Background()
-
-	log.Default().Println("station starting up...")
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	env := flag.String(
 		"env",
@@ -36,50 +51,455 @@ func main() {
 	path := flag.String(
 		"c",
 		"./config/community/test.community.json",
-		"specify path to a *.community.json file",
+		"specify path to a *.community.json file, this community is served under /community",
+	)
+
+	dir := flag.String(
+		"d",
+		"",
+		"specify path to a directory of *.community.json files, communities are served under /communities/{id} and reloaded when the files change",
+	)
+
+	data := flag.String(
+		"data",
+		"",
+		"specify path to a directory where community state such as account guardians, session keys and transaction history is persisted, kept in memory when empty",
+	)
+
+	sweep := flag.Duration(
+		"sweep",
+		0,
+		"specify how often gas fees collected in community tokens are swept to the treasury, 0 to disable",
+	)
+
+	balanceTTL := flag.Duration(
+		"balance-ttl",
+		community.DefaultBalanceTTL,
+		"specify how long account balances are cached, transfers seen on chain refresh them earlier",
+	)
+
+	confirmations := flag.Uint64(
+		"confirmations",
+		events.DefaultConfirmations,
+		"specify how many blocks must follow a block before its transactions are indexed",
+	)
+
+	rpc := ethrequest.DefaultConfig()
+
+	flag.DurationVar(&rpc.Timeout, "rpc-timeout", rpc.Timeout, "specify how long a single rpc call can take, 0 for no timeout")
+	flag.IntVar(&rpc.Retries, "rpc-retries", rpc.Retries, "specify how many times an rpc call failing with a transient error is retried, transactions are never retried")
+	flag.DurationVar(&rpc.Backoff, "rpc-backoff", rpc.Backoff, "specify the delay before the first retry of an rpc call, it doubles with every retry")
+
+	conf := server.DefaultConfig()
+
+	flag.DurationVar(&conf.ReadHeaderTimeout, "read-header-timeout", conf.ReadHeaderTimeout, "specify how long reading the headers of a request can take")
+	flag.DurationVar(&conf.ReadTimeout, "read-timeout", conf.ReadTimeout, "specify how long reading a request can take")
+	flag.DurationVar(&conf.WriteTimeout, "write-timeout", conf.WriteTimeout, "specify how long handling a request and writing its response can take, activity streams are exempt")
+	flag.DurationVar(&conf.IdleTimeout, "idle-timeout", conf.IdleTimeout, "specify how long idle keep-alive connections are kept open")
+	flag.StringVar(&conf.CertFile, "tls-cert", "", "specify path to a tls certificate file, tls is served when a key file is also provided")
+	flag.StringVar(&conf.KeyFile, "tls-key", "", "specify path to a tls key file")
+	flag.BoolVar(&conf.TrustProxy, "trust-proxy", false, "specify whether the ip of clients is taken from the X-Forwarded-For or X-Real-IP headers, only when behind a reverse proxy")
+	flag.BoolVar(&conf.CORS.Credentials, "cors-credentials", false, "specify whether browsers can send cookies and authorization headers, not allowed with any origin")
+	flag.DurationVar(&conf.CORS.MaxAge, "cors-max-age", 0, "specify how long browsers cache the response to a preflight request, 0 to leave it to the browser")
+
+	corsOrigins := flag.String(
+		"cors-origins",
+		server.AnyOrigin,
+		"specify a comma separated list of the origins of the web apps allowed to call the station, * for any origin",
+	)
+
+	corsHeaders := flag.String(
+		"cors-headers",
+		"",
+		"specify a comma separated list of request headers browsers can send on top of the ones the station reads",
+	)
+
+	rateLimits := flag.String(
+		"rate-limits",
+		"",
+		"specify path to a json file of rate limits by route, the default limits are used when empty",
+	)
+
+	denylist := flag.String(
+		"denylist",
+		"",
+		"specify path to a file of denied ips, public keys and addresses, one per line, reloaded on SIGHUP",
+	)
+
+	rolesPath := flag.String(
+		"roles",
+		"",
+		"specify path to a json file of addresses by role, such as {\"admin\": [\"0x...\"]}, reloaded on SIGHUP",
+	)
+
+	pauseReverts := flag.Int(
+		"pause-reverts",
+		0,
+		"specify how many transactions of the supply wallet can revert within a minute before the station pauses, 0 to disable",
+	)
+
+	pauseSpend := flag.String(
+		"pause-spend",
+		"",
+		"specify how much gas in wei the supply wallet can pay within an hour before the station pauses, empty to disable",
+	)
+
+	minBalance := flag.String(
+		"ready-min-balance",
+		"",
+		"specify the balance in wei the supply wallet needs for the station to be ready, any positive balance when empty",
+	)
+
+	minDeposit := flag.String(
+		"ready-min-deposit",
+		"",
+		"specify the deposit in wei each paymaster needs for the station to be ready, any positive deposit when empty",
+	)
+
+	auditLog := flag.String(
+		"audit-log",
+		"./audit.log",
+		"specify path to the append-only log of the actions taken through the admin api",
+	)
+
+	metricsPort := flag.Int(
+		"metrics-port",
+		9090,
+		"specify port to serve prometheus metrics on under /metrics, 0 to disable",
+	)
+
+	metricsInterval := flag.Duration(
+		"metrics-interval",
+		time.Minute,
+		"specify how often paymaster deposits and wallet balances are read for the metrics",
+	)
+
+	shutdownTimeout := flag.Duration(
+		"shutdown-timeout",
+		30*time.Second,
+		"specify how long requests in flight are given to complete on shutdown",
+	)
+
+	logFormat := flag.String(
+		"log-format",
+		logger.FormatText,
+		"specify the format of the logs, text or json",
+	)
+
+	logLevel := flag.String(
+		"log-level",
+		"info",
+		"specify the minimum level of the logs, debug, info, warn or error",
 	)
 
 	flag.Parse()
 
-	b, err := os.ReadFile(*path)
+	err := logger.Setup(os.Stderr, *logFormat, *logLevel)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	var addr community.CommunityAddress
-	err = json.Unmarshal(b, &addr)
+	conf.CORS.Origins = splitList(*corsOrigins)
+	conf.CORS.Headers = splitList(*corsHeaders)
+
+	err = conf.CORS.Validate()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	es, err := ethrequest.NewEthService(addr.Chain.RPC[0])
-	if err != nil {
-		log.Fatal(err)
+	slog.Info("station starting up...")
+
+	var chain cw.ChainConfig
+	if *path != "" {
+		addr, err := community.ReadConfig(*path)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		chain = addr.Chain
 	}
-	defer es.Close()
 
-	conf, err := config.NewConfigWChain(ctx, *env, addr.Chain)
+	envconf, err := config.NewConfigWChain(ctx, *env, chain)
 	if err != nil {
-		log.Default().Println(fmt.Sprintf("invalid or missing chain config file at %s", *path))
-		log.Fatal(err)
+		slog.Error("invalid or missing chain config file", err, "path", *path)
+		os.Exit(1)
 	}
 
-	s, err := supply.New(conf.SupplyWalletKey)
+	s, err := supply.New(envconf.SupplyWalletKey)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	c, err := community.New(es, s.PrivateKey, common.HexToAddress(s.Address), addr)
+	b := breaker.New(breaker.Thresholds{
+		Reverts:  *pauseReverts,
+		MaxSpend: parseWei("pause-spend", *pauseSpend),
+	})
+
+	// SIGUSR1 pauses the station and SIGUSR2 resumes it
+	go pauseOnSignal(ctx, b)
+
+	reg := community.NewRegistry(s.PrivateKey, common.HexToAddress(s.Address))
+	defer reg.Close()
+
+	reg.Breaker = b
+	reg.Thresholds = community.ReadyThresholds{
+		MinBalance: parseWei("ready-min-balance", *minBalance),
+		MinDeposit: parseWei("ready-min-deposit", *minDeposit),
+	}
+
+	reg.DataDir = *data
+	reg.BalanceTTL = *balanceTTL
+	reg.RPC = rpc
+	reg.Confirmations = *confirmations
+
+	if *path != "" {
+		_, err = reg.Load(*path)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *dir != "" {
+		err = reg.LoadDir(*dir)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		go func() {
+			err := reg.Watch(ctx, *dir)
+			if err != nil {
+				slog.Error("unable to watch the communities", err, "dir", *dir)
+			}
+		}()
+	}
+
+	// index the transaction history of every community
+	reg.Listen(ctx)
+
+	var wg sync.WaitGroup
+
+	if *sweep > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sweepTokenFees(ctx, reg, *sweep)
+		}()
+	}
+
+	var msrv *http.Server
+
+	if *metricsPort > 0 {
+		msrv = metrics.NewServer(*metricsPort)
+
+		go func() {
+			err := msrv.ListenAndServe()
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("unable to serve metrics", err)
+			}
+		}()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reportMetrics(ctx, reg, *metricsInterval)
+		}()
+	}
+
+	slog.Info("serving communities...", "communities", len(reg.IDs()), "port", *port)
+
+	rlconf := ratelimit.DefaultConfig()
+	if *rateLimits != "" {
+		rlconf, err = ratelimit.ReadConfig(*rateLimits)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	rl := ratelimit.New(ratelimit.NewMemoryStore(), rlconf)
+
+	if *denylist != "" {
+		err = rl.Denylist.Load(*denylist)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		go reloadOnHangup(ctx, *denylist, rl.Denylist.Load)
+	}
+
+	roles := auth.NewRoles()
+
+	if *rolesPath != "" {
+		err = roles.Load(*rolesPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		go reloadOnHangup(ctx, *rolesPath, roles.Load)
+	}
+
+	audit, err := admin.OpenAuditLog(*auditLog)
 	if err != nil {
 		log.Fatal(err)
 	}
+	defer audit.Close()
+
+	srv := router.NewServer(s, reg, conf, rl, roles, audit)
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.Start(*port)
+	}()
+
+	select {
+	case err := <-errc:
+		if err != nil {
+			log.Fatal(err)
+		}
+	case <-ctx.Done():
+	}
+
+	// a second signal kills the station
+	stop()
+
+	slog.Info("station shutting down...")
 
-	log.Default().Println("serving...")
+	sctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
 
-	err = router.NewServer(s, es, c).Start(*port)
+	// wait for the requests in flight, such as batched calls waiting for their operation to be mined
+	err = srv.Shutdown(sctx)
 	if err != nil {
-		log.Fatal(err)
+		slog.Error("unable to complete requests in flight", err)
+	}
+
+	if msrv != nil {
+		msrv.Shutdown(sctx)
+	}
+
+	// wait for a sweep in progress, the deferred close of the registry waits for the batches being indexed
+	wg.Wait()
+
+	// transactions are no longer watched once the registry is closed, those still pending are logged to be followed up on chain
+	for _, tx := range reg.Drain(sctx) {
+		slog.Warn("transaction still pending at shutdown", "tx", tx.Hash.Hex(), "nonce", tx.Nonce, "sent", tx.Sent)
 	}
+}
+
+// reloadOnHangup reloads a file on SIGHUP, until the context is done
+func reloadOnHangup(ctx context.Context, path string, load func(path string) error) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
 
-	log.Default().Println("station shutting down...")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		}
+
+		err := load(path)
+		if err != nil {
+			slog.Error("unable to reload", err, "path", path)
+			continue
+		}
+
+		slog.Info("reloaded", "path", path)
+	}
+}
+
+// splitList splits a comma separated flag, empty items are dropped
+func splitList(value string) []string {
+	list := []string{}
+
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
+
+// parseWei parses the amount in wei of a flag, nil when it is empty
+func parseWei(name, value string) *big.Int {
+	if value == "" {
+		return nil
+	}
+
+	amount, ok := new(big.Int).SetString(value, 10)
+	if !ok || amount.Sign() < 0 {
+		log.Fatalf("invalid -%s %s", name, value)
+	}
+
+	return amount
+}
+
+// pauseOnSignal pauses the breaker on SIGUSR1 and resumes it on SIGUSR2, until the context is done
+func pauseOnSignal(ctx context.Context, b *breaker.Breaker) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGUSR1, syscall.SIGUSR2)
+	defer signal.Stop(sig)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case s := <-sig:
+			if s == syscall.SIGUSR2 {
+				b.Resume()
+				continue
+			}
+
+			b.Pause(breaker.SourceSignal, "paused by "+s.String())
+		}
+	}
+}
+
+// reportMetrics periodically records the paymaster deposits and wallet balances, until the context is done
+func reportMetrics(ctx context.Context, reg *community.Registry, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		reg.ReportMetrics(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sweepTokenFees periodically moves the fees collected by the token paymasters to the treasuries, until the context is done
+func sweepTokenFees(ctx context.Context, reg *community.Registry, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, id := range reg.IDs() {
+			c, ok := reg.Get(id)
+			if !ok || c.TokenPaymaster == nil {
+				continue
+			}
+
+			amount, err := c.SweepTokenFees(ctx)
+			if err != nil {
+				slog.Error("unable to sweep token fees", err, "community", id)
+				continue
+			}
+
+			if amount.Sign() > 0 {
+				slog.Info("swept token fees to the treasury", "community", id, "amount", amount.String())
+			}
+		}
+	}
 }
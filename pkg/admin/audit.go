@@ -0,0 +1,98 @@
+package admin
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// statuses of the entries of an action, its intent is recorded before it is taken and its outcome after
+const (
+	StatusIntent    = "intent"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// Entry is a record of an admin action
+type Entry struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"requestId,omitempty"`
+	Admin     string    `json:"admin"`               // signer of the request
+	Action    string    `json:"action"`              // name of the action
+	Community string    `json:"community,omitempty"` // id of the community the action applies to
+	Params    any       `json:"params,omitempty"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"` // reason the action failed, empty when it succeeded
+}
+
+// AuditLog appends the admin actions to a file, one json entry per line.
+// Entries are never rewritten, the file can be shipped or rotated by external tools.
+type AuditLog struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// OpenAuditLog opens the audit log at path for appending, creating it if it does not exist
+func OpenAuditLog(path string) (*AuditLog, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuditLog{f: f}, nil
+}
+
+// Record appends an entry and syncs it to disk
+func (a *AuditLog) Record(e Entry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	_, err = a.f.Write(append(b, '\n'))
+	if err != nil {
+		return err
+	}
+
+	return a.f.Sync()
+}
+
+// Close closes the file of the audit log
+func (a *AuditLog) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.f.Close()
+}
+
+// ReadAuditLog reads the entries of an audit log, oldest first
+func ReadAuditLog(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries := []Entry{}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		var e Entry
+
+		err := json.Unmarshal(scanner.Bytes(), &e)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, scanner.Err()
+}
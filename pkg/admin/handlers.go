@@ -0,0 +1,339 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/daobrussels/cw/pkg/breaker"
+	"github.com/daobrussels/cw/pkg/common/response"
+	"github.com/daobrussels/cw/pkg/community"
+	"github.com/daobrussels/cw/pkg/cw"
+	"github.com/daobrussels/cw/pkg/logger"
+	"github.com/daobrussels/cw/pkg/ratelimit"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/go-chi/chi/v5"
+)
+
+// names of the actions recorded in the audit log
+const (
+	ActionDeposit          = "paymaster.deposit"
+	ActionWithdraw         = "paymaster.withdraw"
+	ActionMintLimit        = "limits.mint"
+	ActionPauseSponsorship = "sponsorship.pause"
+	ActionBan              = "denylist.add"
+	ActionUnban            = "denylist.remove"
+	ActionRotateKey        = "keys.rotate"
+	ActionPause            = "station.pause"
+)
+
+var (
+	ErrNoEntries = errors.New("no entries provided")
+	ErrNoBreaker = errors.New("the station cannot be paused")
+	ErrNoAudit   = errors.New("the action could not be recorded in the audit log")
+)
+
+type Handlers struct {
+	responder *response.Responder
+	denylist  *ratelimit.Denylist
+	breaker   *breaker.Breaker
+	audit     *AuditLog
+}
+
+// NewHandlers instantiates the admin handlers, every action they take is recorded in the audit log
+func NewHandlers(r *response.Responder, denylist *ratelimit.Denylist, b *breaker.Breaker, audit *AuditLog) *Handlers {
+	return &Handlers{
+		responder: r,
+		denylist:  denylist,
+		breaker:   b,
+		audit:     audit,
+	}
+}
+
+// CommunityStatus is the state of a community which operators can act on
+type CommunityStatus struct {
+	*community.Status
+	MintLimit         community.MintLimit `json:"mintLimit"`
+	SponsorshipPaused bool                `json:"sponsorshipPaused"`
+	PendingOps        int                 `json:"pendingOps"`
+}
+
+// Status returns the funds, ownership and controls of a community
+func (h *Handlers) Status(w http.ResponseWriter, r *http.Request) {
+	c, ok := community.FromContext(r.Context())
+	if !ok {
+		h.writeError(w, r, community.ErrCommunityNotFound)
+		return
+	}
+
+	status, err := c.Status(r.Context())
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	err = h.responder.EncryptedBody(w, r.Context(), CommunityStatus{
+		Status:            status,
+		MintLimit:         c.Controls.Mint(),
+		SponsorshipPaused: !c.Controls.Sponsoring(),
+		PendingOps:        len(c.PendingOps()),
+	})
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+}
+
+type DepositRequest struct {
+	Amount *big.Int `json:"amount"` // in wei
+}
+
+// Deposit funds the deposit of the paymaster from the supply wallet
+func (h *Handlers) Deposit(w http.ResponseWriter, r *http.Request) {
+	var req DepositRequest
+
+	h.act(w, r, ActionDeposit, &req, func(ctx context.Context, c *community.Community) error {
+		if req.Amount == nil || req.Amount.Sign() <= 0 {
+			return community.ErrInvalidAmount
+		}
+
+		return c.FundPaymaster(ctx, req.Amount)
+	})
+}
+
+type WithdrawRequest struct {
+	To     common.Address `json:"to"`
+	Amount *big.Int       `json:"amount"` // in wei
+}
+
+// Withdraw withdraws from the deposit of the paymaster
+func (h *Handlers) Withdraw(w http.ResponseWriter, r *http.Request) {
+	var req WithdrawRequest
+
+	h.act(w, r, ActionWithdraw, &req, func(ctx context.Context, c *community.Community) error {
+		if req.To == (common.Address{}) {
+			return community.ErrInvalidAddress
+		}
+
+		if req.Amount == nil || req.Amount.Sign() <= 0 {
+			return community.ErrInvalidAmount
+		}
+
+		return c.WithdrawPaymaster(ctx, req.To, req.Amount)
+	})
+}
+
+// MintLimit replaces the limit of a single gratitude mint
+func (h *Handlers) MintLimit(w http.ResponseWriter, r *http.Request) {
+	var req community.MintLimit
+
+	h.act(w, r, ActionMintLimit, &req, func(ctx context.Context, c *community.Community) error {
+		return c.Controls.SetMint(req)
+	})
+}
+
+type SponsorshipRequest struct {
+	Paused bool `json:"paused"`
+}
+
+// Sponsorship pauses or resumes paying for operations with the paymaster
+func (h *Handlers) Sponsorship(w http.ResponseWriter, r *http.Request) {
+	var req SponsorshipRequest
+
+	h.act(w, r, ActionPauseSponsorship, &req, func(ctx context.Context, c *community.Community) error {
+		return c.Controls.PauseSponsorship(req.Paused)
+	})
+}
+
+// PendingOps returns the transactions carrying operations which are not mined yet
+func (h *Handlers) PendingOps(w http.ResponseWriter, r *http.Request) {
+	c, ok := community.FromContext(r.Context())
+	if !ok {
+		h.writeError(w, r, community.ErrCommunityNotFound)
+		return
+	}
+
+	err := h.responder.EncryptedBodyMultiple(w, r.Context(), c.PendingOps(), nil)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+}
+
+type RotateKeyRequest struct {
+	Owner common.Address `json:"owner"` // address of the new supply key
+}
+
+// RotateKey hands the paymaster over to the address of a new supply key, the station must then be restarted with that key
+func (h *Handlers) RotateKey(w http.ResponseWriter, r *http.Request) {
+	var req RotateKeyRequest
+
+	h.act(w, r, ActionRotateKey, &req, func(ctx context.Context, c *community.Community) error {
+		if req.Owner == (common.Address{}) {
+			return community.ErrInvalidAddress
+		}
+
+		return c.TransferPaymaster(ctx, req.Owner)
+	})
+}
+
+type DenylistRequest struct {
+	Entries []string `json:"entries"` // ips, public keys or addresses
+}
+
+// Denylist returns the denied ips, public keys and addresses
+func (h *Handlers) Denylist(w http.ResponseWriter, r *http.Request) {
+	err := h.responder.EncryptedBodyMultiple(w, r.Context(), h.denylist.List(), nil)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+}
+
+// Ban denies the requests of ips, public keys or addresses
+func (h *Handlers) Ban(w http.ResponseWriter, r *http.Request) {
+	h.updateDenylist(w, r, ActionBan, h.denylist.Add)
+}
+
+// Unban allows the requests of ips, public keys or addresses again
+func (h *Handlers) Unban(w http.ResponseWriter, r *http.Request) {
+	h.updateDenylist(w, r, ActionUnban, h.denylist.Remove)
+}
+
+// updateDenylist applies a change to the denylist, which is shared by every community
+func (h *Handlers) updateDenylist(w http.ResponseWriter, r *http.Request, action string, update func(...string)) {
+	var req DenylistRequest
+
+	h.act(w, r, action, &req, func(ctx context.Context, c *community.Community) error {
+		if len(req.Entries) == 0 {
+			return ErrNoEntries
+		}
+
+		update(req.Entries...)
+
+		return nil
+	})
+}
+
+type PauseRequest struct {
+	Paused bool   `json:"paused"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// PauseState returns whether the station is paused, and why
+func (h *Handlers) PauseState(w http.ResponseWriter, r *http.Request) {
+	err := h.responder.EncryptedBody(w, r.Context(), h.breaker.State())
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+}
+
+// Pause stops every transaction of the station, or resumes them
+func (h *Handlers) Pause(w http.ResponseWriter, r *http.Request) {
+	var req PauseRequest
+
+	h.act(w, r, ActionPause, &req, func(ctx context.Context, c *community.Community) error {
+		if h.breaker == nil {
+			return ErrNoBreaker
+		}
+
+		if !req.Paused {
+			h.breaker.Resume()
+			return nil
+		}
+
+		if req.Reason == "" {
+			req.Reason = "paused by an admin"
+		}
+
+		h.breaker.Pause(breaker.SourceAdmin, req.Reason)
+
+		return nil
+	})
+}
+
+// act decodes the request into params, records the intent to take the action in the audit log, takes it and records its outcome.
+// Actions are not taken when their intent cannot be recorded. The outcome is returned to the admin.
+// The community of the request is nil for actions which apply to the whole station.
+func (h *Handlers) act(w http.ResponseWriter, r *http.Request, action string, params any, fn func(context.Context, *community.Community) error) {
+	ctx := r.Context()
+
+	addr, ok := cw.GetAddressFromContext(ctx)
+	if !ok {
+		h.writeError(w, r, response.ErrUnauthorized)
+		return
+	}
+
+	err := json.NewDecoder(r.Body).Decode(params)
+	if err != nil {
+		h.writeError(w, r, response.BadRequest(err))
+		return
+	}
+	defer r.Body.Close()
+
+	entry := Entry{
+		Time:   time.Now().UTC(),
+		Admin:  addr,
+		Action: action,
+		Params: params,
+		Status: StatusIntent,
+	}
+
+	entry.RequestID, _ = logger.RequestID(ctx)
+
+	c, ok := community.FromContext(ctx)
+	if ok {
+		entry.Community = chi.URLParam(r, "id")
+	}
+
+	err = h.audit.Record(entry)
+	if err != nil {
+		logger.From(ctx).Error("unable to record admin action", err, "action", action, "admin", addr)
+		h.writeError(w, r, ErrNoAudit)
+		return
+	}
+
+	err = fn(ctx, c)
+
+	entry.Time = time.Now().UTC()
+	entry.Status = StatusSucceeded
+	if err != nil {
+		entry.Status = StatusFailed
+		entry.Error = err.Error()
+	}
+
+	// the action was taken, its intent is in the log even if its outcome cannot be recorded
+	rerr := h.audit.Record(entry)
+	if rerr != nil {
+		logger.From(ctx).Error("unable to record the outcome of an admin action", rerr, "action", action, "admin", addr)
+	}
+
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	logger.From(ctx).Info("admin action", "action", action, "admin", addr, "community", entry.Community)
+
+	err = h.responder.EncryptedBody(w, ctx, entry)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+}
+
+// writeError writes the error response matching an error from the admin actions
+func (h *Handlers) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	switch err {
+	case community.ErrInvalidAddress, community.ErrInvalidAmount, community.ErrInvalidLimit, ErrNoEntries:
+		err = response.BadRequest(err)
+	case community.ErrCommunityNotFound, ErrNoBreaker:
+		err = response.NotFound(err)
+	}
+
+	h.responder.Error(w, r.Context(), err)
+}
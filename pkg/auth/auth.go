@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// roles which can be required by routes
+const (
+	RoleAdmin = "admin"
+)
+
+var (
+	ErrMissingRole = errors.New("the signer of the request does not have the required role")
+)
+
+// Policy is who can call a route
+type Policy struct {
+	Signed bool   // the request must be signed
+	Role   string // the signer must have the role, implies a signed request
+}
+
+var (
+	// Public routes can be called without a signature
+	Public = Policy{}
+
+	// Signed routes can be called by any signer
+	Signed = Policy{Signed: true}
+)
+
+// RequireRole returns the policy of routes which can only be called by signers with the role
+func RequireRole(role string) Policy {
+	return Policy{Signed: true, Role: role}
+}
+
+// Roles holds the addresses which have each role, it can be changed at runtime
+type Roles struct {
+	mu      sync.RWMutex
+	members map[string]map[string]bool
+}
+
+// NewRoles instantiates roles without any member
+func NewRoles() *Roles {
+	return &Roles{
+		members: map[string]map[string]bool{},
+	}
+}
+
+// Grant gives a role to addresses
+func (r *Roles) Grant(role string, addresses ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m, ok := r.members[role]
+	if !ok {
+		m = map[string]bool{}
+		r.members[role] = m
+	}
+
+	for _, a := range addresses {
+		m[strings.ToLower(a)] = true
+	}
+}
+
+// Revoke takes a role from addresses
+func (r *Roles) Revoke(role string, addresses ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, a := range addresses {
+		delete(r.members[role], strings.ToLower(a))
+	}
+}
+
+// Has returns whether an address has a role
+func (r *Roles) Has(role, address string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.members[role][strings.ToLower(address)]
+}
+
+// Members returns the addresses which have a role, sorted
+func (r *Roles) Members(role string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	members := make([]string, 0, len(r.members[role]))
+	for a := range r.members[role] {
+		members = append(members, a)
+	}
+
+	sort.Strings(members)
+
+	return members
+}
+
+// Load replaces the members with the ones of a json file of addresses by role
+func (r *Roles) Load(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var file map[string][]string
+	err = json.Unmarshal(b, &file)
+	if err != nil {
+		return err
+	}
+
+	members := map[string]map[string]bool{}
+	for role, addresses := range file {
+		members[role] = map[string]bool{}
+
+		for _, a := range addresses {
+			members[role][strings.ToLower(a)] = true
+		}
+	}
+
+	r.mu.Lock()
+	r.members = members
+	r.mu.Unlock()
+
+	return nil
+}
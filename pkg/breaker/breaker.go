@@ -0,0 +1,198 @@
+package breaker
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/daobrussels/cw/pkg/common/response"
+	"github.com/daobrussels/cw/pkg/metrics"
+	"golang.org/x/exp/slog"
+)
+
+// sources of a pause
+const (
+	SourceAdmin  = "admin"  // paused through the admin api
+	SourceSignal = "signal" // paused by a signal sent to the station
+	SourceAuto   = "auto"   // tripped by a threshold
+)
+
+const (
+	revertWindow = time.Minute
+	spendWindow  = time.Hour
+)
+
+// Thresholds trip the breaker automatically, zero values are disabled
+type Thresholds struct {
+	Reverts  int      // reverted transactions per minute
+	MaxSpend *big.Int // gas paid by the supply wallet per hour, in wei
+}
+
+// State is whether the station is paused, and why
+type State struct {
+	Paused bool      `json:"paused"`
+	Source string    `json:"source,omitempty"`
+	Reason string    `json:"reason,omitempty"`
+	Since  time.Time `json:"since,omitempty"`
+}
+
+type spend struct {
+	at     time.Time
+	amount *big.Int
+}
+
+// Breaker stops the station from spending: community transactions, sponsorships, operations and forwarded transactions.
+// It is paused by operators or trips when transactions revert or gas is paid faster than the thresholds allow.
+// A nil breaker is never paused.
+type Breaker struct {
+	mu    sync.Mutex
+	state State
+	conf  Thresholds
+
+	reverts []time.Time
+	spent   []spend
+}
+
+// New instantiates a breaker which is not paused
+func New(conf Thresholds) *Breaker {
+	return &Breaker{
+		conf: conf,
+	}
+}
+
+// Check returns response.ErrPaused along with the reason while the breaker is paused
+func (b *Breaker) Check() error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.state.Paused {
+		return nil
+	}
+
+	return response.ErrPaused.WithDetail("reason", b.state.Reason)
+}
+
+// State returns whether the breaker is paused, and why
+func (b *Breaker) State() State {
+	if b == nil {
+		return State{}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+// Pause stops the station from spending until it is resumed, pausing again keeps the original reason
+func (b *Breaker) Pause(source, reason string) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.pause(source, reason)
+}
+
+// pause must be called with the lock held
+func (b *Breaker) pause(source, reason string) {
+	if b.state.Paused {
+		return
+	}
+
+	b.state = State{
+		Paused: true,
+		Source: source,
+		Reason: reason,
+		Since:  time.Now().UTC(),
+	}
+
+	metrics.Paused.Set(1)
+
+	slog.Error("station paused", nil, "source", source, "reason", reason)
+}
+
+// Resume lets the station spend again, the counts of the thresholds start over
+func (b *Breaker) Resume() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.state.Paused {
+		return
+	}
+
+	b.state = State{}
+	b.reverts = nil
+	b.spent = nil
+
+	metrics.Paused.Set(0)
+
+	slog.Info("station resumed")
+}
+
+// Reverted records a reverted transaction, the breaker trips when too many revert within a minute
+func (b *Breaker) Reverted() {
+	if b == nil || b.conf.Reverts <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+
+	b.reverts = append(b.reverts, now)
+
+	// drop the reverts which left the window
+	i := 0
+	for i < len(b.reverts) && now.Sub(b.reverts[i]) > revertWindow {
+		i++
+	}
+	b.reverts = b.reverts[i:]
+
+	if len(b.reverts) >= b.conf.Reverts {
+		b.pause(SourceAuto, fmt.Sprintf("%d transactions reverted within %v", len(b.reverts), revertWindow))
+	}
+}
+
+// Spent records gas paid by the supply wallet, the breaker trips when more is paid within an hour than allowed
+func (b *Breaker) Spent(amount *big.Int) {
+	if b == nil || b.conf.MaxSpend == nil || b.conf.MaxSpend.Sign() <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+
+	b.spent = append(b.spent, spend{now, new(big.Int).Set(amount)})
+
+	total := new(big.Int)
+
+	// drop the spends which left the window
+	i := 0
+	for i < len(b.spent) && now.Sub(b.spent[i].at) > spendWindow {
+		i++
+	}
+	b.spent = b.spent[i:]
+
+	for _, s := range b.spent {
+		total.Add(total, s.amount)
+	}
+
+	if total.Cmp(b.conf.MaxSpend) > 0 {
+		b.pause(SourceAuto, fmt.Sprintf("%s wei of gas paid within %v", total.String(), spendWindow))
+	}
+}
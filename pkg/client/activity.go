@@ -0,0 +1,135 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/daobrussels/cw/pkg/common/response"
+	"github.com/daobrussels/cw/pkg/community"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// maxEventSize is the maximum size of a line of the activity stream
+const maxEventSize = 1 << 20
+
+// Activity calls fn with the transactions of an account as they are indexed, until the context is done or fn fails.
+// When a cursor is provided, the transactions indexed after it are received first.
+// The stream is resumed from the last transaction received when the connection drops.
+func (c *Client) Activity(ctx context.Context, account common.Address, cursor string, fn func(community.Transaction) error) error {
+	if c.server == "" {
+		return ErrNoHandshake
+	}
+
+	var ferr error
+
+	handle := func(tx community.Transaction) error {
+		ferr = fn(tx)
+		return ferr
+	}
+
+	backoff := c.Backoff
+
+	for attempt := 0; ; attempt++ {
+		next, err := c.stream(ctx, c.prefix+"/accounts/"+account.Hex()+"/activity", cursor, handle)
+		if ferr != nil {
+			return ferr
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if next != cursor {
+			// the stream made progress, the connection dropped rather than failed
+			cursor = next
+			attempt = 0
+			backoff = c.Backoff
+		}
+
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+
+		var e *response.Error
+		if attempt >= c.Retries || (errors.As(err, &e) && !retryable(http.MethodGet, err)) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+	}
+}
+
+// stream reads server-sent events from the activity stream and returns the id of the last one handled
+func (c *Client) stream(ctx context.Context, path, cursor string, fn func(community.Transaction) error) (string, error) {
+	r, err := c.request(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return cursor, err
+	}
+
+	r.Header.Set("Accept", "text/event-stream")
+
+	if cursor != "" {
+		r.Header.Set("Last-Event-ID", cursor)
+	}
+
+	resp, err := c.http.Do(r)
+	if err != nil {
+		return cursor, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		body, _ := io.ReadAll(resp.Body)
+		return cursor, c.statusError(resp, body)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxEventSize)
+
+	var id, data string
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case line == "":
+			// a blank line ends an event
+			if data == "" {
+				continue
+			}
+
+			var tx community.Transaction
+
+			// the signature is carried by each event
+			err := c.decoder.Decode([]byte(data), "", &tx)
+			if err != nil {
+				return cursor, err
+			}
+
+			err = fn(tx)
+			if err != nil {
+				return cursor, err
+			}
+
+			cursor = id
+			id, data = "", ""
+		case strings.HasPrefix(line, "id:"):
+			id = strings.TrimSpace(strings.TrimPrefix(line, "id:"))
+		case strings.HasPrefix(line, "data:"):
+			data += strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		}
+	}
+
+	return cursor, scanner.Err()
+}
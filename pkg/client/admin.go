@@ -0,0 +1,106 @@
+package client
+
+import (
+	"context"
+	"math/big"
+	"net/http"
+
+	"github.com/daobrussels/cw/pkg/admin"
+	"github.com/daobrussels/cw/pkg/breaker"
+	"github.com/daobrussels/cw/pkg/common/ethrequest"
+	"github.com/daobrussels/cw/pkg/community"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// adminPath returns the path of an admin route of the community with the given id.
+// Admin routes can only be called by clients whose address has the admin role.
+func adminPath(id, path string) string {
+	return "/admin/communities/" + id + path
+}
+
+// CommunityStatus returns the funds, ownership and controls of a community
+func (c *Client) CommunityStatus(ctx context.Context, id string) (*admin.CommunityStatus, error) {
+	var status admin.CommunityStatus
+
+	err := c.get(ctx, adminPath(id, ""), &status)
+	if err != nil {
+		return nil, err
+	}
+
+	return &status, nil
+}
+
+// DepositPaymaster funds the paymaster of a community from the supply wallet of the station
+func (c *Client) DepositPaymaster(ctx context.Context, id string, amount *big.Int) error {
+	return c.send(ctx, http.MethodPost, adminPath(id, "/paymaster/deposit"), admin.DepositRequest{Amount: amount}, nil)
+}
+
+// WithdrawPaymaster withdraws from the deposit of the paymaster of a community
+func (c *Client) WithdrawPaymaster(ctx context.Context, id string, to common.Address, amount *big.Int) error {
+	return c.send(ctx, http.MethodPost, adminPath(id, "/paymaster/withdraw"), admin.WithdrawRequest{To: to, Amount: amount}, nil)
+}
+
+// SetMintLimit replaces the limit of a single gratitude mint in a community
+func (c *Client) SetMintLimit(ctx context.Context, id string, l community.MintLimit) error {
+	return c.send(ctx, http.MethodPut, adminPath(id, "/limits/mint"), l, nil)
+}
+
+// PauseSponsorship pauses or resumes sponsorship by the paymaster of a community
+func (c *Client) PauseSponsorship(ctx context.Context, id string, paused bool) error {
+	return c.send(ctx, http.MethodPut, adminPath(id, "/sponsorship"), admin.SponsorshipRequest{Paused: paused}, nil)
+}
+
+// PendingOps returns the transactions carrying operations of a community which are not mined yet
+func (c *Client) PendingOps(ctx context.Context, id string) ([]ethrequest.PendingTx, error) {
+	var ops []ethrequest.PendingTx
+
+	_, err := c.getMultiple(ctx, adminPath(id, "/ops/pending"), &ops)
+
+	return ops, err
+}
+
+// RotateKey hands the paymaster of a community over to the address of a new supply key
+func (c *Client) RotateKey(ctx context.Context, id string, owner common.Address) error {
+	return c.send(ctx, http.MethodPost, adminPath(id, "/keys/rotate"), admin.RotateKeyRequest{Owner: owner}, nil)
+}
+
+// Denylist returns the ips, public keys and addresses denied by the station
+func (c *Client) Denylist(ctx context.Context) ([]string, error) {
+	var entries []string
+
+	_, err := c.getMultiple(ctx, "/admin/denylist", &entries)
+
+	return entries, err
+}
+
+// Ban denies the requests of ips, public keys or addresses
+func (c *Client) Ban(ctx context.Context, entries ...string) error {
+	return c.send(ctx, http.MethodPut, "/admin/denylist", admin.DenylistRequest{Entries: entries}, nil)
+}
+
+// Unban allows the requests of ips, public keys or addresses again
+func (c *Client) Unban(ctx context.Context, entries ...string) error {
+	return c.send(ctx, http.MethodDelete, "/admin/denylist", admin.DenylistRequest{Entries: entries}, nil)
+}
+
+// PauseState returns whether the station is paused, and why
+func (c *Client) PauseState(ctx context.Context) (*breaker.State, error) {
+	var state breaker.State
+
+	err := c.get(ctx, "/admin/pause", &state)
+	if err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+// Pause stops every transaction of the station for a reason
+func (c *Client) Pause(ctx context.Context, reason string) error {
+	return c.send(ctx, http.MethodPut, "/admin/pause", admin.PauseRequest{Paused: true, Reason: reason}, nil)
+}
+
+// Resume lets a paused station send transactions again
+func (c *Client) Resume(ctx context.Context) error {
+	return c.send(ctx, http.MethodPut, "/admin/pause", admin.PauseRequest{Paused: false}, nil)
+}
@@ -0,0 +1,340 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/daobrussels/cw/pkg/common/request"
+	"github.com/daobrussels/cw/pkg/common/response"
+	"github.com/daobrussels/cw/pkg/common/supply"
+	"github.com/daobrussels/cw/pkg/cw"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	// DefaultTimeout is how long a single attempt of a request can take
+	DefaultTimeout = 30 * time.Second
+
+	// DefaultRetries is how many times a failed request is retried
+	DefaultRetries = 3
+
+	// DefaultBackoff is the delay before the first retry, it doubles with every retry
+	DefaultBackoff = 500 * time.Millisecond
+)
+
+var (
+	ErrNoHandshake      = errors.New("the hello handshake with the station has not been done")
+	ErrUnexpectedServer = errors.New("the station does not have the expected address")
+)
+
+// Client calls a station, requests are signed and encrypted for the station and its responses are verified
+type Client struct {
+	url    string
+	prefix string // path of the community routes
+
+	http *http.Client
+	key  *supply.Supply
+
+	server  string // public key of the station
+	decoder response.Decoder
+
+	// Station is the expected address of the station, checked during the handshake when set
+	Station string
+
+	// Chain is the chain configuration of the station, received during the handshake
+	Chain cw.ChainConfig
+
+	Timeout time.Duration
+	Retries int
+	Backoff time.Duration
+}
+
+// New instantiates a client for the station at url, requests are signed with the private key
+func New(url, hexkey string) (*Client, error) {
+	key, err := supply.New(hexkey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		url:     strings.TrimRight(url, "/"),
+		prefix:  "/community",
+		http:    &http.Client{},
+		key:     key,
+		decoder: response.Decoder{HexKey: key.PrivateHexKey},
+		Timeout: DefaultTimeout,
+		Retries: DefaultRetries,
+		Backoff: DefaultBackoff,
+	}, nil
+}
+
+// Address returns the address which signs the requests of the client
+func (c *Client) Address() common.Address {
+	return common.HexToAddress(c.key.Address)
+}
+
+// Community returns a client for the community with the given id, the default community is used otherwise
+func (c *Client) Community(id string) *Client {
+	cp := *c
+	cp.prefix = "/communities/" + id
+
+	return &cp
+}
+
+// Hello does the handshake with the station, its public key is used to encrypt the following requests.
+// The chain configuration it returns must be signed by the address of this public key.
+func (c *Client) Hello(ctx context.Context) error {
+	var chain cw.ChainConfig
+
+	body, header, err := c.do(ctx, http.MethodGet, "/hello", nil)
+	if err != nil {
+		return err
+	}
+
+	server := header.Get(cw.PubKeyHeader)
+
+	pubkey, err := crypto.DecompressPubkey(common.FromHex(server))
+	if err != nil {
+		return err
+	}
+
+	address := crypto.PubkeyToAddress(*pubkey).Hex()
+
+	if c.Station != "" && !strings.EqualFold(address, c.Station) {
+		return ErrUnexpectedServer
+	}
+
+	decoder := response.Decoder{HexKey: c.key.PrivateHexKey, Signer: address}
+
+	err = decoder.Decode(body, header.Get(cw.SignatureHeader), &chain)
+	if err != nil {
+		return err
+	}
+
+	c.server = server
+	c.decoder = decoder
+	c.Chain = chain
+
+	return nil
+}
+
+// get requests a single object
+func (c *Client) get(ctx context.Context, path string, v any) error {
+	if c.server == "" {
+		return ErrNoHandshake
+	}
+
+	body, header, err := c.do(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+
+	return c.decoder.Decode(body, header.Get(cw.SignatureHeader), v)
+}
+
+// getMultiple requests a list of objects and returns its page
+func (c *Client) getMultiple(ctx context.Context, path string, v any) (*response.Page, error) {
+	if c.server == "" {
+		return nil, ErrNoHandshake
+	}
+
+	body, header, err := c.do(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.decoder.DecodeMultiple(body, header.Get(cw.SignatureHeader), v)
+}
+
+// send sends a signed and encrypted request, the response is decoded into v unless it is nil
+func (c *Client) send(ctx context.Context, method, path string, req, v any) error {
+	if c.server == "" {
+		return ErrNoHandshake
+	}
+
+	body, header, err := c.do(ctx, method, path, req)
+	if err != nil {
+		return err
+	}
+
+	if v == nil || len(body) == 0 {
+		return nil
+	}
+
+	return c.decoder.Decode(body, header.Get(cw.SignatureHeader), v)
+}
+
+// do makes a request, retrying it while it fails with a retryable error
+func (c *Client) do(ctx context.Context, method, path string, req any) ([]byte, http.Header, error) {
+	backoff := c.Backoff
+
+	for attempt := 0; ; attempt++ {
+		body, header, err := c.attempt(ctx, method, path, req)
+		if err == nil || attempt >= c.Retries || !retryable(method, err) {
+			return body, header, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+	}
+}
+
+// attempt makes a single request, requests with a body are signed again since they expire
+func (c *Client) attempt(ctx context.Context, method, path string, req any) ([]byte, http.Header, error) {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	r, err := c.request(ctx, method, path, req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := c.http.Do(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, nil, c.statusError(resp, body)
+	}
+
+	return body, resp.Header, nil
+}
+
+// request builds a request to the station, a body is signed with the key of the client and encrypted for the station.
+// Requests without a body sign their method and path in headers.
+func (c *Client) request(ctx context.Context, method, path string, req any) (*http.Request, error) {
+	var body io.Reader
+	var signature string
+
+	if req != nil {
+		b, err := json.Marshal(req)
+		if err != nil {
+			return nil, err
+		}
+
+		sreq := request.New(c.key.Address, b)
+
+		signature, err = sreq.GenerateSignature(c.key.PrivateHexKey)
+		if err != nil {
+			return nil, err
+		}
+
+		secure, err := sreq.Encrypt(c.server)
+		if err != nil {
+			return nil, err
+		}
+
+		b, err = json.Marshal(map[string]string{"secure": secure})
+		if err != nil {
+			return nil, err
+		}
+
+		body = bytes.NewReader(b)
+	}
+
+	r, err := http.NewRequestWithContext(ctx, method, c.url+path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	r.Header.Set(cw.PubKeyHeader, c.key.PubHexKey)
+
+	if req != nil {
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set(cw.SignatureHeader, signature)
+
+		return r, nil
+	}
+
+	qreq := request.NewQuery(c.key.Address, method, r.URL.RequestURI())
+
+	signature, err = qreq.GenerateSignature(c.key.PrivateHexKey)
+	if err != nil {
+		return nil, err
+	}
+
+	r.Header.Set(cw.AddressHeader, c.key.Address)
+	r.Header.Set(cw.ExpiryHeader, qreq.FormatExpiry())
+	r.Header.Set(cw.SignatureHeader, signature)
+
+	return r, nil
+}
+
+// statusError returns the error of a failed response, responses which are not structured get a generic error
+func (c *Client) statusError(resp *http.Response, body []byte) error {
+	err := c.decoder.Decode(body, resp.Header.Get(cw.SignatureHeader), nil)
+
+	var e *response.Error
+	if errors.As(err, &e) {
+		e.Status = resp.StatusCode
+		return e
+	}
+
+	code := response.CodeInternal
+
+	switch resp.StatusCode {
+	case http.StatusBadRequest, http.StatusMethodNotAllowed:
+		code = response.CodeBadRequest
+	case http.StatusUnauthorized:
+		code = response.CodeUnauthorized
+	case http.StatusNotFound:
+		code = response.CodeNotFound
+	case http.StatusTooManyRequests:
+		code = response.CodeRateLimited
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		code = response.CodeUnavailable
+	}
+
+	return response.NewError(resp.StatusCode, code, http.StatusText(resp.StatusCode))
+}
+
+// retryable returns whether a failed request can be made again.
+// Requests which change state are only retried when the station says so, they could have been processed otherwise:
+// a gateway can time out after the station submitted an operation.
+func retryable(method string, err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var e *response.Error
+	if errors.As(err, &e) {
+		// a paused station stays paused until an operator resumes it
+		if e.Code == response.CodePaused {
+			return false
+		}
+
+		switch e.Status {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			if method == http.MethodGet {
+				return true
+			}
+		}
+
+		return e.Retryable
+	}
+
+	return method == http.MethodGet
+}
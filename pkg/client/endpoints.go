@@ -0,0 +1,282 @@
+package client
+
+import (
+	"context"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/daobrussels/cw/pkg/common/response"
+	"github.com/daobrussels/cw/pkg/community"
+	"github.com/daobrussels/cw/pkg/transaction"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// SendTransaction forwards a signed transaction to the chain
+func (c *Client) SendTransaction(ctx context.Context, tx string) error {
+	return c.send(ctx, http.MethodPost, "/transaction", transaction.SignedTx{TX: tx}, nil)
+}
+
+// Communities returns the addresses of all communities served by the station, by id
+func (c *Client) Communities(ctx context.Context) (map[string]community.CommunityAddress, error) {
+	var communities map[string]community.CommunityAddress
+
+	err := c.get(ctx, "/communities", &communities)
+
+	return communities, err
+}
+
+// Config returns the addresses of the community
+func (c *Client) Config(ctx context.Context) (*community.CommunityAddress, error) {
+	var addr community.CommunityAddress
+
+	err := c.get(ctx, c.prefix, &addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &addr, nil
+}
+
+// CreateAccount creates an account owned by the client and returns its address
+func (c *Client) CreateAccount(ctx context.Context) (common.Address, error) {
+	var resp response.AddressResponse
+
+	err := c.send(ctx, http.MethodPost, c.prefix+"/account", struct{}{}, &resp)
+
+	return common.HexToAddress(resp.Address), err
+}
+
+// Guardians returns the guardians of an account
+func (c *Client) Guardians(ctx context.Context, account common.Address) (*community.GuardianSet, error) {
+	var set community.GuardianSet
+
+	err := c.get(ctx, c.prefix+"/account/"+account.Hex()+"/guardians", &set)
+	if err != nil {
+		return nil, err
+	}
+
+	return &set, nil
+}
+
+// AddGuardian adds a guardian to an account owned by the client, a threshold of 0 keeps a majority
+func (c *Client) AddGuardian(ctx context.Context, account, guardian common.Address, threshold int) (*community.GuardianSet, error) {
+	return c.updateGuardians(ctx, http.MethodPut, community.GuardianRequest{
+		Account:   account,
+		Guardian:  guardian,
+		Threshold: threshold,
+	})
+}
+
+// RemoveGuardian removes a guardian from an account owned by the client
+func (c *Client) RemoveGuardian(ctx context.Context, account, guardian common.Address) (*community.GuardianSet, error) {
+	return c.updateGuardians(ctx, http.MethodDelete, community.GuardianRequest{
+		Account:  account,
+		Guardian: guardian,
+	})
+}
+
+// updateGuardians sends a guardian request and returns the resulting guardians
+func (c *Client) updateGuardians(ctx context.Context, method string, req community.GuardianRequest) (*community.GuardianSet, error) {
+	var set community.GuardianSet
+
+	err := c.send(ctx, method, c.prefix+"/account/guardians", req, &set)
+	if err != nil {
+		return nil, err
+	}
+
+	return &set, nil
+}
+
+// SessionKeys returns the active session keys of an account
+func (c *Client) SessionKeys(ctx context.Context, account common.Address) ([]community.SessionKey, error) {
+	var keys []community.SessionKey
+
+	_, err := c.getMultiple(ctx, c.prefix+"/account/"+account.Hex()+"/sessions", &keys)
+
+	return keys, err
+}
+
+// RegisterSessionKey registers a session key for an account owned by the client
+func (c *Client) RegisterSessionKey(ctx context.Context, req community.SessionKeyRequest) error {
+	return c.send(ctx, http.MethodPut, c.prefix+"/account/sessions", req, nil)
+}
+
+// RevokeSessionKey revokes a session key of an account owned by the client
+func (c *Client) RevokeSessionKey(ctx context.Context, account, key common.Address) error {
+	return c.send(ctx, http.MethodDelete, c.prefix+"/account/sessions", community.SessionKeyRequest{
+		Account: account,
+		Key:     key,
+	}, nil)
+}
+
+// SubmitOp submits an operation with the call data for the account of the client
+func (c *Client) SubmitOp(ctx context.Context, data []byte) error {
+	return c.send(ctx, http.MethodPost, c.prefix+"/op", community.SubmitOpRequest{Data: data}, nil)
+}
+
+// SubmitCalls submits calls in a single operation and returns their results once it is mined
+func (c *Client) SubmitCalls(ctx context.Context, calls []community.Call) (*community.OpResult, error) {
+	var result community.OpResult
+
+	err := c.send(ctx, http.MethodPost, c.prefix+"/op", community.SubmitOpRequest{Calls: calls}, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// SubmitSessionOp submits a user operation signed by a session key
+func (c *Client) SubmitSessionOp(ctx context.Context, op community.UserOp) error {
+	return c.send(ctx, http.MethodPost, c.prefix+"/op/session", op, nil)
+}
+
+// Sponsor returns the paymasterAndData which sponsors a user operation
+func (c *Client) Sponsor(ctx context.Context, op community.UserOp) (*community.Sponsorship, error) {
+	var sp community.Sponsorship
+
+	err := c.send(ctx, http.MethodPost, c.prefix+"/paymaster/sponsor", op, &sp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sp, nil
+}
+
+// QuoteToken returns the maximum amount of community tokens a user operation will be charged for gas
+func (c *Client) QuoteToken(ctx context.Context, op community.UserOp) (*community.TokenQuote, error) {
+	var q community.TokenQuote
+
+	err := c.send(ctx, http.MethodPost, c.prefix+"/paymaster/quote", op, &q)
+	if err != nil {
+		return nil, err
+	}
+
+	return &q, nil
+}
+
+// TokenAccounting returns the gas fees collected in community tokens
+func (c *Client) TokenAccounting(ctx context.Context) (*community.TokenAccounting, error) {
+	var acc community.TokenAccounting
+
+	err := c.get(ctx, c.prefix+"/paymaster/accounting", &acc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &acc, nil
+}
+
+// CreateGratitudeApp creates a gratitude app owned by the client, or by one of its accounts when set
+func (c *Client) CreateGratitudeApp(ctx context.Context, account *common.Address) (common.Address, error) {
+	var resp response.AddressResponse
+
+	err := c.send(ctx, http.MethodPost, c.prefix+"/gratitude", community.CreateGratitudeAppRequest{Account: account}, &resp)
+
+	return common.HexToAddress(resp.Address), err
+}
+
+// MintGratitude mints gratitude tokens of an app owned by an account of the client to the recipients
+func (c *Client) MintGratitude(ctx context.Context, account, app common.Address, recipients []common.Address, amounts []*big.Int) error {
+	return c.send(ctx, http.MethodPost, c.prefix+"/gratitude/mint", community.MintGratitudeRequest{
+		Account:    account,
+		App:        app,
+		Recipients: recipients,
+		Amounts:    amounts,
+	}, nil)
+}
+
+// TransferGratitude transfers gratitude tokens held by an account of the client which owns the app
+func (c *Client) TransferGratitude(ctx context.Context, account, app, to common.Address, amount *big.Int) error {
+	return c.send(ctx, http.MethodPost, c.prefix+"/gratitude/transfer", community.TransferGratitudeRequest{
+		Account: account,
+		App:     app,
+		To:      to,
+		Amount:  amount,
+	}, nil)
+}
+
+// GratitudeApps returns the gratitude apps owned by an address
+func (c *Client) GratitudeApps(ctx context.Context, owner common.Address) ([]community.GratitudeApp, error) {
+	var apps []community.GratitudeApp
+
+	_, err := c.getMultiple(ctx, c.prefix+"/gratitude/apps/"+owner.Hex(), &apps)
+
+	return apps, err
+}
+
+// GratitudeTokens returns the gratitude tokens held by an address
+func (c *Client) GratitudeTokens(ctx context.Context, holder common.Address) ([]community.GratitudeBalance, error) {
+	var tokens []community.GratitudeBalance
+
+	_, err := c.getMultiple(ctx, c.prefix+"/gratitude/tokens/"+holder.Hex(), &tokens)
+
+	return tokens, err
+}
+
+// Transactions returns a page of the transaction history of an account, most recent first
+func (c *Client) Transactions(ctx context.Context, account common.Address, q community.TransactionQuery) (*community.TransactionPage, error) {
+	var txs []community.Transaction
+
+	page, err := c.getMultiple(ctx, c.prefix+"/accounts/"+account.Hex()+"/transactions?"+transactionQuery(q).Encode(), &txs)
+	if err != nil {
+		return nil, err
+	}
+
+	tp := &community.TransactionPage{
+		Transactions: txs,
+	}
+
+	if page != nil {
+		tp.Next = page.Cursor
+		tp.Limit = page.Limit
+	}
+
+	return tp, nil
+}
+
+// transactionQuery encodes the filters of a transaction history request
+func transactionQuery(q community.TransactionQuery) url.Values {
+	v := url.Values{}
+
+	if q.Token != nil {
+		v.Set("token", q.Token.Hex())
+	}
+
+	if q.Direction != "" {
+		v.Set("direction", q.Direction)
+	}
+
+	if !q.Since.IsZero() {
+		v.Set("since", q.Since.Format(time.RFC3339))
+	}
+
+	if !q.Until.IsZero() {
+		v.Set("until", q.Until.Format(time.RFC3339))
+	}
+
+	if q.Cursor != "" {
+		v.Set("cursor", q.Cursor)
+	}
+
+	if q.Limit > 0 {
+		v.Set("limit", strconv.Itoa(q.Limit))
+	}
+
+	return v
+}
+
+// Balances returns the native, community token and gratitude balances of an account
+func (c *Client) Balances(ctx context.Context, account common.Address) (*community.Balances, error) {
+	var b community.Balances
+
+	err := c.get(ctx, c.prefix+"/accounts/"+account.Hex()+"/balances", &b)
+	if err != nil {
+		return nil, err
+	}
+
+	return &b, nil
+}
@@ -0,0 +1,252 @@
+package ethrequest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	// DefaultTimeout is how long a single rpc call can take
+	DefaultTimeout = 15 * time.Second
+
+	// DefaultRetries is how many times a call failing with a transient error is retried
+	DefaultRetries = 3
+
+	// DefaultBackoff is the delay before the first retry, it doubles with every retry
+	DefaultBackoff = 250 * time.Millisecond
+)
+
+// Config sets how calls to an rpc endpoint are made
+type Config struct {
+	// Timeout is how long a single attempt of a call can take, 0 for no timeout
+	Timeout time.Duration
+
+	// Retries is how many times a call failing with a transient error is retried, 0 to disable
+	Retries int
+
+	// Backoff is the delay before the first retry, it doubles with every retry
+	Backoff time.Duration
+}
+
+// DefaultConfig returns the configuration of new services
+func DefaultConfig() Config {
+	return Config{
+		Timeout: DefaultTimeout,
+		Retries: DefaultRetries,
+		Backoff: DefaultBackoff,
+	}
+}
+
+// call makes a call which ends when the context is done or the service is closed.
+// Each attempt is bound by the timeout, attempts failing with a transient error are retried when retry is set.
+func (e *EthService) call(ctx context.Context, retry bool, fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		select {
+		case <-e.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	backoff := e.Config.Backoff
+
+	for attempt := 0; ; attempt++ {
+		err := e.attempt(ctx, fn)
+		if err == nil || !retry || attempt >= e.Config.Retries || ctx.Err() != nil || !transient(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+	}
+}
+
+// attempt makes a single attempt of a call
+func (e *EthService) attempt(ctx context.Context, fn func(ctx context.Context) error) error {
+	if e.Config.Timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, e.Config.Timeout)
+		defer cancel()
+	}
+
+	return fn(ctx)
+}
+
+// transient returns whether a call failed because of the endpoint or the network rather than the call itself
+func transient(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var herr rpc.HTTPError
+	if errors.As(err, &herr) {
+		switch herr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+
+		return false
+	}
+
+	var nerr net.Error
+	if errors.As(err, &nerr) {
+		return true
+	}
+
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// Backend is a backend for contract bindings, its calls end when the service is closed and are timed out and retried.
+// Sending a transaction is not retried since it could have been received.
+type Backend struct {
+	e *EthService
+}
+
+func (b *Backend) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
+	var code []byte
+
+	err := b.e.call(ctx, true, func(ctx context.Context) error {
+		var err error
+		code, err = b.e.client.CodeAt(ctx, contract, blockNumber)
+		return err
+	})
+
+	return code, err
+}
+
+func (b *Backend) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	var out []byte
+
+	err := b.e.call(ctx, true, func(ctx context.Context) error {
+		var err error
+		out, err = b.e.client.CallContract(ctx, call, blockNumber)
+		return err
+	})
+
+	return out, err
+}
+
+func (b *Backend) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	var h *types.Header
+
+	err := b.e.call(ctx, true, func(ctx context.Context) error {
+		var err error
+		h, err = b.e.client.HeaderByNumber(ctx, number)
+		return err
+	})
+
+	return h, err
+}
+
+func (b *Backend) PendingCodeAt(ctx context.Context, account common.Address) ([]byte, error) {
+	var code []byte
+
+	err := b.e.call(ctx, true, func(ctx context.Context) error {
+		var err error
+		code, err = b.e.client.PendingCodeAt(ctx, account)
+		return err
+	})
+
+	return code, err
+}
+
+func (b *Backend) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	var nonce uint64
+
+	err := b.e.call(ctx, true, func(ctx context.Context) error {
+		var err error
+		nonce, err = b.e.client.PendingNonceAt(ctx, account)
+		return err
+	})
+
+	return nonce, err
+}
+
+func (b *Backend) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	var price *big.Int
+
+	err := b.e.call(ctx, true, func(ctx context.Context) error {
+		var err error
+		price, err = b.e.client.SuggestGasPrice(ctx)
+		return err
+	})
+
+	return price, err
+}
+
+func (b *Backend) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
+	var tip *big.Int
+
+	err := b.e.call(ctx, true, func(ctx context.Context) error {
+		var err error
+		tip, err = b.e.client.SuggestGasTipCap(ctx)
+		return err
+	})
+
+	return tip, err
+}
+
+func (b *Backend) EstimateGas(ctx context.Context, call ethereum.CallMsg) (uint64, error) {
+	var gas uint64
+
+	err := b.e.call(ctx, true, func(ctx context.Context) error {
+		var err error
+		gas, err = b.e.client.EstimateGas(ctx, call)
+		return err
+	})
+
+	return gas, err
+}
+
+func (b *Backend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	return b.e.call(ctx, false, func(ctx context.Context) error {
+		return b.e.client.SendTransaction(ctx, tx)
+	})
+}
+
+func (b *Backend) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	var logs []types.Log
+
+	err := b.e.call(ctx, true, func(ctx context.Context) error {
+		var err error
+		logs, err = b.e.client.FilterLogs(ctx, query)
+		return err
+	})
+
+	return logs, err
+}
+
+func (b *Backend) SubscribeFilterLogs(ctx context.Context, query ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	return b.e.client.SubscribeFilterLogs(ctx, query, ch)
+}
+
+func (b *Backend) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	var receipt *types.Receipt
+
+	err := b.e.call(ctx, true, func(ctx context.Context) error {
+		var err error
+		receipt, err = b.e.client.TransactionReceipt(ctx, txHash)
+		return err
+	})
+
+	return receipt, err
+}
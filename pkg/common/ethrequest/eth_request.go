@@ -3,9 +3,13 @@ package ethrequest
 import (
 	"context"
 	"math/big"
+	"net/http"
+	"sync"
 
+	"github.com/daobrussels/cw/pkg/breaker"
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ethereum/go-ethereum/rpc"
 )
@@ -16,32 +20,60 @@ const (
 )
 
 type EthService struct {
-	rpc    *rpc.Client
-	client *ethclient.Client
+	rpc     *rpc.Client
+	client  *ethclient.Client
+	backend *Backend
+
+	// ctx is cancelled on close, which ends the calls in flight and the watch of sent transactions
 	ctx    context.Context
+	cancel context.CancelFunc
+
+	// Config sets the timeout and the retries of the calls
+	Config Config
+
+	// Wallet is the wallet of the station, the gas it pays for the transactions it sends is recorded
+	Wallet common.Address
+
+	// Breaker is tripped by the transactions of the wallet which revert and the gas it pays, nil to disable
+	Breaker *breaker.Breaker
+
+	// pending holds the sent transactions which are being watched until they are mined
+	mu      sync.Mutex
+	pending map[common.Hash]PendingTx
 }
 
-func (e *EthService) Client() *ethclient.Client {
-	return e.client
+// Client returns a backend for contract bindings whose calls follow the configuration of the service
+func (e *EthService) Client() *Backend {
+	return e.backend
 }
 
 func NewEthService(endpoint string) (*EthService, error) {
-	rpc, err := rpc.DialHTTP(endpoint)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	e := &EthService{ctx: ctx, cancel: cancel, Config: DefaultConfig(), pending: map[common.Hash]PendingTx{}}
+
+	rpc, err := rpc.DialHTTPWithClient(endpoint, &http.Client{
+		Transport: newTransport(endpoint, e.watch),
+	})
 	if err != nil {
+		cancel()
 		return nil, err
 	}
 
-	client := ethclient.NewClient(rpc)
+	e.rpc = rpc
+	e.client = ethclient.NewClient(rpc)
+	e.backend = &Backend{e}
 
-	return &EthService{rpc, client, context.Background()}, nil
+	return e, nil
 }
 
+// Close cancels the calls in flight and closes the connection to the endpoint
 func (e *EthService) Close() {
-	e.ctx.Done()
+	e.cancel()
 	e.client.Close()
 }
 
-func (e *EthService) EstimateGas(from, to string, value uint64) (uint64, error) {
+func (e *EthService) EstimateGas(ctx context.Context, from, to string, value uint64) (uint64, error) {
 	t := common.HexToAddress(to)
 
 	msg := ethereum.CallMsg{
@@ -51,10 +83,10 @@ func (e *EthService) EstimateGas(from, to string, value uint64) (uint64, error)
 		Gas:   0,
 	}
 
-	return e.client.EstimateGas(e.ctx, msg)
+	return e.backend.EstimateGas(ctx, msg)
 }
 
-func (e *EthService) EstimateGasPrice(from string, value uint64, data []byte) (uint64, error) {
+func (e *EthService) EstimateGasPrice(ctx context.Context, from string, value uint64, data []byte) (uint64, error) {
 	msg := ethereum.CallMsg{
 		From:  common.HexToAddress(from),
 		Value: big.NewInt(int64(value)),
@@ -62,25 +94,81 @@ func (e *EthService) EstimateGasPrice(from string, value uint64, data []byte) (u
 		Gas:   0,
 	}
 
-	return e.client.EstimateGas(e.ctx, msg)
+	return e.backend.EstimateGas(ctx, msg)
 }
 
-func (e *EthService) EstimateContractGasPrice(data []byte) (uint64, error) {
+func (e *EthService) EstimateContractGasPrice(ctx context.Context, data []byte) (uint64, error) {
 	msg := ethereum.CallMsg{
 		Data: data,
 		Gas:  0,
 	}
 
-	return e.client.EstimateGas(e.ctx, msg)
+	return e.backend.EstimateGas(ctx, msg)
 }
 
-func (e *EthService) SendRawTransaction(tx string) ([]byte, error) {
-
-	err := e.rpc.Call(nil, ETHSendRawTransaction, tx)
+// SendRawTransaction sends a signed transaction, it is not retried since it could have been received
+func (e *EthService) SendRawTransaction(ctx context.Context, tx string) ([]byte, error) {
+	err := e.call(ctx, false, func(ctx context.Context) error {
+		return e.rpc.CallContext(ctx, nil, ETHSendRawTransaction, tx)
+	})
 
 	return nil, err
 }
 
-func (e *EthService) NextNonce(address string) (uint64, error) {
-	return e.client.PendingNonceAt(e.ctx, common.HexToAddress(address))
+func (e *EthService) NextNonce(ctx context.Context, address string) (uint64, error) {
+	return e.backend.PendingNonceAt(ctx, common.HexToAddress(address))
+}
+
+func (e *EthService) CodeAt(ctx context.Context, address common.Address) ([]byte, error) {
+	return e.backend.CodeAt(ctx, address, nil)
+}
+
+func (e *EthService) BalanceAt(ctx context.Context, address common.Address) (*big.Int, error) {
+	var balance *big.Int
+
+	err := e.call(ctx, true, func(ctx context.Context) error {
+		var err error
+		balance, err = e.client.BalanceAt(ctx, address, nil)
+		return err
+	})
+
+	return balance, err
+}
+
+func (e *EthService) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	return e.backend.FilterLogs(ctx, q)
+}
+
+func (e *EthService) BlockNumber(ctx context.Context) (uint64, error) {
+	var number uint64
+
+	err := e.call(ctx, true, func(ctx context.Context) error {
+		var err error
+		number, err = e.client.BlockNumber(ctx)
+		return err
+	})
+
+	return number, err
+}
+
+// ChainID returns the id of the chain of the endpoint
+func (e *EthService) ChainID(ctx context.Context) (*big.Int, error) {
+	var id *big.Int
+
+	err := e.call(ctx, true, func(ctx context.Context) error {
+		var err error
+		id, err = e.client.ChainID(ctx)
+		return err
+	})
+
+	return id, err
+}
+
+func (e *EthService) BlockTime(ctx context.Context, number uint64) (uint64, error) {
+	h, err := e.backend.HeaderByNumber(ctx, new(big.Int).SetUint64(number))
+	if err != nil {
+		return 0, err
+	}
+
+	return h.Time, nil
 }
@@ -8,6 +8,8 @@ import (
 	"io"
 	"net/http"
 	"time"
+
+	"golang.org/x/exp/slog"
 )
 
 type ErrRequest error
@@ -25,6 +27,7 @@ type jsonrpcMessage struct {
 	Method  string          `json:"method,omitempty"`
 	Params  json.RawMessage `json:"params,omitempty"`
 	Result  json.RawMessage `json:"result,omitempty"`
+	Error   json.RawMessage `json:"error,omitempty"`
 }
 
 type RawService struct {
@@ -75,7 +78,7 @@ func (r *RawService) Post(method string, body []any) ([]byte, error) {
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		b, err := io.ReadAll(resp.Body)
 		if err == nil {
-			println(string(b))
+			slog.Warn("rpc request failed", "method", method, "status", resp.StatusCode, "body", string(b))
 		}
 
 		return nil, fmt.Errorf("req: failed status code %d", resp.StatusCode)
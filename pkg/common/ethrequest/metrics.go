@@ -0,0 +1,232 @@
+package ethrequest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/daobrussels/cw/pkg/logger"
+	"github.com/daobrussels/cw/pkg/metrics"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// watchTimeout is how long a sent transaction is watched for before it is considered lost
+const watchTimeout = 10 * time.Minute
+
+// transport records and logs failed json-rpc calls and the transactions which are sent.
+// Records are logged with the logger of the context of the call, which carries the id of the request being served.
+type transport struct {
+	endpoint string // host of the rpc endpoint, the path can hold credentials
+	next     http.RoundTripper
+	sent     func(ctx context.Context, raw []byte)
+}
+
+// newTransport instantiates a transport for an rpc endpoint
+func newTransport(endpoint string, sent func(ctx context.Context, raw []byte)) *transport {
+	host := endpoint
+	if u, err := url.Parse(endpoint); err == nil {
+		host = u.Host
+	}
+
+	return &transport{host, http.DefaultTransport, sent}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+
+	if req.Body != nil {
+		var err error
+
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	calls := parseMessages(body)
+
+	ctx := req.Context()
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		t.failed(ctx, calls, err.Error())
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.failed(ctx, calls, resp.Status)
+		return resp, nil
+	}
+
+	b, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.failed(ctx, calls, err.Error())
+		return nil, err
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(b))
+
+	methods := map[string]jsonrpcMessage{}
+	for _, c := range calls {
+		methods[string(c.ID)] = c
+	}
+
+	for _, r := range parseMessages(b) {
+		call, ok := methods[string(r.ID)]
+		if !ok {
+			continue
+		}
+
+		if len(r.Error) > 0 && string(r.Error) != "null" {
+			t.failed(ctx, []jsonrpcMessage{call}, string(r.Error))
+			continue
+		}
+
+		if call.Method == ETHSendRawTransaction && t.sent != nil {
+			var params []hexutil.Bytes
+			if json.Unmarshal(call.Params, &params) == nil && len(params) > 0 {
+				t.sent(ctx, params[0])
+			}
+		}
+	}
+
+	return resp, nil
+}
+
+// failed records the failure of calls
+func (t *transport) failed(ctx context.Context, calls []jsonrpcMessage, reason string) {
+	for _, c := range calls {
+		metrics.RPCErrors.WithLabelValues(t.endpoint, c.Method).Inc()
+
+		logger.From(ctx).Warn("rpc call failed", "endpoint", t.endpoint, "method", c.Method, "reason", reason)
+	}
+}
+
+// parseMessages parses a single json-rpc message or a batch of them
+func parseMessages(b []byte) []jsonrpcMessage {
+	var batch []jsonrpcMessage
+	if json.Unmarshal(b, &batch) == nil {
+		return batch
+	}
+
+	var msg jsonrpcMessage
+	if json.Unmarshal(b, &msg) == nil {
+		return []jsonrpcMessage{msg}
+	}
+
+	return nil
+}
+
+// watch records a sent transaction and whether it is mined or reverted, as well as the gas paid by the wallet.
+// The transaction is logged with the request which sent it, watching it outlives the request.
+func (e *EthService) watch(ctx context.Context, raw []byte) {
+	var tx types.Transaction
+
+	err := tx.UnmarshalBinary(raw)
+	if err != nil {
+		return
+	}
+
+	chain := tx.ChainId().String()
+	log := logger.From(ctx).With("chain", chain, "tx", tx.Hash().Hex())
+
+	metrics.Transactions.WithLabelValues(chain, metrics.TxSubmitted).Inc()
+	log.Info("transaction sent", "nonce", tx.Nonce())
+
+	e.track(&tx)
+
+	go func() {
+		defer e.untrack(tx.Hash())
+
+		ctx, cancel := context.WithTimeout(e.ctx, watchTimeout)
+		defer cancel()
+
+		receipt, err := bind.WaitMined(ctx, e.backend, &tx)
+		if err != nil {
+			log.Error("transaction not seen on chain", err)
+			return
+		}
+
+		status := metrics.TxMined
+		if receipt.Status != types.ReceiptStatusSuccessful {
+			status = metrics.TxReverted
+		}
+
+		metrics.Transactions.WithLabelValues(chain, status).Inc()
+		log.Info("transaction "+status, "block", receipt.BlockNumber.Uint64(), "gas_used", receipt.GasUsed)
+
+		from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), &tx)
+		if err != nil || from != e.Wallet {
+			return
+		}
+
+		if status == metrics.TxReverted {
+			e.Breaker.Reverted()
+		}
+
+		fee := new(big.Int).Mul(new(big.Int).SetUint64(receipt.GasUsed), receipt.EffectiveGasPrice)
+
+		metrics.GasSpent.WithLabelValues(chain).Add(metrics.Wei(fee))
+		e.Breaker.Spent(fee)
+	}()
+}
+
+// PendingTx is a sent transaction which has not been seen on chain yet
+type PendingTx struct {
+	Hash  common.Hash     `json:"hash"`
+	To    *common.Address `json:"to,omitempty"`
+	Nonce uint64          `json:"nonce"`
+	Sent  time.Time       `json:"sent"`
+}
+
+// track records a sent transaction as pending
+func (e *EthService) track(tx *types.Transaction) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.pending[tx.Hash()] = PendingTx{
+		Hash:  tx.Hash(),
+		To:    tx.To(),
+		Nonce: tx.Nonce(),
+		Sent:  time.Now(),
+	}
+}
+
+// untrack drops a transaction which is no longer watched
+func (e *EthService) untrack(hash common.Hash) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	delete(e.pending, hash)
+}
+
+// Pending returns the sent transactions which are not mined yet, by nonce.
+// Transactions which are not seen on chain before the watch times out are dropped.
+func (e *EthService) Pending() []PendingTx {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	pending := make([]PendingTx, 0, len(e.pending))
+	for _, tx := range e.pending {
+		pending = append(pending, tx)
+	}
+
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].Nonce < pending[j].Nonce
+	})
+
+	return pending
+}
@@ -16,6 +16,13 @@ import (
 
 const (
 	hexPadding = "0x"
+
+	// MaxValidity is how far in the future the expiry of a request without a body can be
+	MaxValidity = time.Minute
+)
+
+var (
+	ErrInvalidExpiry = errors.New("the expiry of the request is invalid or too far in the future")
 )
 
 type Request struct {
@@ -34,6 +41,41 @@ func New(address string, data []byte) *Request {
 	}
 }
 
+// NewQuery returns the request which signs a request without a body, such as a GET.
+// Its data is the method and the uri, so that a signature cannot be used for another path.
+func NewQuery(address, method, uri string) *Request {
+	return New(address, queryData(method, uri))
+}
+
+// ParseQuery rebuilds the request which signs a request without a body from its headers
+func ParseQuery(address, expiry, method, uri string) (*Request, error) {
+	exp, err := time.Parse(time.RFC3339Nano, expiry)
+	if err != nil {
+		return nil, ErrInvalidExpiry
+	}
+
+	if exp.After(time.Now().Add(MaxValidity)) {
+		return nil, ErrInvalidExpiry
+	}
+
+	return &Request{
+		Version: 1,
+		Expiry:  exp.UTC(),
+		Address: address,
+		Data:    queryData(method, uri),
+	}, nil
+}
+
+// FormatExpiry formats the expiry of a request for a header, as it is marshalled when signed
+func (r *Request) FormatExpiry() string {
+	return r.Expiry.Format(time.RFC3339Nano)
+}
+
+// queryData returns the data which is signed for a request without a body
+func queryData(method, uri string) []byte {
+	return []byte(method + " " + uri)
+}
+
 // Encrypt encrypts the request data using the public key, result is base64 encoded
 func (r *Request) Encrypt(pubhexkey string) (string, error) {
 	publicKey, err := secp256k1.ParsePubKey(common.Hex2Bytes(pubhexkey))
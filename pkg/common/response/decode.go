@@ -0,0 +1,147 @@
+package response
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/daobrussels/cw/pkg/common/request"
+)
+
+var (
+	ErrInvalidSignature     = errors.New("invalid response signature")
+	ErrUnexpectedResponse   = errors.New("unexpected response type")
+	ErrMissingDecryptionKey = errors.New("secure response without a key to decrypt it")
+	ErrUnexpectedSigner     = errors.New("response signed by an unexpected address")
+)
+
+// Decoder decodes responses, secure responses are decrypted with HexKey.
+// When Signer is set, secure responses must be signed by that address.
+type Decoder struct {
+	HexKey string
+	Signer string
+}
+
+// Decode decodes a single object response into v.
+// Secure responses are decrypted with the private key of the client and their signature is verified,
+// the signature comes from the signature header or from the response itself. Error responses are returned as *Error.
+func Decode(body []byte, signature, hexkey string, v any) error {
+	return Decoder{HexKey: hexkey}.Decode(body, signature, v)
+}
+
+// Decode decodes a single object response into v, see Decode
+func (d Decoder) Decode(body []byte, signature string, v any) error {
+	var resp Response
+
+	err := json.Unmarshal(body, &resp)
+	if err != nil {
+		return err
+	}
+
+	switch resp.ResponseType {
+	case ResponseTypeObject:
+		return remarshal(resp.Object, v)
+	case ResponseTypeError:
+		if resp.Error == nil {
+			return ErrUnexpectedResponse
+		}
+
+		return resp.Error
+	case ResponseTypeSecure:
+		data, err := d.decrypt(resp, signature)
+		if err != nil {
+			return err
+		}
+
+		// errors are encrypted as a whole response
+		var inner Response
+		if json.Unmarshal(data, &inner) == nil && inner.ResponseType == ResponseTypeError && inner.Error != nil {
+			return inner.Error
+		}
+
+		return json.Unmarshal(data, v)
+	default:
+		return ErrUnexpectedResponse
+	}
+}
+
+// DecodeMultiple decodes a list response into v, which should be a pointer to a slice, and returns its page.
+// Secure responses are decrypted and verified like in Decode.
+func DecodeMultiple(body []byte, signature, hexkey string, v any) (*Page, error) {
+	return Decoder{HexKey: hexkey}.DecodeMultiple(body, signature, v)
+}
+
+// DecodeMultiple decodes a list response into v and returns its page, see DecodeMultiple
+func (d Decoder) DecodeMultiple(body []byte, signature string, v any) (*Page, error) {
+	var resp Response
+
+	err := json.Unmarshal(body, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.ResponseType == ResponseTypeSecure {
+		data, err := d.decrypt(resp, signature)
+		if err != nil {
+			return nil, err
+		}
+
+		resp = Response{}
+
+		err = json.Unmarshal(data, &resp)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if resp.ResponseType == ResponseTypeError && resp.Error != nil {
+		return nil, resp.Error
+	}
+
+	if resp.ResponseType != ResponseTypeArray {
+		return nil, ErrUnexpectedResponse
+	}
+
+	err = remarshal(resp.Objects, v)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Page, nil
+}
+
+// decrypt decrypts a secure response and verifies its signature
+func (d Decoder) decrypt(resp Response, signature string) ([]byte, error) {
+	if d.HexKey == "" {
+		return nil, ErrMissingDecryptionKey
+	}
+
+	if signature == "" {
+		signature = resp.Signature
+	}
+
+	req, err := request.Decrypt(d.HexKey, resp.Secure)
+	if err != nil {
+		return nil, err
+	}
+
+	if !req.VerifySignature(signature) {
+		return nil, ErrInvalidSignature
+	}
+
+	if d.Signer != "" && !strings.EqualFold(req.Address, d.Signer) {
+		return nil, ErrUnexpectedSigner
+	}
+
+	return req.Data, nil
+}
+
+// remarshal decodes a generically unmarshalled value into v
+func remarshal(src, v any) error {
+	b, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,211 @@
+package response
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/daobrussels/cw/pkg/cw"
+	"github.com/daobrussels/cw/pkg/logger"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// ErrorCode identifies the kind of error so that clients can react to it
+type ErrorCode string
+
+const (
+	CodeBadRequest    ErrorCode = "bad_request"
+	CodeUnauthorized  ErrorCode = "unauthorized"
+	CodePolicyDenied  ErrorCode = "policy_denied"
+	CodeNotFound      ErrorCode = "not_found"
+	CodeReverted      ErrorCode = "execution_reverted"
+	CodeNonceConflict ErrorCode = "nonce_conflict"
+	CodeRateLimited   ErrorCode = "rate_limited"
+	CodeUnavailable   ErrorCode = "unavailable"
+	CodePaused        ErrorCode = "paused"
+	CodeInternal      ErrorCode = "internal"
+)
+
+const ResponseTypeError ResponseType = "error"
+
+// Error is the body of an error response
+type Error struct {
+	Status    int            `json:"-"`
+	Code      ErrorCode      `json:"code"`
+	Message   string         `json:"message"`
+	Retryable bool           `json:"retryable"`
+	Details   map[string]any `json:"details,omitempty"`
+}
+
+var (
+	ErrBadRequest   = NewError(http.StatusBadRequest, CodeBadRequest, "invalid request")
+	ErrUnauthorized = NewError(http.StatusUnauthorized, CodeUnauthorized, "invalid or missing signature")
+	ErrNotFound     = NewError(http.StatusNotFound, CodeNotFound, "not found")
+	ErrInternal     = NewError(http.StatusInternalServerError, CodeInternal, "internal error")
+	ErrPaused       = NewError(http.StatusServiceUnavailable, CodePaused, "the station is paused and does not send transactions")
+)
+
+// NewError instantiates an error response
+func NewError(status int, code ErrorCode, message string) *Error {
+	return &Error{
+		Status:  status,
+		Code:    code,
+		Message: message,
+	}
+}
+
+// Error implements the error interface
+func (e *Error) Error() string {
+	return string(e.Code) + ": " + e.Message
+}
+
+// WithDetail returns a copy of the error with an additional detail
+func (e *Error) WithDetail(key string, value any) *Error {
+	cp := *e
+
+	cp.Details = map[string]any{}
+	for k, v := range e.Details {
+		cp.Details[k] = v
+	}
+
+	cp.Details[key] = value
+
+	return &cp
+}
+
+// BadRequest returns an error for a request which could not be understood
+func BadRequest(err error) *Error {
+	return ErrBadRequest.WithDetail("reason", err.Error())
+}
+
+// Forbidden returns an error for a request which is not allowed by a policy
+func Forbidden(err error) *Error {
+	return NewError(http.StatusForbidden, CodePolicyDenied, err.Error())
+}
+
+// NotFound returns an error for a resource which does not exist
+func NotFound(err error) *Error {
+	return NewError(http.StatusNotFound, CodeNotFound, err.Error())
+}
+
+// FromError returns the error response matching an error, errors from the chain are classified by their cause
+func FromError(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusTooManyRequests {
+		return rateLimited()
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		e := NewError(http.StatusServiceUnavailable, CodeUnavailable, "the chain did not respond in time")
+		e.Retryable = true
+		return e
+	}
+
+	msg := strings.ToLower(err.Error())
+
+	switch {
+	case strings.Contains(msg, "execution reverted"), strings.Contains(msg, "reverted"):
+		e := NewError(http.StatusUnprocessableEntity, CodeReverted, err.Error())
+
+		var dataErr rpc.DataError
+		if errors.As(err, &dataErr) && dataErr.ErrorData() != nil {
+			e = e.WithDetail("data", dataErr.ErrorData())
+		}
+
+		return e
+	case strings.Contains(msg, "nonce too low"),
+		strings.Contains(msg, "nonce too high"),
+		strings.Contains(msg, "replacement transaction underpriced"),
+		strings.Contains(msg, "already known"):
+		e := NewError(http.StatusConflict, CodeNonceConflict, err.Error())
+		e.Retryable = true
+		return e
+	case strings.Contains(msg, "rate limit"), strings.Contains(msg, "too many requests"):
+		return rateLimited()
+	}
+
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) {
+		return ErrInternal.WithDetail("rpc", rpcErr.ErrorCode())
+	}
+
+	return ErrInternal
+}
+
+// rateLimited returns an error for a request which was rate limited
+func rateLimited() *Error {
+	e := NewError(http.StatusTooManyRequests, CodeRateLimited, "too many requests")
+	e.Retryable = true
+	return e
+}
+
+// RateLimited returns an error for a request which was rate limited by the station and can be retried after a delay
+func RateLimited(retryAfter time.Duration) *Error {
+	return rateLimited().WithDetail("retry_after", int(math.Ceil(retryAfter.Seconds())))
+}
+
+// WriteError writes an error response in plain json
+func WriteError(w http.ResponseWriter, err error) {
+	e := FromError(err)
+
+	b, merr := json.Marshal(&Response{
+		ResponseType: ResponseTypeError,
+		Error:        e,
+	})
+	if merr != nil {
+		w.WriteHeader(e.Status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.Status)
+	w.Write(b)
+}
+
+// Error writes an error response, encrypted for the public key in the context when the request carried one.
+// The encrypted data is the error response which WriteError would write. Internal errors are logged with the request.
+func (r *Responder) Error(w http.ResponseWriter, ctx context.Context, err error) {
+	e := FromError(err)
+
+	if e.Status >= http.StatusInternalServerError {
+		logger.From(ctx).Error("request failed", err, "code", e.Code)
+	}
+
+	if _, ok := cw.GetPubKeyFromContext(ctx); !ok {
+		WriteError(w, err)
+		return
+	}
+
+	resp, rerr := r.EncryptedResponse(ctx, &Response{
+		ResponseType: ResponseTypeError,
+		Error:        e,
+	})
+	if rerr != nil {
+		WriteError(w, err)
+		return
+	}
+
+	sig := resp.Signature
+	resp.Signature = ""
+
+	b, merr := json.Marshal(resp)
+	if merr != nil {
+		w.WriteHeader(e.Status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(cw.SignatureHeader, sig)
+	w.Header().Set(cw.PubKeyHeader, r.supply.PubHexKey)
+	w.WriteHeader(e.Status)
+	w.Write(b)
+}
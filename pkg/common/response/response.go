@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/daobrussels/cw/pkg/common/request"
@@ -26,8 +27,26 @@ type AddressResponse struct {
 type Response struct {
 	ResponseType ResponseType `json:"response_type"`
 	Secure       string       `json:"secure,omitempty"`
+	Signature    string       `json:"signature,omitempty"` // signature of a secure response which is not sent with headers
 	Object       any          `json:"object,omitempty"`
 	Objects      any          `json:"objects,omitempty"`
+	Page         *Page        `json:"page,omitempty"`
+	Error        *Error       `json:"error,omitempty"`
+}
+
+// Page describes the position of a list response in the full list
+type Page struct {
+	Cursor string `json:"cursor,omitempty"` // position to request the next page from, empty on the last page
+	Limit  int    `json:"limit"`            // maximum number of objects in a page
+	Total  int    `json:"total,omitempty"`  // number of objects in the full list, omitted when it is not known
+}
+
+// FullPage returns the page of a list which is returned in full
+func FullPage(n int) *Page {
+	return &Page{
+		Limit: n,
+		Total: n,
+	}
 }
 
 type Responder struct {
@@ -59,74 +78,156 @@ func (r *Responder) Body(w http.ResponseWriter, body any) error {
 
 func (r *Responder) EncryptedBody(w http.ResponseWriter, ctx context.Context, body any) error {
 
+	resp, err := r.EncryptedResponse(ctx, body)
+	if err != nil {
+		return err
+	}
+
+	sig := resp.Signature
+	resp.Signature = ""
+
+	bresp, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Add(cw.SignatureHeader, sig)
+	w.Header().Add(cw.PubKeyHeader, r.supply.PubHexKey)
+	w.Write(bresp)
+
+	return nil
+}
+
+// PublicBody writes the body of a public route, encrypted for the public key in the context when the client sent one.
+// Clients which did not send a public key receive it in the clear, along with the public key of the station.
+func (r *Responder) PublicBody(w http.ResponseWriter, ctx context.Context, body any) error {
+	_, ok := cw.GetPubKeyFromContext(ctx)
+	if ok {
+		return r.EncryptedBody(w, ctx, body)
+	}
+
+	w.Header().Add(cw.PubKeyHeader, r.supply.PubHexKey)
+
+	return r.Body(w, body)
+}
+
+// EncryptedResponse encrypts a body for the public key in the context, the signature is carried by the response
+func (r *Responder) EncryptedResponse(ctx context.Context, body any) (*Response, error) {
+
 	pubhexkey, ok := cw.GetPubKeyFromContext(ctx)
 	if !ok {
-		return errors.New("unable to parse public key from context")
+		return nil, errors.New("unable to parse public key from context")
 	}
 
 	b, err := json.Marshal(body)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	req := request.New(r.supply.Address, b)
 
 	sig, err := req.GenerateSignature(r.supply.PrivateHexKey)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	secure, err := req.Encrypt(pubhexkey)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	bresp, err := json.Marshal(&Response{
+	return &Response{
 		ResponseType: ResponseTypeSecure,
 		Secure:       secure,
+		Signature:    sig,
+	}, nil
+}
+
+// BodyMultiple writes a list of objects along with its page
+func (r *Responder) BodyMultiple(w http.ResponseWriter, body any, page *Page) error {
+
+	w.Header().Add("Content-Type", "application/json")
+
+	b, err := json.Marshal(&Response{
+		ResponseType: ResponseTypeArray,
+		Objects:      body,
+		Page:         page,
 	})
 	if err != nil {
 		return err
 	}
 
-	w.Header().Add("Content-Type", "application/json")
-	w.Header().Add(cw.SignatureHeader, sig)
-	w.Header().Add(cw.PubKeyHeader, r.supply.PubHexKey)
-	w.Write(bresp)
+	w.Write(b)
 
 	return nil
 }
 
-// func BodyMultiple(w http.ResponseWriter, body any) error {
+// EncryptedBodyMultiple writes a list of objects along with its page, encrypted for the public key in the context.
+// The encrypted data is the array response which BodyMultiple would write.
+func (r *Responder) EncryptedBodyMultiple(w http.ResponseWriter, ctx context.Context, body any, page *Page) error {
+	return r.EncryptedBody(w, ctx, &Response{
+		ResponseType: ResponseTypeArray,
+		Objects:      body,
+		Page:         page,
+	})
+}
+
+// EventStream writes server-sent events
+type EventStream struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+// StreamedBody starts a text/event-stream response
+func StreamedBody(w http.ResponseWriter) (*EventStream, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, errors.New("streaming not supported")
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	flusher.Flush()
 
-// 	w.Header().Add("ContentType", "application/json")
+	return &EventStream{w, flusher}, nil
+}
 
-// 	b, err := json.Marshal(&Response{
-// 		ResponseType: ResponseTypeArray,
-// 		Objects:      body,
-// 	})
-// 	if err != nil {
-// 		return err
-// 	}
+// Send writes an event with its id so that clients can resume after it, events without an id keep the last one
+func (s *EventStream) Send(id, event string, body any) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
 
-// 	w.Write(b)
+	if id != "" {
+		_, err = fmt.Fprintf(s.w, "id: %s\n", id)
+		if err != nil {
+			return err
+		}
+	}
 
-// 	return nil
-// }
+	_, err = fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, b)
+	if err != nil {
+		return err
+	}
 
-// func StreamedBody(w http.ResponseWriter, body string) error {
-// 	flusher, ok := w.(http.Flusher)
-// 	if !ok {
-// 		return errors.New("stearming not supported")
-// 	}
+	s.flusher.Flush()
 
-// 	w.Header().Set("Content-Type", "text/event-stream")
-// 	w.Header().Set("Cache-Control", "no-cache")
-// 	w.Header().Set("Connection", "keep-alive")
-// 	w.Header().Set("Access-Control-Allow-Origin", "*")
+	return nil
+}
+
+// KeepAlive writes a comment to keep idle connections open
+func (s *EventStream) KeepAlive() error {
+	_, err := fmt.Fprint(s.w, ": keep-alive\n\n")
+	if err != nil {
+		return err
+	}
 
-// 	fmt.Fprintf(w, "%s", body)
-// 	flusher.Flush()
+	s.flusher.Flush()
 
-// 	return nil
-// }
+	return nil
+}
@@ -1,6 +1,7 @@
 package transaction
 
 import (
+	"context"
 	"fmt"
 	"math/big"
 
@@ -25,10 +26,16 @@ func New(chain *cw.ChainConfig, s *supply.Supply, ethservice *ethrequest.EthServ
 	}
 }
 
-func (s *Service) Send(to string, amount int64) error {
+// Send sends native tokens from the supply wallet, unless the station is paused
+func (s *Service) Send(ctx context.Context, to string, amount int64) error {
+	err := s.ethservice.Breaker.Check()
+	if err != nil {
+		return err
+	}
+
 	address := common.HexToAddress(to)
 
-	gas, err := s.ethservice.EstimateGas(s.supply.Address, to, uint64(amount))
+	gas, err := s.ethservice.EstimateGas(ctx, s.supply.Address, to, uint64(amount))
 	if err != nil {
 		return err
 	}
@@ -55,12 +62,18 @@ func (s *Service) Send(to string, amount int64) error {
 
 	paddedTx := fmt.Sprintf("0x%s", common.Bytes2Hex(btx))
 
-	_, err = s.ethservice.SendRawTransaction(paddedTx)
+	_, err = s.ethservice.SendRawTransaction(ctx, paddedTx)
 
 	return err
 }
 
-func (s *Service) Forward(tx string) error {
+// Forward sends a transaction signed by a client, unless the station is paused
+func (s *Service) Forward(ctx context.Context, tx string) error {
+	err := s.ethservice.Breaker.Check()
+	if err != nil {
+		return err
+	}
+
 	ethservice, err := ethrequest.NewEthService(s.chain.RPC[0])
 	if err != nil {
 		return err
@@ -69,7 +82,7 @@ func (s *Service) Forward(tx string) error {
 
 	paddedTx := fmt.Sprintf("0x%s", tx)
 
-	_, err = ethservice.SendRawTransaction(paddedTx)
+	_, err = ethservice.SendRawTransaction(ctx, paddedTx)
 
 	return err
 }
@@ -0,0 +1,131 @@
+package community
+
+import (
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	// activityBuffer is how many transactions a subscriber can fall behind before it is dropped
+	activityBuffer = 64
+
+	// maxActivityReplay is the maximum number of missed transactions replayed when resuming
+	maxActivityReplay = 1000
+)
+
+// Subscription delivers the transactions of an account as they are indexed.
+// C is closed when the subscriber falls behind, it should resume from the last transaction received.
+type Subscription struct {
+	C       <-chan Transaction
+	account common.Address
+	ch      chan Transaction
+	hub     *activityHub
+}
+
+// Close stops the delivery of transactions
+func (s *Subscription) Close() {
+	s.hub.unsubscribe(s)
+}
+
+// activityHub fans out indexed transactions to the subscribers of their accounts
+type activityHub struct {
+	mu   sync.Mutex
+	subs map[common.Address]map[*Subscription]struct{}
+}
+
+// newActivityHub instantiates a hub without subscribers
+func newActivityHub() *activityHub {
+	return &activityHub{
+		subs: map[common.Address]map[*Subscription]struct{}{},
+	}
+}
+
+// subscribe adds a subscriber for the transactions of an account
+func (h *activityHub) subscribe(account common.Address) *Subscription {
+	ch := make(chan Transaction, activityBuffer)
+
+	s := &Subscription{
+		C:       ch,
+		account: account,
+		ch:      ch,
+		hub:     h,
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.subs[account] == nil {
+		h.subs[account] = map[*Subscription]struct{}{}
+	}
+
+	h.subs[account][s] = struct{}{}
+
+	return s
+}
+
+// unsubscribe removes a subscriber and closes its channel
+func (h *activityHub) unsubscribe(s *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.remove(s)
+}
+
+// remove removes a subscriber, must be called with the lock held
+func (h *activityHub) remove(s *Subscription) {
+	subs, ok := h.subs[s.account]
+	if !ok {
+		return
+	}
+
+	if _, ok := subs[s]; !ok {
+		return
+	}
+
+	delete(subs, s)
+	close(s.ch)
+
+	if len(subs) == 0 {
+		delete(h.subs, s.account)
+	}
+}
+
+// publish delivers transactions to the subscribers of their accounts, slow subscribers are dropped
+func (h *activityHub) publish(txs []Transaction) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, tx := range txs {
+		for s := range h.subs[tx.Account] {
+			select {
+			case s.ch <- tx:
+			default:
+				h.remove(s)
+			}
+		}
+	}
+}
+
+// Subscribe delivers the transactions of an account as they are indexed.
+// When a cursor is provided, the transactions indexed after it are delivered first.
+func (c *Community) Subscribe(account common.Address, cursor string) (*Subscription, []Transaction, error) {
+	if c.Index == nil {
+		return nil, nil, ErrNotIndexed
+	}
+
+	// subscribe before replaying so that nothing is missed in between
+	s := c.activity.subscribe(account)
+
+	if cursor == "" {
+		return s, []Transaction{}, nil
+	}
+
+	missed, err := c.Index.After(account, cursor, maxActivityReplay)
+	if err != nil {
+		s.Close()
+		return nil, nil, err
+	}
+
+	return s, missed, nil
+}
@@ -0,0 +1,293 @@
+package community
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/daobrussels/cw/pkg/events"
+	"github.com/daobrussels/smartcontracts/pkg/contracts/gateway"
+	"github.com/daobrussels/smartcontracts/pkg/contracts/gratitude"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	// DefaultBalanceTTL is how long the balances of an account are cached
+	DefaultBalanceTTL = 30 * time.Second
+)
+
+// TokenBalance is the balance of an account in a token, the native currency has no token address
+type TokenBalance struct {
+	Token     *common.Address `json:"token,omitempty"`
+	Name      string          `json:"name"`
+	Symbol    string          `json:"symbol"`
+	Decimals  int             `json:"decimals"`
+	Balance   string          `json:"balance"`   // amount in the smallest unit
+	Formatted string          `json:"formatted"` // amount with decimals applied
+}
+
+// Balances are the balances of an account in the native currency, the community token and gratitude tokens
+type Balances struct {
+	Account   common.Address `json:"account"`
+	Native    TokenBalance   `json:"native"`
+	Token     *TokenBalance  `json:"token,omitempty"`
+	Gratitude []TokenBalance `json:"gratitude"`
+	UpdatedAt time.Time      `json:"updatedAt"`
+}
+
+// tokenMeta is the metadata of an erc20 token, which does not change
+type tokenMeta struct {
+	Name     string
+	Symbol   string
+	Decimals int
+}
+
+// balanceCache keeps the balances of accounts until they expire or a transfer involving them is seen
+type balanceCache struct {
+	mu       sync.Mutex
+	balances map[common.Address]*Balances
+	meta     map[common.Address]tokenMeta
+}
+
+// newBalanceCache instantiates an empty balance cache
+func newBalanceCache() *balanceCache {
+	return &balanceCache{
+		balances: map[common.Address]*Balances{},
+		meta:     map[common.Address]tokenMeta{},
+	}
+}
+
+// get returns the cached balances of an account if they are more recent than the ttl
+func (bc *balanceCache) get(account common.Address, ttl time.Duration) (*Balances, bool) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	b, ok := bc.balances[account]
+	if !ok || time.Since(b.UpdatedAt) > ttl {
+		return nil, false
+	}
+
+	return b, true
+}
+
+// put caches the balances of an account
+func (bc *balanceCache) put(b *Balances) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	bc.balances[b.Account] = b
+}
+
+// invalidate removes the cached balances of accounts
+func (bc *balanceCache) invalidate(accounts ...common.Address) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	for _, a := range accounts {
+		delete(bc.balances, a)
+	}
+}
+
+// Balances returns the balances of an account, served from cache while they are fresh
+func (c *Community) Balances(ctx context.Context, account common.Address) (*Balances, error) {
+	if b, ok := c.balances.get(account, c.BalanceTTL); ok {
+		return b, nil
+	}
+
+	native, err := c.es.BalanceAt(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+
+	cur := c.Chain.NativeCurrency
+
+	b := &Balances{
+		Account: account,
+		Native: TokenBalance{
+			Name:      cur.Name,
+			Symbol:    cur.Symbol,
+			Decimals:  cur.Decimals,
+			Balance:   native.String(),
+			Formatted: FormatUnits(native, cur.Decimals),
+		},
+		Gratitude: []TokenBalance{},
+		UpdatedAt: time.Now(),
+	}
+
+	if c.Token != (common.Address{}) {
+		tb, err := c.tokenBalance(ctx, c.Token, account)
+		if err != nil {
+			return nil, err
+		}
+
+		b.Token = tb
+	}
+
+	// the gratitude apps of a community deployed without a manifest cannot be searched
+	gratitudes, err := c.GratitudeBalances(ctx, account)
+	if err != nil && err != ErrUnknownDeployBlock {
+		return nil, err
+	}
+
+	for _, g := range gratitudes {
+		amount, _ := new(big.Int).SetString(g.Balance, 10)
+
+		tb, err := c.formatBalance(ctx, g.App, amount)
+		if err != nil {
+			return nil, err
+		}
+
+		b.Gratitude = append(b.Gratitude, *tb)
+	}
+
+	c.balances.put(b)
+
+	return b, nil
+}
+
+// tokenBalance returns the balance of an account in an erc20 token
+func (c *Community) tokenBalance(ctx context.Context, token, account common.Address) (*TokenBalance, error) {
+	// gratitude tokens are erc20 tokens, their binding reads any erc20 token
+	t, err := gratitude.NewGratitude(token, c.es.Client())
+	if err != nil {
+		return nil, err
+	}
+
+	amount, err := t.BalanceOf(&bind.CallOpts{Context: ctx}, account)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.formatBalance(ctx, token, amount)
+}
+
+// formatBalance formats an amount of an erc20 token using its metadata
+func (c *Community) formatBalance(ctx context.Context, token common.Address, amount *big.Int) (*TokenBalance, error) {
+	meta, err := c.tokenMeta(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenBalance{
+		Token:     &token,
+		Name:      meta.Name,
+		Symbol:    meta.Symbol,
+		Decimals:  meta.Decimals,
+		Balance:   amount.String(),
+		Formatted: FormatUnits(amount, meta.Decimals),
+	}, nil
+}
+
+// tokenMeta returns the metadata of an erc20 token, read once from the chain
+func (c *Community) tokenMeta(ctx context.Context, token common.Address) (tokenMeta, error) {
+	c.balances.mu.Lock()
+	meta, ok := c.balances.meta[token]
+	c.balances.mu.Unlock()
+
+	if ok {
+		return meta, nil
+	}
+
+	t, err := gratitude.NewGratitude(token, c.es.Client())
+	if err != nil {
+		return meta, err
+	}
+
+	meta.Name, err = t.Name(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return meta, err
+	}
+
+	meta.Symbol, err = t.Symbol(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return meta, err
+	}
+
+	decimals, err := t.Decimals(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return meta, err
+	}
+
+	meta.Decimals = int(decimals)
+
+	c.balances.mu.Lock()
+	c.balances.meta[token] = meta
+	c.balances.mu.Unlock()
+
+	return meta, nil
+}
+
+// invalidateBalances drops the cached balances of the accounts involved in the transfers and user operations of a batch
+func (c *Community) invalidateBalances(b events.Batch) error {
+	logs := make([]*types.Log, len(b.Logs))
+	for i := range b.Logs {
+		logs[i] = &b.Logs[i].Log
+	}
+
+	return c.invalidateLogs(logs)
+}
+
+// invalidateLogs drops the cached balances of the accounts involved in transfers and user operations
+func (c *Community) invalidateLogs(logs []*types.Log) error {
+	gabi, err := gateway.GatewayMetaData.GetAbi()
+	if err != nil {
+		return err
+	}
+
+	opEvent := gabi.Events["UserOperationEvent"].ID
+
+	for _, l := range logs {
+		if len(l.Topics) < 3 {
+			continue
+		}
+
+		switch l.Topics[0] {
+		case transferTopic:
+			c.balances.invalidate(common.BytesToAddress(l.Topics[1].Bytes()), common.BytesToAddress(l.Topics[2].Bytes()))
+		case opEvent:
+			// the sender is the second indexed field of the user operation event
+			c.balances.invalidate(common.BytesToAddress(l.Topics[2].Bytes()))
+		}
+	}
+
+	return nil
+}
+
+// FormatUnits formats an amount in the smallest unit of a currency with its decimals, trailing zeros are dropped
+func FormatUnits(amount *big.Int, decimals int) string {
+	if amount == nil {
+		return "0"
+	}
+
+	if decimals <= 0 {
+		return amount.String()
+	}
+
+	abs := new(big.Int).Abs(amount)
+	unit := pow10(decimals)
+
+	whole, frac := new(big.Int).QuoRem(abs, unit, new(big.Int))
+
+	s := whole.String()
+	if frac.Sign() != 0 {
+		digits := frac.String()
+		digits = strings.Repeat("0", decimals-len(digits)) + digits
+
+		s += "." + strings.TrimRight(digits, "0")
+	}
+
+	if amount.Sign() < 0 {
+		s = "-" + s
+	}
+
+	return s
+}
+
+// pow10 returns 10^n
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
@@ -0,0 +1,236 @@
+package community
+
+import (
+	"context"
+	"errors"
+	"math/big"
+
+	"github.com/daobrussels/smartcontracts/pkg/contracts/account"
+	"github.com/daobrussels/smartcontracts/pkg/contracts/gateway"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+var (
+	ErrNoCalls    = errors.New("no calls to execute")
+	ErrBatchValue = errors.New("batched calls cannot transfer value")
+)
+
+// Call is a single call made by an account
+type Call struct {
+	To    common.Address `json:"to"`
+	Value *hexutil.Big   `json:"value,omitempty"`
+	Data  hexutil.Bytes  `json:"data"`
+}
+
+// CallResult is a call made by an account, with the logs its target emitted.
+// Logs are nil when they cannot be attributed to the call, because another call of the batch has the same target
+// and the call is not an erc20 transfer with a matching Transfer log.
+type CallResult struct {
+	To   common.Address `json:"to"`
+	Logs []*types.Log   `json:"logs"`
+}
+
+// OpResult is the outcome of a user operation once it has been mined.
+// The calls of a batch succeed or revert together, success is only reported for the whole operation.
+type OpResult struct {
+	TxHash       common.Hash   `json:"txHash"`
+	UserOpHash   common.Hash   `json:"userOpHash"`
+	Success      bool          `json:"success"`
+	RevertReason hexutil.Bytes `json:"revertReason,omitempty"`
+	Logs         []*types.Log  `json:"logs,omitempty"` // emitted while executing the operation
+	Calls        []CallResult  `json:"calls,omitempty"`
+}
+
+// CallData returns the call data for an account to make the calls, several calls are encoded as a single executeBatch.
+// The account batch execution does not forward value, only a single call can transfer value.
+func CallData(calls []Call) ([]byte, error) {
+	if len(calls) == 0 {
+		return nil, ErrNoCalls
+	}
+
+	if len(calls) == 1 {
+		return ExecuteCallData(calls[0].To, toBig(calls[0].Value), calls[0].Data)
+	}
+
+	dest := make([]common.Address, len(calls))
+	data := make([][]byte, len(calls))
+	for i, call := range calls {
+		if toBig(call.Value).Sign() != 0 {
+			return nil, ErrBatchValue
+		}
+
+		dest[i] = call.To
+		data[i] = call.Data
+	}
+
+	abi, err := account.AccountMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+
+	return abi.Pack("executeBatch", dest, data)
+}
+
+// SubmitCalls submits an operation for an account to make the calls and waits for it to be mined
+func (c *Community) SubmitCalls(ctx context.Context, sender common.Address, calls []Call) (*OpResult, error) {
+	data, err := CallData(calls)
+	if err != nil {
+		return nil, err
+	}
+
+	op, tx, err := c.submitOp(ctx, sender, data)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := c.Gateway.GetUserOpHash(&bind.CallOpts{Context: ctx}, *op)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &OpResult{
+		TxHash:     tx.Hash(),
+		UserOpHash: hash,
+	}
+
+	if c.DryRun {
+		return result, nil
+	}
+
+	receipt, err := bind.WaitMined(ctx, c.es.Client(), tx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.opMined(receipt)
+
+	return c.decodeOpResult(result, receipt, calls)
+}
+
+// decodeOpResult fills in the result of an operation from the receipt of the transaction which carried it
+func (c *Community) decodeOpResult(result *OpResult, receipt *types.Receipt, calls []Call) (*OpResult, error) {
+	gabi, err := gateway.GatewayMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+
+	before := gabi.Events["BeforeExecution"].ID
+	opEvent := gabi.Events["UserOperationEvent"].ID
+	revertEvent := gabi.Events["UserOperationRevertReason"].ID
+
+	logs := []*types.Log{}
+	executing := false
+	for _, l := range receipt.Logs {
+		if l.Address == c.EntryPoint && len(l.Topics) > 0 {
+			switch l.Topics[0] {
+			case before:
+				executing = true
+				continue
+			case revertEvent:
+				ev, err := c.Gateway.ParseUserOperationRevertReason(*l)
+				if err == nil && ev.UserOpHash == result.UserOpHash {
+					result.RevertReason = ev.RevertReason
+				}
+				continue
+			case opEvent:
+				ev, err := c.Gateway.ParseUserOperationEvent(*l)
+				if err == nil && ev.UserOpHash == result.UserOpHash {
+					result.Success = ev.Success
+				}
+				executing = false
+				continue
+			}
+		}
+
+		if executing {
+			logs = append(logs, l)
+		}
+	}
+
+	result.Logs = logs
+	result.Calls = attributeLogs(calls, logs)
+
+	return result, nil
+}
+
+// opSucceeded reports whether the operation with the hash was executed successfully in the transaction of the receipt
+func (c *Community) opSucceeded(receipt *types.Receipt, hash common.Hash) bool {
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return false
+	}
+
+	for _, l := range receipt.Logs {
+		if l.Address != c.EntryPoint {
+			continue
+		}
+
+		ev, err := c.Gateway.ParseUserOperationEvent(*l)
+		if err == nil && ev.UserOpHash == hash {
+			return ev.Success
+		}
+	}
+
+	return false
+}
+
+// attributeLogs gives every call the logs emitted by its target. Calls sharing a target are told apart when they are
+// erc20 transfers, each gets the Transfer log with its recipient and amount, other calls sharing a target get no logs.
+func attributeLogs(calls []Call, logs []*types.Log) []CallResult {
+	targets := map[common.Address]int{}
+	for _, call := range calls {
+		targets[call.To]++
+	}
+
+	claimed := map[*types.Log]bool{}
+
+	results := make([]CallResult, len(calls))
+	for i, call := range calls {
+		results[i].To = call.To
+
+		if targets[call.To] > 1 {
+			l := transferLog(call, logs, claimed)
+			if l != nil {
+				results[i].Logs = []*types.Log{l}
+			}
+
+			continue
+		}
+
+		results[i].Logs = []*types.Log{}
+		for _, l := range logs {
+			if l.Address == call.To {
+				results[i].Logs = append(results[i].Logs, l)
+			}
+		}
+	}
+
+	return results
+}
+
+// transferLog claims the first Transfer log of the token which matches the recipient and amount of a transfer call,
+// it returns nil when the call is not a transfer or no log matches
+func transferLog(call Call, logs []*types.Log, claimed map[*types.Log]bool) *types.Log {
+	to, amount, ok := decodeTransfer(call.Data)
+	if !ok {
+		return nil
+	}
+
+	for _, l := range logs {
+		if claimed[l] || l.Address != call.To || len(l.Topics) != 3 || l.Topics[0] != transferTopic {
+			continue
+		}
+
+		if common.BytesToAddress(l.Topics[2].Bytes()) != to || new(big.Int).SetBytes(l.Data).Cmp(amount) != 0 {
+			continue
+		}
+
+		claimed[l] = true
+
+		return l
+	}
+
+	return nil
+}
@@ -1,11 +1,16 @@
 package community
 
 import (
+	"context"
 	"crypto/ecdsa"
+	"errors"
 	"math/big"
+	"time"
 
+	"github.com/daobrussels/cw/pkg/breaker"
 	"github.com/daobrussels/cw/pkg/common/ethrequest"
 	"github.com/daobrussels/cw/pkg/cw"
+	"github.com/daobrussels/cw/pkg/events"
 	"github.com/daobrussels/smartcontracts/pkg/contracts/accfactory"
 	"github.com/daobrussels/smartcontracts/pkg/contracts/account"
 	"github.com/daobrussels/smartcontracts/pkg/contracts/gateway"
@@ -15,15 +20,28 @@ import (
 	"github.com/daobrussels/smartcontracts/pkg/contracts/profile"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	// OpWatchTimeout is how long the station waits for an operation it submitted to be mined
+	OpWatchTimeout = 10 * time.Minute
 )
 
 type CommunityAddress struct {
-	Gateway          common.Address `json:"gateway"`
-	Paymaster        common.Address `json:"paymaster"`
-	AccountFactory   common.Address `json:"accountFactory"`
-	GratitudeFactory common.Address `json:"gratitudeFactory"`
-	ProfileFactory   common.Address `json:"profileFactory"`
-	Chain            cw.ChainConfig `json:"chain"`
+	Gateway            common.Address        `json:"gateway"`
+	Paymaster          common.Address        `json:"paymaster"`
+	AccountFactory     common.Address        `json:"accountFactory"`
+	GratitudeFactory   common.Address        `json:"gratitudeFactory"`
+	ProfileFactory     common.Address        `json:"profileFactory"`
+	Token              common.Address        `json:"token,omitempty"` // erc20 token of the community
+	TokenPaymaster     *TokenPaymasterConfig `json:"tokenPaymaster,omitempty"`
+	VerifyingPaymaster common.Address        `json:"verifyingPaymaster,omitempty"` // paymaster which checks the sponsorships of the station
+	SessionKeys        bool                  `json:"sessionKeys,omitempty"`        // accounts validate the signatures of registered session keys
+	Chain              cw.ChainConfig        `json:"chain"`
+	Manifest           *Manifest             `json:"manifest,omitempty"`
 }
 
 type Community struct {
@@ -46,130 +64,356 @@ type Community struct {
 
 	prfaddr        common.Address
 	ProfileFactory *profactory.Profactory
+
+	// Token is the erc20 token of the community
+	Token common.Address
+
+	// TokenPaymaster is set when users pay for gas in community tokens
+	TokenPaymaster *TokenPaymasterConfig
+
+	// VerifyingPaymaster pays for the operations sponsored by the station, sponsorship is unavailable when it is not set
+	VerifyingPaymaster common.Address
+
+	// SponsorValidity is how long a signed sponsorship remains valid
+	SponsorValidity time.Duration
+
+	// SponsorLimits caps the gas of the operations the station sponsors
+	SponsorLimits SponsorLimits
+
+	// SponsorTargets are the contracts which sponsored operations can call besides the community token
+	SponsorTargets []common.Address
+
+	// SessionKeys is set when the accounts of the community accept operations signed by their registered session keys
+	SessionKeys bool
+
+	manifest *Manifest
+	progress func(CommunityAddress) error // saves the deployment in progress
+
+	// Recovery holds the guardians of the community accounts
+	Recovery *Recovery
+
+	// Sessions holds the session keys of the community accounts
+	Sessions *Sessions
+
+	// Controls holds the limits and pauses set by the operators of the station
+	Controls *Controls
+
+	// Breaker stops every transaction of the community while the station is paused, nil when it cannot be paused
+	Breaker *breaker.Breaker
+
+	// Events delivers the logs of the community contracts, nil until the contracts are bound
+	Events *events.Listener
+
+	// BalanceTTL is how long the balances of an account are cached
+	BalanceTTL time.Duration
+	balances   *balanceCache
+	gratitude  *gratitudeApps
+
+	// Index stores the transaction history of accounts, nil when the community is not indexed
+	Index    *Index
+	activity *activityHub
+
+	// DryRun estimates transactions instead of sending them
+	DryRun            bool
+	dryRunTxs         []*types.Transaction
+	dryRunUnestimated []UnestimatedTx
+}
+
+// UnestimatedTx is a transaction of a dry run whose gas cannot be estimated, since it depends on an earlier transaction
+type UnestimatedTx struct {
+	To     common.Address
+	Method string
+	Reason string
 }
 
 func (c *Community) ExportAddress() CommunityAddress {
 	return CommunityAddress{
-		Gateway:          c.EntryPoint,
-		Paymaster:        c.paddr,
-		AccountFactory:   c.afaddr,
-		GratitudeFactory: c.grfaddr,
-		ProfileFactory:   c.prfaddr,
-		Chain:            c.Chain,
+		Gateway:            c.EntryPoint,
+		Paymaster:          c.paddr,
+		AccountFactory:     c.afaddr,
+		GratitudeFactory:   c.grfaddr,
+		ProfileFactory:     c.prfaddr,
+		Token:              c.Token,
+		TokenPaymaster:     c.TokenPaymaster,
+		VerifyingPaymaster: c.VerifyingPaymaster,
+		SessionKeys:        c.SessionKeys,
+		Chain:              c.Chain,
+		Manifest:           c.manifest,
 	}
 }
 
+// EthService returns the service used to reach the chain of the community
+func (c *Community) EthService() *ethrequest.EthService {
+	return c.es
+}
+
 // New instantiates a community struct using the provided addresses for the contracts
 func New(es *ethrequest.EthService, key *ecdsa.PrivateKey, address common.Address, addr CommunityAddress) (*Community, error) {
-	// instantiate gateway contract
-	g, err := gateway.NewGateway(addr.Gateway, es.Client())
-	if err != nil {
-		return nil, err
+	if addr.TokenPaymaster != nil {
+		err := addr.TokenPaymaster.validate()
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	// instantiate paymaster contract
-	p, err := paymaster.NewPaymaster(addr.Paymaster, es.Client())
-	if err != nil {
-		return nil, err
+	c := Prepare(es, key, address, addr.Chain)
+	c.Token = addr.Token
+	c.TokenPaymaster = addr.TokenPaymaster
+	c.VerifyingPaymaster = addr.VerifyingPaymaster
+	c.SessionKeys = addr.SessionKeys
+	c.manifest = addr.Manifest
+
+	// communities configured before the token was recorded charge gas in it
+	if c.Token == (common.Address{}) && c.TokenPaymaster != nil {
+		c.Token = c.TokenPaymaster.Token
 	}
 
-	// instantiate account factory contract
-	acc, err := accfactory.NewAccfactory(addr.AccountFactory, es.Client())
-	if err != nil {
-		return nil, err
+	binds := []struct {
+		addr common.Address
+		bind func(common.Address) error
+	}{
+		{addr.Gateway, c.bindGateway},
+		{addr.Paymaster, c.bindPaymaster},
+		{addr.AccountFactory, c.bindAccountFactory},
+		{addr.GratitudeFactory, c.bindGratitudeFactory},
+		{addr.ProfileFactory, c.bindProfileFactory},
 	}
 
-	// instantiate gratitude factory contract
-	gr, err := grfactory.NewGrfactory(addr.GratitudeFactory, es.Client())
+	for _, b := range binds {
+		err := b.bind(b.addr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c.Events = events.NewListener(es, c.logQuery())
+	c.Events.Subscribe(c.trackGratitudeApps)
+	c.Events.Subscribe(c.invalidateBalances)
+
+	return c, nil
+}
+
+// Prepare instantiates a community struct without any contracts, use Resume to deploy them
+func Prepare(es *ethrequest.EthService, key *ecdsa.PrivateKey, address common.Address, chain cw.ChainConfig) *Community {
+	return &Community{
+		es:              es,
+		key:             key,
+		address:         address,
+		Chain:           chain,
+		SponsorValidity: DefaultSponsorValidity,
+		SponsorLimits:   DefaultSponsorLimits(),
+		Recovery:        newRecovery(""),
+		Sessions:        newSessions(""),
+		Controls:        newControls(""),
+		BalanceTTL:      DefaultBalanceTTL,
+		balances:        newBalanceCache(),
+		gratitude:       newGratitudeApps(),
+		activity:        newActivityHub(),
+	}
+}
+
+// Deploy instantiates a community struct and deploys the contracts
+func Deploy(ctx context.Context, es *ethrequest.EthService, key *ecdsa.PrivateKey, address common.Address, chain cw.ChainConfig) (*Community, error) {
+	c := Prepare(es, key, address, chain)
+
+	err := c.Resume(ctx, CommunityAddress{Chain: chain}, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	// instantiate profile factory contract
-	pro, err := profactory.NewProfactory(addr.ProfileFactory, es.Client())
+	return c, nil
+}
+
+// Resume deploys the contracts which are missing from a partially deployed community and binds the others.
+// The optional callback is called with the addresses once each deployment is sent and once it is mined, so that progress
+// can be saved. Deployments which were sent but not confirmed before are confirmed rather than sent again.
+func (c *Community) Resume(ctx context.Context, addr CommunityAddress, step func(CommunityAddress) error) error {
+	if addr.TokenPaymaster != nil {
+		err := addr.TokenPaymaster.validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	c.TokenPaymaster = addr.TokenPaymaster
+	c.VerifyingPaymaster = addr.VerifyingPaymaster
+	c.SessionKeys = addr.SessionKeys
+	c.manifest = addr.Manifest
+
+	if !c.DryRun {
+		c.progress = step
+		defer func() { c.progress = nil }()
+	}
+
+	steps := []struct {
+		name   string
+		addr   common.Address
+		bind   func(common.Address) error
+		deploy func(context.Context) error
+	}{
+		{ContractGateway, addr.Gateway, c.bindGateway, c.DeployGateway},
+		{ContractPaymaster, addr.Paymaster, c.bindPaymaster, c.DeployPaymaster},
+		{ContractAccountFactory, addr.AccountFactory, c.bindAccountFactory, c.DeployAccountFactory},
+		{ContractGratitudeFactory, addr.GratitudeFactory, c.bindGratitudeFactory, c.DeployGratitudeFactory},
+		{ContractProfileFactory, addr.ProfileFactory, c.bindProfileFactory, c.DeployProfileFactory},
+	}
+
+	for _, s := range steps {
+		if s.addr != (common.Address{}) {
+			err := s.bind(s.addr)
+			if err != nil {
+				return err
+			}
+
+			if !c.pending(s.name) {
+				continue
+			}
+
+			err = c.confirm(ctx, s.name)
+			if !errors.Is(err, ErrDeploymentReverted) {
+				if err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			// the contract was never created, it is deployed again
+			delete(c.manifest.Contracts, s.name)
+		}
+
+		err := s.deploy(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// bindGateway instantiates the gateway contract at the provided address
+func (c *Community) bindGateway(addr common.Address) error {
+	g, err := gateway.NewGateway(addr, c.es.Client())
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return &Community{
-		es:               es,
-		key:              key,
-		address:          address,
-		Chain:            addr.Chain,
-		EntryPoint:       addr.Gateway,
-		Gateway:          g,
-		paddr:            addr.Paymaster,
-		Paymaster:        p,
-		afaddr:           addr.AccountFactory,
-		AccountFactory:   acc,
-		grfaddr:          addr.GratitudeFactory,
-		GratitudeFactory: gr,
-		prfaddr:          addr.ProfileFactory,
-		ProfileFactory:   pro,
-	}, nil
+	c.EntryPoint = addr
+	c.Gateway = g
+
+	return nil
 }
 
-// Deploy instantiates a community struct and deploys the contracts
-func Deploy(es *ethrequest.EthService, key *ecdsa.PrivateKey, address common.Address, chain cw.ChainConfig) (*Community, error) {
-	c := &Community{
-		es:      es,
-		key:     key,
-		address: address,
-		Chain:   chain,
+// bindPaymaster instantiates the paymaster contract at the provided address
+func (c *Community) bindPaymaster(addr common.Address) error {
+	p, err := paymaster.NewPaymaster(addr, c.es.Client())
+	if err != nil {
+		return err
 	}
 
-	// instantiate gateway contract
-	err := c.DeployGateway()
+	c.paddr = addr
+	c.Paymaster = p
+
+	return nil
+}
+
+// bindAccountFactory instantiates the account factory contract at the provided address
+func (c *Community) bindAccountFactory(addr common.Address) error {
+	acc, err := accfactory.NewAccfactory(addr, c.es.Client())
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	// deploy paymaster contract
-	err = c.DeployPaymaster()
+	c.afaddr = addr
+	c.AccountFactory = acc
+
+	return nil
+}
+
+// bindGratitudeFactory instantiates the gratitude factory contract at the provided address
+func (c *Community) bindGratitudeFactory(addr common.Address) error {
+	gr, err := grfactory.NewGrfactory(addr, c.es.Client())
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	// deploy account factory contract
-	err = c.DeployAccountFactory()
+	c.grfaddr = addr
+	c.GratitudeFactory = gr
+
+	return nil
+}
+
+// bindProfileFactory instantiates the profile factory contract at the provided address
+func (c *Community) bindProfileFactory(addr common.Address) error {
+	pro, err := profactory.NewProfactory(addr, c.es.Client())
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	// deploy gratitude factory contract
-	err = c.DeployGratitudeFactory()
+	c.prfaddr = addr
+	c.ProfileFactory = pro
+
+	return nil
+}
+
+// NewTransactor returns a new transactor for the community, transactions are sent with the provided context.
+// In dry run mode transactions are signed and their gas estimated, but never sent.
+func (c *Community) NewTransactor(ctx context.Context) (*bind.TransactOpts, error) {
+	err := c.Breaker.Check()
 	if err != nil {
 		return nil, err
 	}
 
-	// deploy profile factory contract
-	err = c.DeployProfileFactory()
+	auth, err := bind.NewKeyedTransactorWithChainID(c.key, big.NewInt(int64(c.Chain.ChainID)))
 	if err != nil {
 		return nil, err
 	}
 
-	return c, nil
+	auth.Context = ctx
+
+	if c.DryRun {
+		auth.NoSend = true
+
+		signer := auth.Signer
+		auth.Signer = func(from common.Address, tx *types.Transaction) (*types.Transaction, error) {
+			signed, err := signer(from, tx)
+			if err != nil {
+				return nil, err
+			}
+
+			c.dryRunTxs = append(c.dryRunTxs, signed)
+
+			return signed, nil
+		}
+	}
+
+	return auth, nil
+}
+
+// DryRunTxs returns the transactions which would have been sent in dry run mode
+func (c *Community) DryRunTxs() []*types.Transaction {
+	return c.dryRunTxs
 }
 
-// NewTransactor returns a new transactor for the community
-func (c *Community) NewTransactor() (*bind.TransactOpts, error) {
-	return bind.NewKeyedTransactorWithChainID(c.key, big.NewInt(int64(c.Chain.ChainID)))
+// DryRunUnestimated returns the transactions which would have been sent in dry run mode without an estimate
+func (c *Community) DryRunUnestimated() []UnestimatedTx {
+	return c.dryRunUnestimated
 }
 
 // NextNonce returns the next nonce for the community
-func (c *Community) NextNonce() (uint64, error) {
-	return c.es.NextNonce(c.address.Hex())
+func (c *Community) NextNonce(ctx context.Context) (uint64, error) {
+	return c.es.NextNonce(ctx, c.address.Hex())
 }
 
 // DeployGateway deploys the gateway contract
-func (c *Community) DeployGateway() error {
-	auth, err := c.NewTransactor()
+func (c *Community) DeployGateway(ctx context.Context) error {
+	auth, err := c.NewTransactor(ctx)
 	if err != nil {
 		return err
 	}
 
 	// get the next nonce for the main wallet
-	nonce, err := c.NextNonce()
+	nonce, err := c.NextNonce(ctx)
 	if err != nil {
 		return err
 	}
@@ -178,7 +422,7 @@ func (c *Community) DeployGateway() error {
 	setDefaultParameters(auth, nonce)
 
 	// deploy the gateway contract
-	addr, _, g, err := gateway.DeployGateway(auth, c.es.Client())
+	addr, tx, g, err := gateway.DeployGateway(auth, c.es.Client())
 	if err != nil {
 		return err
 	}
@@ -186,18 +430,18 @@ func (c *Community) DeployGateway() error {
 	c.EntryPoint = addr
 	c.Gateway = g
 
-	return nil
+	return c.record(ctx, ContractGateway, addr, tx)
 }
 
 // DeployPaymaster deploys the paymaster contract
-func (c *Community) DeployPaymaster() error {
-	auth, err := c.NewTransactor()
+func (c *Community) DeployPaymaster(ctx context.Context) error {
+	auth, err := c.NewTransactor(ctx)
 	if err != nil {
 		return err
 	}
 
 	// get the next nonce for the main wallet
-	nonce, err := c.NextNonce()
+	nonce, err := c.NextNonce(ctx)
 	if err != nil {
 		return err
 	}
@@ -206,7 +450,7 @@ func (c *Community) DeployPaymaster() error {
 	setDefaultParameters(auth, nonce)
 
 	// deploy the paymaster contract
-	addr, _, p, err := paymaster.DeployPaymaster(auth, c.es.Client(), c.EntryPoint)
+	addr, tx, p, err := paymaster.DeployPaymaster(auth, c.es.Client(), c.EntryPoint)
 	if err != nil {
 		return err
 	}
@@ -214,18 +458,18 @@ func (c *Community) DeployPaymaster() error {
 	c.paddr = addr
 	c.Paymaster = p
 
-	return nil
+	return c.record(ctx, ContractPaymaster, addr, tx)
 }
 
 // FundPaymaster funds the paymaster contract
-func (c *Community) FundPaymaster(amount *big.Int) error {
-	auth, err := c.NewTransactor()
+func (c *Community) FundPaymaster(ctx context.Context, amount *big.Int) error {
+	auth, err := c.NewTransactor(ctx)
 	if err != nil {
 		return err
 	}
 
 	// get the next nonce for the main wallet
-	nonce, err := c.NextNonce()
+	nonce, err := c.NextNonce(ctx)
 	if err != nil {
 		return err
 	}
@@ -242,14 +486,14 @@ func (c *Community) FundPaymaster(amount *big.Int) error {
 }
 
 // DeployAccountFactory deploys the account factory contract
-func (c *Community) DeployAccountFactory() error {
-	auth, err := c.NewTransactor()
+func (c *Community) DeployAccountFactory(ctx context.Context) error {
+	auth, err := c.NewTransactor(ctx)
 	if err != nil {
 		return err
 	}
 
 	// get the next nonce for the main wallet
-	nonce, err := c.NextNonce()
+	nonce, err := c.NextNonce(ctx)
 	if err != nil {
 		return err
 	}
@@ -258,7 +502,7 @@ func (c *Community) DeployAccountFactory() error {
 	setDefaultParameters(auth, nonce)
 
 	// deploy the account factory contract
-	addr, _, acc, err := accfactory.DeployAccfactory(auth, c.es.Client(), c.EntryPoint)
+	addr, tx, acc, err := accfactory.DeployAccfactory(auth, c.es.Client(), c.EntryPoint)
 	if err != nil {
 		return err
 	}
@@ -266,18 +510,18 @@ func (c *Community) DeployAccountFactory() error {
 	c.afaddr = addr
 	c.AccountFactory = acc
 
-	return nil
+	return c.record(ctx, ContractAccountFactory, addr, tx)
 }
 
 // DeployGratitudeFactory deploys the gratitude factory contract
-func (c *Community) DeployGratitudeFactory() error {
-	auth, err := c.NewTransactor()
+func (c *Community) DeployGratitudeFactory(ctx context.Context) error {
+	auth, err := c.NewTransactor(ctx)
 	if err != nil {
 		return err
 	}
 
 	// get the next nonce for the main wallet
-	nonce, err := c.NextNonce()
+	nonce, err := c.NextNonce(ctx)
 	if err != nil {
 		return err
 	}
@@ -286,7 +530,7 @@ func (c *Community) DeployGratitudeFactory() error {
 	setDefaultParameters(auth, nonce)
 
 	// deploy the gratitude factory contract
-	addr, _, gr, err := grfactory.DeployGrfactory(auth, c.es.Client(), c.EntryPoint)
+	addr, tx, gr, err := grfactory.DeployGrfactory(auth, c.es.Client(), c.EntryPoint)
 	if err != nil {
 		return err
 	}
@@ -294,18 +538,18 @@ func (c *Community) DeployGratitudeFactory() error {
 	c.grfaddr = addr
 	c.GratitudeFactory = gr
 
-	return nil
+	return c.record(ctx, ContractGratitudeFactory, addr, tx)
 }
 
 // CreateGratitudeApp creates a gratitude app for the provided owner
-func (c *Community) CreateGratitudeApp(owner common.Address) (*common.Address, error) {
-	auth, err := c.NewTransactor()
+func (c *Community) CreateGratitudeApp(ctx context.Context, owner common.Address) (*common.Address, error) {
+	auth, err := c.NewTransactor(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	// get the next nonce for the main wallet
-	nonce, err := c.NextNonce()
+	nonce, err := c.NextNonce(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -319,7 +563,7 @@ func (c *Community) CreateGratitudeApp(owner common.Address) (*common.Address, e
 		return nil, err
 	}
 
-	addr, err := c.GratitudeFactory.GetGratitudeTokenAddress(&bind.CallOpts{}, owner, big.NewInt(int64(nonce)))
+	addr, err := c.GratitudeFactory.GetGratitudeTokenAddress(&bind.CallOpts{Context: ctx}, owner, big.NewInt(int64(nonce)))
 	if err != nil {
 		return nil, err
 	}
@@ -327,15 +571,23 @@ func (c *Community) CreateGratitudeApp(owner common.Address) (*common.Address, e
 	return &addr, nil
 }
 
-// CreateAccount creates an account for the provided owner
-func (c *Community) CreateAccount(owner common.Address) (*common.Address, error) {
-	auth, err := c.NewTransactor()
+// CreateAccount creates an account for the provided owner, an owner who already has one gets it back
+func (c *Community) CreateAccount(ctx context.Context, owner common.Address) (*common.Address, error) {
+	salt := AccountSalt(owner)
+
+	// the owner keeps the account created by the current or a replaced factory
+	addr, err := c.FindAccount(ctx, owner, salt)
+	if err != ErrAccountNotFound {
+		return addr, err
+	}
+
+	auth, err := c.NewTransactor(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	// get the next nonce for the main wallet
-	nonce, err := c.NextNonce()
+	nonce, err := c.NextNonce(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -343,28 +595,33 @@ func (c *Community) CreateAccount(owner common.Address) (*common.Address, error)
 	// set default parameters
 	setDefaultParameters(auth, nonce)
 
-	_, err = c.AccountFactory.CreateAccount(auth, owner, big.NewInt(int64(nonce)))
+	_, err = c.AccountFactory.CreateAccount(auth, owner, salt)
 	if err != nil {
 		return nil, err
 	}
 
-	addr, err := c.AccountFactory.GetAddress(&bind.CallOpts{}, owner, big.NewInt(int64(nonce)))
+	created, err := c.AccountFactory.GetAddress(&bind.CallOpts{Context: ctx}, owner, salt)
 	if err != nil {
 		return nil, err
 	}
 
-	return &addr, nil
+	return &created, nil
+}
+
+// AccountSalt returns the salt of the account of an owner, it is derived from the owner so that the account can be found again
+func AccountSalt(owner common.Address) *big.Int {
+	return new(big.Int).SetBytes(owner.Bytes())
 }
 
 // DeployProfileFactory deploys the profile factory contract
-func (c *Community) DeployProfileFactory() error {
-	auth, err := c.NewTransactor()
+func (c *Community) DeployProfileFactory(ctx context.Context) error {
+	auth, err := c.NewTransactor(ctx)
 	if err != nil {
 		return err
 	}
 
 	// get the next nonce for the main wallet
-	nonce, err := c.NextNonce()
+	nonce, err := c.NextNonce(ctx)
 	if err != nil {
 		return err
 	}
@@ -373,7 +630,7 @@ func (c *Community) DeployProfileFactory() error {
 	setDefaultParameters(auth, nonce)
 
 	// deploy profile factory contract
-	addr, _, pr, err := profactory.DeployProfactory(auth, c.es.Client(), c.EntryPoint)
+	addr, tx, pr, err := profactory.DeployProfactory(auth, c.es.Client(), c.EntryPoint)
 	if err != nil {
 		return err
 	}
@@ -381,18 +638,18 @@ func (c *Community) DeployProfileFactory() error {
 	c.prfaddr = addr
 	c.ProfileFactory = pr
 
-	return nil
+	return c.record(ctx, ContractProfileFactory, addr, tx)
 }
 
 // CreateProfile creates a profile for the provided owner
-func (c *Community) CreateProfile(owner common.Address) (*common.Address, error) {
-	auth, err := c.NewTransactor()
+func (c *Community) CreateProfile(ctx context.Context, owner common.Address) (*common.Address, error) {
+	auth, err := c.NewTransactor(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	// get the next nonce for the main wallet
-	nonce, err := c.NextNonce()
+	nonce, err := c.NextNonce(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -405,7 +662,7 @@ func (c *Community) CreateProfile(owner common.Address) (*common.Address, error)
 		return nil, err
 	}
 
-	addr, err := c.ProfileFactory.GetProfileAddress(&bind.CallOpts{}, owner, big.NewInt(int64(nonce)))
+	addr, err := c.ProfileFactory.GetProfileAddress(&bind.CallOpts{Context: ctx}, owner, big.NewInt(int64(nonce)))
 	if err != nil {
 		return nil, err
 	}
@@ -433,44 +690,150 @@ func (c *Community) GetAccount(owner common.Address) (*account.Account, error) {
 	return a, nil
 }
 
+// IsAccountOwner returns whether the provided owner owns the account
+func (c *Community) IsAccountOwner(ctx context.Context, owner, account common.Address) (bool, error) {
+	acc, err := c.GetAccount(account)
+	if err != nil {
+		return false, err
+	}
+
+	accowner, err := acc.Owner(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return false, err
+	}
+
+	return accowner == owner, nil
+}
+
 // SubmitOp submits an operation to the gateway for processing
-func (c *Community) SubmitOp(sender common.Address, data []byte) error {
-	auth, err := c.NewTransactor()
+func (c *Community) SubmitOp(ctx context.Context, sender common.Address, data []byte) error {
+	_, tx, err := c.submitOp(ctx, sender, data)
 	if err != nil {
 		return err
 	}
 
+	c.watchOp(tx)
+
+	return nil
+}
+
+// submitOp submits an operation to the gateway and returns it along with the transaction which carries it
+func (c *Community) submitOp(ctx context.Context, sender common.Address, data []byte) (*gateway.UserOperation, *types.Transaction, error) {
+	err := c.checkSponsorship(c.paymasterAndData())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	auth, err := c.NewTransactor(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	// get the next nonce for the main wallet
-	nonce, err := c.NextNonce()
+	nonce, err := c.NextNonce(ctx)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	// set default parameters
 	setDefaultParameters(auth, nonce)
 
-	senderNonce, err := c.es.NextNonce(sender.Hex())
+	senderNonce, err := c.es.NextNonce(ctx, sender.Hex())
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	// TODO: test and check UserOperation signature and required data
 	// This is still not tested and may not work
-	op := &gateway.UserOperation{
+	uop := UserOp{
 		Sender:           sender,
-		Nonce:            big.NewInt(int64(senderNonce)),
+		Nonce:            (*hexutil.Big)(new(big.Int).SetUint64(senderNonce)),
 		CallData:         data,
-		PaymasterAndData: c.paddr.Bytes(),
+		PaymasterAndData: c.paymasterAndData(),
 	}
 
-	_, err = c.Gateway.HandleOps(auth, []gateway.UserOperation{*op}, c.address)
+	// unset fields are zeroed so that the operation can be encoded
+	op := uop.Gateway()
+
+	tx, err := c.Gateway.HandleOps(auth, []gateway.UserOperation{op}, c.address)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &op, tx, nil
+}
+
+// SubmitUserOp submits an operation which was built and signed by the client to the gateway for processing
+func (c *Community) SubmitUserOp(ctx context.Context, op UserOp) error {
+	tx, err := c.submitUserOp(ctx, op)
 	if err != nil {
 		return err
 	}
 
+	c.watchOp(tx)
+
 	return nil
 }
 
+// submitUserOp submits an operation which was built and signed by the client and returns the transaction which carries it
+func (c *Community) submitUserOp(ctx context.Context, op UserOp) (*types.Transaction, error) {
+	err := c.checkSponsorship(op.PaymasterAndData)
+	if err != nil {
+		return nil, err
+	}
+
+	auth, err := c.NewTransactor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// get the next nonce for the main wallet
+	nonce, err := c.NextNonce(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// set default parameters
+	setDefaultParameters(auth, nonce)
+
+	return c.Gateway.HandleOps(auth, []gateway.UserOperation{op.Gateway()}, c.address)
+}
+
+// watchOp waits in the background for an operation submitted by the station to be mined, see opMined
+func (c *Community) watchOp(tx *types.Transaction) {
+	if c.DryRun {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), OpWatchTimeout)
+		defer cancel()
+
+		receipt, err := bind.WaitMined(ctx, c.es.Client(), tx)
+		if err != nil {
+			slog.Warn("unable to watch an operation", "tx", tx.Hash().Hex(), slog.ErrorKey, err)
+			return
+		}
+
+		c.opMined(receipt)
+	}()
+}
+
+// opMined handles the receipt of an operation submitted by the station as soon as it is mined, ahead of the listener
+// which waits for confirmations: the cached balances of the accounts it involved are dropped and its transactions are
+// published as pending to the activity streams
+func (c *Community) opMined(receipt *types.Receipt) {
+	err := c.invalidateLogs(receipt.Logs)
+	if err != nil {
+		slog.Error("unable to invalidate balances", err, "tx", receipt.TxHash.Hex())
+	}
+
+	err = c.publishPending(receipt)
+	if err != nil {
+		slog.Error("unable to publish pending activity", err, "tx", receipt.TxHash.Hex())
+	}
+}
+
 // setDefaultParameters sets the nonce, value and gas limit for a default contract transaction
 func setDefaultParameters(auth *bind.TransactOpts, nonce uint64) {
 	auth.Nonce = big.NewInt(int64(nonce))
@@ -0,0 +1,199 @@
+package community
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+
+	"github.com/daobrussels/cw/pkg/common/ethrequest"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var (
+	ErrSponsorshipPaused = errors.New("sponsorship is paused")
+	ErrMintLimit         = errors.New("mint exceeds the limits of the community")
+	ErrInvalidLimit      = errors.New("invalid limit")
+)
+
+// MintLimit caps a single gratitude mint, zero values are unlimited
+type MintLimit struct {
+	MaxRecipients int      `json:"maxRecipients"`
+	MaxAmount     *big.Int `json:"maxAmount,omitempty"` // total amount minted to all recipients
+}
+
+// Controls are set by the operators of the station at runtime.
+// When a path is provided the state is persisted to that file.
+type Controls struct {
+	mu                sync.RWMutex
+	path              string
+	MintLimit         MintLimit `json:"mintLimit"`
+	SponsorshipPaused bool      `json:"sponsorshipPaused"`
+}
+
+// NewControls instantiates the controls, loading them from the file at path if it exists
+func NewControls(path string) (*Controls, error) {
+	c := newControls(path)
+
+	if path == "" {
+		return c, nil
+	}
+
+	err := loadJSON(path, c)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// newControls instantiates controls without any limit
+func newControls(path string) *Controls {
+	return &Controls{
+		path: path,
+	}
+}
+
+// Mint returns the limit of a single gratitude mint
+func (c *Controls) Mint() MintLimit {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.MintLimit
+}
+
+// SetMint replaces the limit of a single gratitude mint
+func (c *Controls) SetMint(l MintLimit) error {
+	if l.MaxRecipients < 0 || (l.MaxAmount != nil && l.MaxAmount.Sign() < 0) {
+		return ErrInvalidLimit
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.MintLimit = l
+
+	return saveJSON(c.path, c)
+}
+
+// CheckMint returns ErrMintLimit when a mint to the recipients exceeds the limit
+func (c *Controls) CheckMint(amounts []*big.Int) error {
+	l := c.Mint()
+
+	if l.MaxRecipients > 0 && len(amounts) > l.MaxRecipients {
+		return ErrMintLimit
+	}
+
+	if l.MaxAmount == nil || l.MaxAmount.Sign() == 0 {
+		return nil
+	}
+
+	total := new(big.Int)
+	for _, a := range amounts {
+		total.Add(total, a)
+	}
+
+	if total.Cmp(l.MaxAmount) > 0 {
+		return ErrMintLimit
+	}
+
+	return nil
+}
+
+// Sponsoring returns whether the paymaster pays for operations
+func (c *Controls) Sponsoring() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return !c.SponsorshipPaused
+}
+
+// PauseSponsorship stops or resumes paying for operations with the paymaster
+func (c *Controls) PauseSponsorship(paused bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.SponsorshipPaused = paused
+
+	return saveJSON(c.path, c)
+}
+
+// checkSponsorship returns ErrSponsorshipPaused when an operation would be paid by one of the paymasters while sponsorship is paused
+func (c *Community) checkSponsorship(paymasterAndData []byte) error {
+	if c.Controls.Sponsoring() {
+		return nil
+	}
+
+	if len(paymasterAndData) < common.AddressLength {
+		return nil
+	}
+
+	paymaster := common.BytesToAddress(paymasterAndData[:common.AddressLength])
+	if paymaster == c.paddr || (paymaster == c.VerifyingPaymaster && paymaster != common.Address{}) {
+		return ErrSponsorshipPaused
+	}
+
+	return nil
+}
+
+// WithdrawPaymaster withdraws native tokens from the deposit of the paymaster in the gateway
+func (c *Community) WithdrawPaymaster(ctx context.Context, to common.Address, amount *big.Int) error {
+	auth, err := c.NewTransactor(ctx)
+	if err != nil {
+		return err
+	}
+
+	// get the next nonce for the main wallet
+	nonce, err := c.NextNonce(ctx)
+	if err != nil {
+		return err
+	}
+
+	// set default parameters
+	setDefaultParameters(auth, nonce)
+
+	_, err = c.Paymaster.WithdrawTo(auth, to, amount)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// TransferPaymaster hands the paymaster over to a new owner, such as the wallet of a rotated supply key.
+// The station can no longer sign sponsorships or withdraw the deposit until it is restarted with the key of the new owner.
+func (c *Community) TransferPaymaster(ctx context.Context, owner common.Address) error {
+	auth, err := c.NewTransactor(ctx)
+	if err != nil {
+		return err
+	}
+
+	// get the next nonce for the main wallet
+	nonce, err := c.NextNonce(ctx)
+	if err != nil {
+		return err
+	}
+
+	// set default parameters
+	setDefaultParameters(auth, nonce)
+
+	_, err = c.Paymaster.TransferOwnership(auth, owner)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// PendingOps returns the transactions carrying operations to the gateway which are not mined yet
+func (c *Community) PendingOps() []ethrequest.PendingTx {
+	ops := []ethrequest.PendingTx{}
+
+	for _, tx := range c.es.Pending() {
+		if tx.To != nil && *tx.To == c.EntryPoint {
+			ops = append(ops, tx)
+		}
+	}
+
+	return ops
+}
@@ -0,0 +1,381 @@
+package community
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+
+	"github.com/daobrussels/cw/pkg/events"
+	"github.com/daobrussels/smartcontracts/pkg/contracts/gratitude"
+	"github.com/daobrussels/smartcontracts/pkg/contracts/grfactory"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+var (
+	ErrNotAccountOwner    = errors.New("caller does not own the account")
+	ErrNotAppOwner        = errors.New("account does not own the gratitude app")
+	ErrUnknownDeployBlock = errors.New("the deploy block of the gratitude factory is unknown")
+)
+
+// GratitudeApp is a gratitude token created by the community
+type GratitudeApp struct {
+	Address common.Address `json:"address"`
+	Owner   common.Address `json:"owner"`
+}
+
+// GratitudeBalance is the amount of gratitude tokens of an app held by an address
+type GratitudeBalance struct {
+	App     common.Address `json:"app"`
+	Balance string         `json:"balance"`
+}
+
+// gratitudeApps are the gratitude apps created by the factories of the community. They are searched once up to the
+// block the events listener starts at, which then tracks the apps created later.
+type gratitudeApps struct {
+	mu     sync.Mutex
+	synced bool // the apps created before the listener started were searched
+	apps   []GratitudeApp
+}
+
+// newGratitudeApps instantiates an empty set of gratitude apps
+func newGratitudeApps() *gratitudeApps {
+	return &gratitudeApps{apps: []GratitudeApp{}}
+}
+
+// add adds the apps which are not known yet and returns them
+func (ga *gratitudeApps) add(apps []GratitudeApp) []GratitudeApp {
+	ga.mu.Lock()
+	defer ga.mu.Unlock()
+
+	added := []GratitudeApp{}
+	for _, app := range apps {
+		known := false
+		for _, a := range ga.apps {
+			if a.Address == app.Address {
+				known = true
+				break
+			}
+		}
+
+		if !known {
+			ga.apps = append(ga.apps, app)
+			added = append(added, app)
+		}
+	}
+
+	return added
+}
+
+// list returns the apps, filtered by owner when one is provided
+func (ga *gratitudeApps) list(owner *common.Address) []GratitudeApp {
+	ga.mu.Lock()
+	defer ga.mu.Unlock()
+
+	apps := []GratitudeApp{}
+	for _, app := range ga.apps {
+		if owner == nil || app.Owner == *owner {
+			apps = append(apps, app)
+		}
+	}
+
+	return apps
+}
+
+// GratitudeApps returns the gratitude apps created by the factories of the community, filtered by owner when one is provided.
+// Apps are searched on the first call unless the events listener already did, the listener keeps them up to date.
+func (c *Community) GratitudeApps(ctx context.Context, owner *common.Address) ([]GratitudeApp, error) {
+	if c.deployBlock(ContractGratitudeFactory) == nil {
+		return nil, ErrUnknownDeployBlock
+	}
+
+	c.gratitude.mu.Lock()
+	synced := c.gratitude.synced
+	c.gratitude.mu.Unlock()
+
+	if !synced {
+		head, err := c.es.BlockNumber(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		err = c.syncGratitudeApps(ctx, head)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return c.gratitude.list(owner), nil
+}
+
+// syncGratitudeApps searches the apps created from the deployment of the gratitude factories up to a block
+func (c *Community) syncGratitudeApps(ctx context.Context, to uint64) error {
+	from := c.deployBlock(ContractGratitudeFactory)
+	if from == nil {
+		return ErrUnknownDeployBlock
+	}
+
+	if from.Uint64() <= to {
+		apps, err := c.findGratitudeApps(ctx, from, new(big.Int).SetUint64(to))
+		if err != nil {
+			return err
+		}
+
+		c.addGratitudeApps(apps)
+	}
+
+	c.gratitude.mu.Lock()
+	c.gratitude.synced = true
+	c.gratitude.mu.Unlock()
+
+	return nil
+}
+
+// findGratitudeApps searches the logs of a range of blocks for the apps created by the gratitude factories
+func (c *Community) findGratitudeApps(ctx context.Context, from, to *big.Int) ([]GratitudeApp, error) {
+	gabi, err := gratitude.GratitudeMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+
+	fabi, err := grfactory.GrfactoryMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+
+	// the factories log the owner of the apps they create but not their address
+	created, err := c.es.FilterLogs(ctx, ethereum.FilterQuery{
+		FromBlock: from,
+		ToBlock:   to,
+		Addresses: c.GratitudeFactories(),
+		Topics:    [][]common.Hash{{fabi.Events["GratitudeTokenCreated"].ID}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	initialized, err := c.es.FilterLogs(ctx, ethereum.FilterQuery{
+		FromBlock: from,
+		ToBlock:   to,
+		Topics:    [][]common.Hash{{gabi.Events["GratitudeTokenInitialized"].ID}, {common.BytesToHash(c.EntryPoint.Bytes())}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return matchGratitudeApps(created, initialized), nil
+}
+
+// matchGratitudeApps returns the apps whose initialization was logged in the same transaction as their creation by a factory.
+// Apps are proxies which emit their initialization event from their own address, along with the gateway and their owner.
+func matchGratitudeApps(created, initialized []types.Log) []GratitudeApp {
+	type creation struct {
+		tx    common.Hash
+		owner common.Hash
+	}
+
+	creations := map[creation]bool{}
+	for _, l := range created {
+		if len(l.Topics) < 2 {
+			continue
+		}
+
+		creations[creation{l.TxHash, l.Topics[1]}] = true
+	}
+
+	apps := []GratitudeApp{}
+	for _, l := range initialized {
+		if len(l.Topics) < 3 || !creations[creation{l.TxHash, l.Topics[2]}] {
+			continue
+		}
+
+		apps = append(apps, GratitudeApp{
+			Address: l.Address,
+			Owner:   common.BytesToAddress(l.Topics[2].Bytes()),
+		})
+	}
+
+	return apps
+}
+
+// addGratitudeApps adds apps to the known ones, the listener follows the transfers of the new ones
+func (c *Community) addGratitudeApps(apps []GratitudeApp) {
+	added := c.gratitude.add(apps)
+	if len(added) == 0 || c.Events == nil {
+		return
+	}
+
+	addrs := make([]common.Address, len(added))
+	for i, app := range added {
+		addrs[i] = app.Address
+	}
+
+	c.Events.Watch(addrs...)
+}
+
+// trackGratitudeApps adds the apps created by the gratitude factories in a batch, their address is read from the receipt
+// of the transaction which created them
+func (c *Community) trackGratitudeApps(b events.Batch) error {
+	fabi, err := grfactory.GrfactoryMetaData.GetAbi()
+	if err != nil {
+		return err
+	}
+
+	gabi, err := gratitude.GratitudeMetaData.GetAbi()
+	if err != nil {
+		return err
+	}
+
+	createdEvent := fabi.Events["GratitudeTokenCreated"].ID
+	initializedEvent := gabi.Events["GratitudeTokenInitialized"].ID
+
+	factories := c.GratitudeFactories()
+
+	for _, l := range b.Logs {
+		if l.Removed || len(l.Topics) < 2 || l.Topics[0] != createdEvent || !containsAddress(factories, l.Address) {
+			continue
+		}
+
+		receipt, err := c.es.Client().TransactionReceipt(context.Background(), l.TxHash)
+		if err != nil {
+			return err
+		}
+
+		initialized := []types.Log{}
+		for _, rl := range receipt.Logs {
+			if len(rl.Topics) == 3 && rl.Topics[0] == initializedEvent && rl.Topics[1] == common.BytesToHash(c.EntryPoint.Bytes()) {
+				initialized = append(initialized, *rl)
+			}
+		}
+
+		c.addGratitudeApps(matchGratitudeApps([]types.Log{l.Log}, initialized))
+	}
+
+	return nil
+}
+
+// GratitudeBalances returns the gratitude tokens of the community held by an address
+func (c *Community) GratitudeBalances(ctx context.Context, holder common.Address) ([]GratitudeBalance, error) {
+	apps, err := c.GratitudeApps(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	balances := []GratitudeBalance{}
+	for _, app := range apps {
+		g, err := gratitude.NewGratitude(app.Address, c.es.Client())
+		if err != nil {
+			return nil, err
+		}
+
+		b, err := g.BalanceOf(&bind.CallOpts{Context: ctx}, holder)
+		if err != nil {
+			return nil, err
+		}
+
+		if b.Sign() == 0 {
+			continue
+		}
+
+		balances = append(balances, GratitudeBalance{
+			App:     app.Address,
+			Balance: b.String(),
+		})
+	}
+
+	return balances, nil
+}
+
+// MintGratitude mints gratitude tokens to the recipients through the account which owns the app
+func (c *Community) MintGratitude(ctx context.Context, caller, account, app common.Address, recipients []common.Address, amounts []*big.Int) error {
+	err := c.Controls.CheckMint(amounts)
+	if err != nil {
+		return err
+	}
+
+	abi, err := gratitude.GratitudeMetaData.GetAbi()
+	if err != nil {
+		return err
+	}
+
+	// overloaded mintToMany(address[],uint256[])
+	data, err := abi.Pack("mintToMany1", recipients, amounts)
+	if err != nil {
+		return err
+	}
+
+	return c.executeAsAppOwner(ctx, caller, account, app, data)
+}
+
+// TransferGratitude transfers gratitude tokens held by the app owner
+func (c *Community) TransferGratitude(ctx context.Context, caller, account, app, to common.Address, amount *big.Int) error {
+	abi, err := gratitude.GratitudeMetaData.GetAbi()
+	if err != nil {
+		return err
+	}
+
+	data, err := abi.Pack("transfer", to, amount)
+	if err != nil {
+		return err
+	}
+
+	return c.executeAsAppOwner(ctx, caller, account, app, data)
+}
+
+// executeAsAppOwner submits an operation for the account to call the app, the caller must own the account and the account the app
+func (c *Community) executeAsAppOwner(ctx context.Context, caller, account, app common.Address, data []byte) error {
+	ok, err := c.IsAccountOwner(ctx, caller, account)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return ErrNotAccountOwner
+	}
+
+	g, err := gratitude.NewGratitude(app, c.es.Client())
+	if err != nil {
+		return err
+	}
+
+	owner, err := g.Owner(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return err
+	}
+
+	if owner != account {
+		return ErrNotAppOwner
+	}
+
+	calldata, err := ExecuteCallData(app, common.Big0, data)
+	if err != nil {
+		return err
+	}
+
+	return c.SubmitOp(ctx, account, calldata)
+}
+
+// deployBlock returns the block a contract was deployed at according to the manifest, nil if unknown.
+// Logs are never searched without it, an unbounded search starts from the genesis block.
+func (c *Community) deployBlock(name string) *big.Int {
+	if c.manifest == nil {
+		return nil
+	}
+
+	r, ok := c.manifest.Contracts[name]
+	if !ok {
+		return nil
+	}
+
+	// apps of replaced factories were created earlier
+	for _, prev := range c.manifest.Previous[name] {
+		if prev.Block < r.Block {
+			r = prev
+		}
+	}
+
+	return new(big.Int).SetUint64(r.Block)
+}
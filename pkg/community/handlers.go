@@ -1,82 +1,948 @@
 package community
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"math/big"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/daobrussels/cw/pkg/common/response"
 	"github.com/daobrussels/cw/pkg/cw"
+	"github.com/daobrussels/cw/pkg/server"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/websocket"
+)
+
+var (
+	ErrInvalidAddress    = errors.New("invalid address")
+	ErrInvalidRecipients = errors.New("recipients and amounts must be non empty and of the same length")
+	ErrInvalidAmount     = errors.New("amount must be positive")
 )
 
 type Handlers struct {
 	responder *response.Responder
-	c         *Community
+	reg       *Registry
+	upgrader  websocket.Upgrader
 }
 
-func NewHandlers(r *response.Responder, c *Community) *Handlers {
+// NewHandlers instantiates the community handlers, requests are expected to carry their community in the context.
+// Websockets are only opened from the browser origins allowed by the cors policy.
+func NewHandlers(r *response.Responder, reg *Registry, cors server.CORS) *Handlers {
 	return &Handlers{
-		r,
-		c,
+		responder: r,
+		reg:       reg,
+		upgrader: websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool {
+				origin := r.Header.Get("Origin")
+
+				// clients other than browsers do not send an origin
+				if origin == "" {
+					return true
+				}
+
+				_, ok := cors.AllowedOrigin(origin)
+				return ok
+			},
+		},
+	}
+}
+
+// Communities returns the addresses and chain info of all communities served by the station, by id
+func (h *Handlers) Communities(w http.ResponseWriter, r *http.Request) {
+	err := h.responder.PublicBody(w, r.Context(), h.reg.Export())
+	if err != nil {
+		h.writeError(w, r, err)
+		return
 	}
 }
 
 // Config returns the community config of addresses and chain info
 func (h *Handlers) Config(w http.ResponseWriter, r *http.Request) {
-	addr := h.c.ExportAddress()
+	c, ok := FromContext(r.Context())
+	if !ok {
+		h.writeError(w, r, ErrCommunityNotFound)
+		return
+	}
+
+	addr := c.ExportAddress()
 
 	err := h.responder.EncryptedBody(w, r.Context(), addr)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		h.writeError(w, r, err)
 		return
 	}
 }
 
 // CreateAccount creates an account in the community and returns the address
 func (h *Handlers) CreateAccount(w http.ResponseWriter, r *http.Request) {
+	c, ok := FromContext(r.Context())
+	if !ok {
+		h.writeError(w, r, ErrCommunityNotFound)
+		return
+	}
+
 	addr, ok := cw.GetAddressFromContext(r.Context())
 	if !ok {
-		w.WriteHeader(http.StatusInternalServerError)
+		h.writeError(w, r, response.ErrUnauthorized)
 		return
 	}
 
-	acc, err := h.c.CreateAccount(common.HexToAddress(addr))
+	acc, err := c.CreateAccount(r.Context(), common.HexToAddress(addr))
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		h.writeError(w, r, err)
 		return
 	}
 
 	err = h.responder.EncryptedBody(w, r.Context(), response.AddressResponse{Address: acc.Hex()})
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		h.writeError(w, r, err)
 		return
 	}
 }
 
 type SubmitOpRequest struct {
-	Data []byte `json:"data"`
+	Data  []byte `json:"data,omitempty"`  // call data of the operation, ignored when calls are provided
+	Calls []Call `json:"calls,omitempty"` // calls for the account to make in a single operation
 }
 
-// SubmitOp submits an operation to the gateway for processing
+// SubmitOp submits an operation to the gateway for processing.
+// When calls are provided the operation is submitted as a batch and the result of each call is returned once it is mined.
 func (h *Handlers) SubmitOp(w http.ResponseWriter, r *http.Request) {
+	c, ok := FromContext(r.Context())
+	if !ok {
+		h.writeError(w, r, ErrCommunityNotFound)
+		return
+	}
+
+	addr, ok := cw.GetAddressFromContext(r.Context())
+	if !ok {
+		h.writeError(w, r, response.ErrUnauthorized)
+		return
+	}
+
+	var req SubmitOpRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.writeError(w, r, response.BadRequest(err))
+		return
+	}
+	defer r.Body.Close()
+
+	if len(req.Calls) == 0 {
+		err = c.SubmitOp(r.Context(), common.HexToAddress(addr), req.Data)
+		if err != nil {
+			h.writeError(w, r, err)
+			return
+		}
+
+		return
+	}
+
+	result, err := c.SubmitCalls(r.Context(), common.HexToAddress(addr), req.Calls)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	err = h.responder.EncryptedBody(w, r.Context(), result)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+}
+
+// Sponsor signs the paymasterAndData of a user operation so that it can be submitted to any bundler
+func (h *Handlers) Sponsor(w http.ResponseWriter, r *http.Request) {
+	c, ok := FromContext(r.Context())
+	if !ok {
+		h.writeError(w, r, ErrCommunityNotFound)
+		return
+	}
+
+	addr, ok := cw.GetAddressFromContext(r.Context())
+	if !ok {
+		h.writeError(w, r, response.ErrUnauthorized)
+		return
+	}
+
+	var op UserOp
+
+	err := json.NewDecoder(r.Body).Decode(&op)
+	if err != nil {
+		h.writeError(w, r, response.BadRequest(err))
+		return
+	}
+	defer r.Body.Close()
+
+	sp, err := c.SponsorOp(r.Context(), common.HexToAddress(addr), op)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	err = h.responder.EncryptedBody(w, r.Context(), sp)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+}
+
+// QuoteToken returns the maximum amount of community tokens a user operation will be charged for gas
+func (h *Handlers) QuoteToken(w http.ResponseWriter, r *http.Request) {
+	c, ok := FromContext(r.Context())
+	if !ok {
+		h.writeError(w, r, ErrCommunityNotFound)
+		return
+	}
+
+	var op UserOp
+
+	err := json.NewDecoder(r.Body).Decode(&op)
+	if err != nil {
+		h.writeError(w, r, response.BadRequest(err))
+		return
+	}
+	defer r.Body.Close()
+
+	q, err := c.QuoteTokenOp(r.Context(), op)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	err = h.responder.EncryptedBody(w, r.Context(), q)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+}
+
+// TokenAccounting returns the gas fees collected in community tokens
+func (h *Handlers) TokenAccounting(w http.ResponseWriter, r *http.Request) {
+	c, ok := FromContext(r.Context())
+	if !ok {
+		h.writeError(w, r, ErrCommunityNotFound)
+		return
+	}
+
+	acc, err := c.TokenAccounting(r.Context())
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	err = h.responder.EncryptedBody(w, r.Context(), acc)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+}
+
+type CreateGratitudeAppRequest struct {
+	Account *common.Address `json:"account,omitempty"` // account of the caller which will own the app, defaults to the caller
+}
+
+// CreateGratitudeApp creates a gratitude app owned by the caller or one of their accounts and returns its address
+func (h *Handlers) CreateGratitudeApp(w http.ResponseWriter, r *http.Request) {
+	c, ok := FromContext(r.Context())
+	if !ok {
+		h.writeError(w, r, ErrCommunityNotFound)
+		return
+	}
+
+	addr, ok := cw.GetAddressFromContext(r.Context())
+	if !ok {
+		h.writeError(w, r, response.ErrUnauthorized)
+		return
+	}
+
+	var req CreateGratitudeAppRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.writeError(w, r, response.BadRequest(err))
+		return
+	}
+	defer r.Body.Close()
+
+	owner := common.HexToAddress(addr)
+	if req.Account != nil {
+		ok, err := c.IsAccountOwner(r.Context(), owner, *req.Account)
+		if err != nil {
+			h.writeError(w, r, err)
+			return
+		}
+
+		if !ok {
+			h.writeError(w, r, ErrNotAccountOwner)
+			return
+		}
+
+		owner = *req.Account
+	}
+
+	app, err := c.CreateGratitudeApp(r.Context(), owner)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	err = h.responder.EncryptedBody(w, r.Context(), response.AddressResponse{Address: app.Hex()})
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+}
+
+type MintGratitudeRequest struct {
+	Account    common.Address   `json:"account"` // account of the caller which owns the app
+	App        common.Address   `json:"app"`
+	Recipients []common.Address `json:"recipients"`
+	Amounts    []*big.Int       `json:"amounts"`
+}
+
+// MintGratitude mints gratitude tokens to the recipients
+func (h *Handlers) MintGratitude(w http.ResponseWriter, r *http.Request) {
+	c, ok := FromContext(r.Context())
+	if !ok {
+		h.writeError(w, r, ErrCommunityNotFound)
+		return
+	}
+
+	addr, ok := cw.GetAddressFromContext(r.Context())
+	if !ok {
+		h.writeError(w, r, response.ErrUnauthorized)
+		return
+	}
+
+	var req MintGratitudeRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.writeError(w, r, response.BadRequest(err))
+		return
+	}
+	defer r.Body.Close()
+
+	if len(req.Recipients) == 0 || len(req.Recipients) != len(req.Amounts) {
+		h.writeError(w, r, ErrInvalidRecipients)
+		return
+	}
+
+	err = c.MintGratitude(r.Context(), common.HexToAddress(addr), req.Account, req.App, req.Recipients, req.Amounts)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+}
+
+type TransferGratitudeRequest struct {
+	Account common.Address `json:"account"` // account of the caller which owns the app
+	App     common.Address `json:"app"`
+	To      common.Address `json:"to"`
+	Amount  *big.Int       `json:"amount"`
+}
+
+// TransferGratitude transfers gratitude tokens held by the account which owns the app
+func (h *Handlers) TransferGratitude(w http.ResponseWriter, r *http.Request) {
+	c, ok := FromContext(r.Context())
+	if !ok {
+		h.writeError(w, r, ErrCommunityNotFound)
+		return
+	}
+
+	addr, ok := cw.GetAddressFromContext(r.Context())
+	if !ok {
+		h.writeError(w, r, response.ErrUnauthorized)
+		return
+	}
+
+	var req TransferGratitudeRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.writeError(w, r, response.BadRequest(err))
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Amount == nil || req.Amount.Sign() <= 0 {
+		h.writeError(w, r, ErrInvalidAmount)
+		return
+	}
+
+	err = c.TransferGratitude(r.Context(), common.HexToAddress(addr), req.Account, req.App, req.To, req.Amount)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+}
+
+// GratitudeApps returns the gratitude apps owned by an address
+func (h *Handlers) GratitudeApps(w http.ResponseWriter, r *http.Request) {
+	c, ok := FromContext(r.Context())
+	if !ok {
+		h.writeError(w, r, ErrCommunityNotFound)
+		return
+	}
+
+	owner := chi.URLParam(r, "owner")
+	if !common.IsHexAddress(owner) {
+		h.writeError(w, r, ErrInvalidAddress)
+		return
+	}
+
+	addr := common.HexToAddress(owner)
+
+	apps, err := c.GratitudeApps(r.Context(), &addr)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	err = h.responder.EncryptedBodyMultiple(w, r.Context(), apps, response.FullPage(len(apps)))
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+}
+
+// GratitudeTokens returns the gratitude tokens held by an address
+func (h *Handlers) GratitudeTokens(w http.ResponseWriter, r *http.Request) {
+	c, ok := FromContext(r.Context())
+	if !ok {
+		h.writeError(w, r, ErrCommunityNotFound)
+		return
+	}
+
+	holder := chi.URLParam(r, "address")
+	if !common.IsHexAddress(holder) {
+		h.writeError(w, r, ErrInvalidAddress)
+		return
+	}
+
+	tokens, err := c.GratitudeBalances(r.Context(), common.HexToAddress(holder))
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	err = h.responder.EncryptedBodyMultiple(w, r.Context(), tokens, response.FullPage(len(tokens)))
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+}
+
+// Guardians returns the guardians of an account
+func (h *Handlers) Guardians(w http.ResponseWriter, r *http.Request) {
+	c, ok := FromContext(r.Context())
+	if !ok {
+		h.writeError(w, r, ErrCommunityNotFound)
+		return
+	}
+
+	account := chi.URLParam(r, "account")
+	if !common.IsHexAddress(account) {
+		h.writeError(w, r, ErrInvalidAddress)
+		return
+	}
+
+	set := c.Recovery.Guardians(common.HexToAddress(account))
+
+	err := h.responder.EncryptedBody(w, r.Context(), set)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+}
+
+type GuardianRequest struct {
+	Account   common.Address `json:"account"`
+	Guardian  common.Address `json:"guardian"`
+	Threshold int            `json:"threshold,omitempty"` // approvals required for a recovery, defaults to a majority
+}
+
+// AddGuardian adds a guardian to an account owned by the caller
+func (h *Handlers) AddGuardian(w http.ResponseWriter, r *http.Request) {
+	h.updateGuardians(w, r, func(c *Community, caller common.Address, req GuardianRequest) (GuardianSet, error) {
+		return c.AddGuardian(r.Context(), caller, req.Account, req.Guardian, req.Threshold)
+	})
+}
+
+// RemoveGuardian removes a guardian from an account owned by the caller
+func (h *Handlers) RemoveGuardian(w http.ResponseWriter, r *http.Request) {
+	h.updateGuardians(w, r, func(c *Community, caller common.Address, req GuardianRequest) (GuardianSet, error) {
+		return c.RemoveGuardian(r.Context(), caller, req.Account, req.Guardian)
+	})
+}
+
+// updateGuardians decodes a guardian request, applies the update and responds with the resulting guardians
+func (h *Handlers) updateGuardians(w http.ResponseWriter, r *http.Request, update func(*Community, common.Address, GuardianRequest) (GuardianSet, error)) {
+	c, ok := FromContext(r.Context())
+	if !ok {
+		h.writeError(w, r, ErrCommunityNotFound)
+		return
+	}
+
 	addr, ok := cw.GetAddressFromContext(r.Context())
 	if !ok {
-		w.WriteHeader(http.StatusInternalServerError)
+		h.writeError(w, r, response.ErrUnauthorized)
 		return
 	}
 
-	var req *SubmitOpRequest
+	var req GuardianRequest
 
-	err := json.NewDecoder(r.Body).Decode(req)
+	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		h.writeError(w, r, response.BadRequest(err))
 		return
 	}
 	defer r.Body.Close()
 
-	err = h.c.SubmitOp(common.HexToAddress(addr), req.Data)
+	set, err := update(c, common.HexToAddress(addr), req)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	err = h.responder.EncryptedBody(w, r.Context(), set)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+}
+
+// SessionKeys returns the active session keys of an account
+func (h *Handlers) SessionKeys(w http.ResponseWriter, r *http.Request) {
+	c, ok := FromContext(r.Context())
+	if !ok {
+		h.writeError(w, r, ErrCommunityNotFound)
+		return
+	}
+
+	account := chi.URLParam(r, "account")
+	if !common.IsHexAddress(account) {
+		h.writeError(w, r, ErrInvalidAddress)
+		return
+	}
+
+	keys := c.Sessions.List(common.HexToAddress(account))
+
+	err := h.responder.EncryptedBodyMultiple(w, r.Context(), keys, response.FullPage(len(keys)))
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		h.writeError(w, r, err)
+		return
+	}
+}
+
+type SessionKeyRequest struct {
+	Account    common.Address   `json:"account"`
+	Key        common.Address   `json:"key"`
+	Token      common.Address   `json:"token,omitempty"` // defaults to the community token
+	Limit      *big.Int         `json:"limit,omitempty"`
+	Recipients []common.Address `json:"recipients,omitempty"`
+	Expiry     time.Time        `json:"expiry,omitempty"`
+}
+
+// RegisterSessionKey registers a session key for an account owned by the caller
+func (h *Handlers) RegisterSessionKey(w http.ResponseWriter, r *http.Request) {
+	c, ok := FromContext(r.Context())
+	if !ok {
+		h.writeError(w, r, ErrCommunityNotFound)
+		return
+	}
+
+	addr, ok := cw.GetAddressFromContext(r.Context())
+	if !ok {
+		h.writeError(w, r, response.ErrUnauthorized)
+		return
+	}
+
+	var req SessionKeyRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.writeError(w, r, response.BadRequest(err))
+		return
+	}
+	defer r.Body.Close()
+
+	token := req.Token
+	if token == (common.Address{}) {
+		token = c.Token
+	}
+
+	key := SessionKey{
+		Key:        req.Key,
+		Token:      token,
+		Limit:      req.Limit,
+		Recipients: req.Recipients,
+		Expiry:     req.Expiry,
+	}
+
+	err = c.RegisterSessionKey(r.Context(), common.HexToAddress(addr), req.Account, key)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+}
+
+// RevokeSessionKey revokes a session key of an account owned by the caller
+func (h *Handlers) RevokeSessionKey(w http.ResponseWriter, r *http.Request) {
+	c, ok := FromContext(r.Context())
+	if !ok {
+		h.writeError(w, r, ErrCommunityNotFound)
+		return
+	}
+
+	addr, ok := cw.GetAddressFromContext(r.Context())
+	if !ok {
+		h.writeError(w, r, response.ErrUnauthorized)
+		return
+	}
+
+	var req SessionKeyRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.writeError(w, r, response.BadRequest(err))
+		return
+	}
+	defer r.Body.Close()
+
+	err = c.RevokeSessionKey(r.Context(), common.HexToAddress(addr), req.Account, req.Key)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+}
+
+// SubmitSessionOp submits a user operation signed by a session key, the operation must stay within the scope of the key
+func (h *Handlers) SubmitSessionOp(w http.ResponseWriter, r *http.Request) {
+	c, ok := FromContext(r.Context())
+	if !ok {
+		h.writeError(w, r, ErrCommunityNotFound)
+		return
+	}
+
+	var op UserOp
+
+	err := json.NewDecoder(r.Body).Decode(&op)
+	if err != nil {
+		h.writeError(w, r, response.BadRequest(err))
+		return
+	}
+	defer r.Body.Close()
+
+	err = c.SubmitSessionOp(r.Context(), op)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+}
+
+// Transactions returns the indexed transactions of an account, most recent first.
+// Supports the token, direction, since, until (RFC 3339), cursor and limit query parameters.
+func (h *Handlers) Transactions(w http.ResponseWriter, r *http.Request) {
+	c, ok := FromContext(r.Context())
+	if !ok {
+		h.writeError(w, r, ErrCommunityNotFound)
 		return
 	}
+
+	address := chi.URLParam(r, "address")
+	if !common.IsHexAddress(address) {
+		h.writeError(w, r, ErrInvalidAddress)
+		return
+	}
+
+	q, err := parseTransactionQuery(r.URL.Query())
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	page, err := c.Transactions(common.HexToAddress(address), q)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	err = h.responder.EncryptedBodyMultiple(w, r.Context(), page.Transactions, &response.Page{
+		Cursor: page.Next,
+		Limit:  page.Limit,
+	})
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+}
+
+// parseTransactionQuery parses the filters of a transaction history request
+func parseTransactionQuery(v url.Values) (TransactionQuery, error) {
+	q := TransactionQuery{
+		Direction: v.Get("direction"),
+		Cursor:    v.Get("cursor"),
+	}
+
+	if q.Direction != "" && q.Direction != DirectionIn && q.Direction != DirectionOut {
+		return q, ErrInvalidQuery
+	}
+
+	if token := v.Get("token"); token != "" {
+		if !common.IsHexAddress(token) {
+			return q, ErrInvalidQuery
+		}
+
+		addr := common.HexToAddress(token)
+		q.Token = &addr
+	}
+
+	var err error
+
+	if since := v.Get("since"); since != "" {
+		q.Since, err = time.Parse(time.RFC3339, since)
+		if err != nil {
+			return q, ErrInvalidQuery
+		}
+	}
+
+	if until := v.Get("until"); until != "" {
+		q.Until, err = time.Parse(time.RFC3339, until)
+		if err != nil {
+			return q, ErrInvalidQuery
+		}
+	}
+
+	if limit := v.Get("limit"); limit != "" {
+		q.Limit, err = strconv.Atoi(limit)
+		if err != nil {
+			return q, ErrInvalidQuery
+		}
+	}
+
+	return q, nil
+}
+
+// Balances returns the native, community token and gratitude balances of an account
+func (h *Handlers) Balances(w http.ResponseWriter, r *http.Request) {
+	c, ok := FromContext(r.Context())
+	if !ok {
+		h.writeError(w, r, ErrCommunityNotFound)
+		return
+	}
+
+	address := chi.URLParam(r, "address")
+	if !common.IsHexAddress(address) {
+		h.writeError(w, r, ErrInvalidAddress)
+		return
+	}
+
+	b, err := c.Balances(r.Context(), common.HexToAddress(address))
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	err = h.responder.EncryptedBody(w, r.Context(), b)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+}
+
+const (
+	// activityKeepAlive is how often idle activity streams are kept alive
+	activityKeepAlive = 30 * time.Second
+
+	// activityEvent is the name of the events of an activity stream
+	activityEvent = "transaction"
+
+	// activityPendingEvent is the name of the events of transactions which are mined but not confirmed yet, they have no id
+	activityPendingEvent = "pending"
+)
+
+// ActivityMessage is a message of an activity stream over websocket
+type ActivityMessage struct {
+	ID    string             `json:"id"`
+	Event string             `json:"event"`
+	Data  *response.Response `json:"data"`
+}
+
+// Activity streams the transactions of an account owned by the caller as they are indexed, encrypted for the public key of the client.
+// Transactions submitted by the station are sent as pending once mined, then again once confirmed.
+// Streams over server-sent events unless a websocket upgrade is requested. Clients resume after the id in the
+// Last-Event-ID header or the lastEventId query parameter.
+func (h *Handlers) Activity(w http.ResponseWriter, r *http.Request) {
+	c, ok := FromContext(r.Context())
+	if !ok {
+		h.writeError(w, r, ErrCommunityNotFound)
+		return
+	}
+
+	address := chi.URLParam(r, "address")
+	if !common.IsHexAddress(address) {
+		h.writeError(w, r, ErrInvalidAddress)
+		return
+	}
+
+	signer, ok := cw.GetAddressFromContext(r.Context())
+	if !ok {
+		h.writeError(w, r, response.ErrUnauthorized)
+		return
+	}
+
+	account := common.HexToAddress(address)
+
+	// only the owner of an account can follow its activity
+	owner, err := c.IsAccountOwner(r.Context(), common.HexToAddress(signer), account)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	if !owner {
+		h.writeError(w, r, ErrNotAccountOwner)
+		return
+	}
+
+	cursor := r.Header.Get("Last-Event-ID")
+	if cursor == "" {
+		cursor = r.URL.Query().Get("lastEventId")
+	}
+
+	sub, missed, err := c.Subscribe(account, cursor)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	defer sub.Close()
+
+	var send func(id, event string, data *response.Response) error
+	var keepAlive func() error
+
+	if websocket.IsWebSocketUpgrade(r) {
+		conn, err := h.upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// the upgrader already responded
+			return
+		}
+		defer conn.Close()
+
+		// the client only sends control messages, reading them notices when it goes away
+		go func() {
+			for {
+				_, _, err := conn.NextReader()
+				if err != nil {
+					sub.Close()
+					return
+				}
+			}
+		}()
+
+		send = func(id, event string, data *response.Response) error {
+			return conn.WriteJSON(ActivityMessage{id, event, data})
+		}
+		keepAlive = func() error {
+			return conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(activityKeepAlive))
+		}
+	} else {
+		stream, err := response.StreamedBody(w)
+		if err != nil {
+			h.writeError(w, r, err)
+			return
+		}
+
+		send = func(id, event string, data *response.Response) error {
+			return stream.Send(id, event, data)
+		}
+		keepAlive = stream.KeepAlive
+	}
+
+	for _, tx := range missed {
+		cursor, err = h.sendActivity(r.Context(), send, tx)
+		if err != nil {
+			return
+		}
+	}
+
+	ticker := time.NewTicker(activityKeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			err := keepAlive()
+			if err != nil {
+				return
+			}
+		case tx, ok := <-sub.C:
+			if !ok {
+				// the client fell behind or went away, it resumes from the last id it received
+				return
+			}
+
+			// pending transactions are not indexed, they do not move the position of the client
+			if tx.Pending {
+				_, err = h.sendActivity(r.Context(), send, tx)
+				if err != nil {
+					return
+				}
+
+				continue
+			}
+
+			// transactions replayed from the index can be published again
+			if cursor != "" && tx.Cursor() <= cursor {
+				continue
+			}
+
+			cursor, err = h.sendActivity(r.Context(), send, tx)
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// sendActivity encrypts a transaction for the client and sends it, returns its cursor. Pending transactions are sent without one.
+func (h *Handlers) sendActivity(ctx context.Context, send func(id, event string, data *response.Response) error, tx Transaction) (string, error) {
+	data, err := h.responder.EncryptedResponse(ctx, tx)
+	if err != nil {
+		return "", err
+	}
+
+	if tx.Pending {
+		return "", send("", activityPendingEvent, data)
+	}
+
+	id := tx.Cursor()
+
+	return id, send(id, activityEvent, data)
+}
+
+// writeError writes the error response matching an error from the community operations
+func (h *Handlers) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	switch err {
+	case ErrNotAccountOwner, ErrNotAppOwner, ErrSponsorshipDenied,
+		ErrSessionExpired, ErrSessionNotFound, ErrOutOfScope, ErrSponsorshipPaused, ErrMintLimit:
+		err = response.Forbidden(err)
+	case ErrInvalidAddress, ErrInvalidRecipients, ErrInvalidAmount, ErrInvalidThreshold, ErrInvalidSession,
+		ErrInvalidCursor, ErrInvalidQuery, ErrBatchValue, ErrNoCalls, ErrInvalidLimit:
+		err = response.BadRequest(err)
+	case ErrCommunityNotFound, ErrTokenPaymasterDisabled, ErrNotIndexed, ErrAccountNotFound, ErrUnknownDeployBlock,
+		ErrSessionKeysUnsupported, ErrNoVerifyingPaymaster:
+		err = response.NotFound(err)
+	}
+
+	h.responder.Error(w, r.Context(), err)
 }
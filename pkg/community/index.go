@@ -0,0 +1,493 @@
+package community
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/daobrussels/cw/pkg/events"
+	"github.com/daobrussels/smartcontracts/pkg/contracts/gateway"
+	"github.com/daobrussels/smartcontracts/pkg/contracts/grfactory"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	// DefaultPageSize is the number of transactions returned when no limit is requested
+	DefaultPageSize = 20
+
+	// MaxPageSize is the maximum number of transactions returned at once
+	MaxPageSize = 100
+)
+
+// types of indexed transactions
+const (
+	TxTransfer = "transfer"
+	TxUserOp   = "userOp"
+	TxAccount  = "account"
+)
+
+// directions of indexed transactions relative to the account
+const (
+	DirectionIn  = "in"
+	DirectionOut = "out"
+)
+
+var (
+	ErrNotIndexed    = errors.New("community is not indexed")
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidQuery  = errors.New("invalid transaction query")
+
+	// transferTopic is the erc20 Transfer event
+	transferTopic = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+
+	// keys of the index
+	lastBlockKey = []byte("b")
+	txPrefix     = []byte("t")
+)
+
+// Transaction is an indexed event in the history of an account
+type Transaction struct {
+	Account   common.Address  `json:"account"`
+	Hash      common.Hash     `json:"hash"`
+	Block     uint64          `json:"block"`
+	LogIndex  uint            `json:"logIndex"`
+	Time      time.Time       `json:"time"`
+	Type      string          `json:"type"`
+	Direction string          `json:"direction,omitempty"`
+	Token     *common.Address `json:"token,omitempty"`
+	From      common.Address  `json:"from"`
+	To        common.Address  `json:"to"`
+	Value     *hexutil.Big    `json:"value,omitempty"` // amount transferred, gas paid for user operations
+	Success   *bool           `json:"success,omitempty"`
+	Pending   bool            `json:"pending,omitempty"` // mined but not confirmed yet, pending transactions are not indexed
+}
+
+// TransactionQuery filters the transactions of an account, zero values match everything
+type TransactionQuery struct {
+	Token     *common.Address
+	Direction string
+	Since     time.Time
+	Until     time.Time
+	Cursor    string // position to continue from, returned by the previous page
+	Limit     int
+}
+
+// TransactionPage is a page of transactions, most recent first
+type TransactionPage struct {
+	Transactions []Transaction `json:"transactions"`
+	Next         string        `json:"next,omitempty"` // cursor of the next page, empty on the last page
+	Limit        int           `json:"limit"`
+}
+
+// Index stores the transaction history of accounts in an embedded database
+type Index struct {
+	db *leveldb.DB
+}
+
+// OpenIndex opens the index stored in the directory at path, the index is kept in memory when path is empty
+func OpenIndex(path string) (*Index, error) {
+	var db *leveldb.DB
+	var err error
+
+	if path == "" {
+		db, err = leveldb.Open(storage.NewMemStorage(), nil)
+	} else {
+		db, err = leveldb.OpenFile(path, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Index{db}, nil
+}
+
+// Close closes the database of the index
+func (i *Index) Close() error {
+	return i.db.Close()
+}
+
+// LastBlock returns the last block which was indexed
+func (i *Index) LastBlock() (uint64, bool, error) {
+	b, err := i.db.Get(lastBlockKey, nil)
+	if err == leveldb.ErrNotFound {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	return binary.BigEndian.Uint64(b), true, nil
+}
+
+// Put stores transactions and marks the block as indexed in a single write
+func (i *Index) Put(txs []Transaction, block uint64) error {
+	batch := new(leveldb.Batch)
+
+	for _, tx := range txs {
+		b, err := json.Marshal(tx)
+		if err != nil {
+			return err
+		}
+
+		batch.Put(txKey(tx), b)
+	}
+
+	batch.Put(lastBlockKey, binary.BigEndian.AppendUint64(nil, block))
+
+	return i.db.Write(batch, nil)
+}
+
+// Transactions returns a page of the transactions of an account, most recent first
+func (i *Index) Transactions(account common.Address, q TransactionQuery) (*TransactionPage, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+
+	prefix := append(append([]byte{}, txPrefix...), account.Bytes()...)
+
+	// the page starts before the cursor
+	var end []byte
+	if q.Cursor != "" {
+		pos, err := hexutil.Decode(q.Cursor)
+		if err != nil || len(pos) != txPositionLength {
+			return nil, ErrInvalidCursor
+		}
+
+		end = append(append([]byte{}, prefix...), pos...)
+	}
+
+	it := i.db.NewIterator(util.BytesPrefix(prefix), nil)
+	defer it.Release()
+
+	// the page starts before the transaction at the cursor, which was returned on the previous page
+	var ok bool
+	if end != nil && it.Seek(end) {
+		ok = it.Prev()
+	} else {
+		ok = it.Last()
+	}
+
+	page := &TransactionPage{
+		Transactions: []Transaction{},
+		Limit:        limit,
+	}
+
+	for ; ok; ok = it.Prev() {
+		var tx Transaction
+
+		err := json.Unmarshal(it.Value(), &tx)
+		if err != nil {
+			return nil, err
+		}
+
+		// transactions are ordered by block, the rest are older
+		if !q.Since.IsZero() && tx.Time.Before(q.Since) {
+			break
+		}
+
+		if !q.matches(tx) {
+			continue
+		}
+
+		// there are more transactions, the next page starts before the last one returned
+		if len(page.Transactions) == limit {
+			page.Next = page.Transactions[limit-1].Cursor()
+			break
+		}
+
+		page.Transactions = append(page.Transactions, tx)
+	}
+
+	err := it.Error()
+	if err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// After returns up to limit transactions of an account which were indexed after the cursor, oldest first
+func (i *Index) After(account common.Address, cursor string, limit int) ([]Transaction, error) {
+	prefix := append(append([]byte{}, txPrefix...), account.Bytes()...)
+
+	pos, err := hexutil.Decode(cursor)
+	if err != nil || len(pos) != txPositionLength {
+		return nil, ErrInvalidCursor
+	}
+
+	start := append(append([]byte{}, prefix...), pos...)
+
+	it := i.db.NewIterator(util.BytesPrefix(prefix), nil)
+	defer it.Release()
+
+	txs := []Transaction{}
+	for ok := it.Seek(start); ok && len(txs) < limit; ok = it.Next() {
+		if bytes.Equal(it.Key(), start) {
+			continue
+		}
+
+		var tx Transaction
+
+		err := json.Unmarshal(it.Value(), &tx)
+		if err != nil {
+			return nil, err
+		}
+
+		txs = append(txs, tx)
+	}
+
+	err = it.Error()
+	if err != nil {
+		return nil, err
+	}
+
+	return txs, nil
+}
+
+// Cursor returns the position of a transaction in the history of its account
+func (tx Transaction) Cursor() string {
+	return hexutil.Encode(txKey(tx)[len(txPrefix)+common.AddressLength:])
+}
+
+// matches returns whether a transaction matches the filters of the query
+func (q TransactionQuery) matches(tx Transaction) bool {
+	if q.Token != nil && (tx.Token == nil || *tx.Token != *q.Token) {
+		return false
+	}
+
+	if q.Direction != "" && tx.Direction != q.Direction {
+		return false
+	}
+
+	if !q.Until.IsZero() && tx.Time.After(q.Until) {
+		return false
+	}
+
+	return true
+}
+
+// txPositionLength is the length of the position of a transaction in the keys of an account: block, log index and direction
+const txPositionLength = 8 + 4 + 1
+
+// txKey returns the key of a transaction, transactions of an account are ordered by block and log index
+func txKey(tx Transaction) []byte {
+	key := make([]byte, 0, len(txPrefix)+common.AddressLength+txPositionLength)
+	key = append(key, txPrefix...)
+	key = append(key, tx.Account.Bytes()...)
+	key = binary.BigEndian.AppendUint64(key, tx.Block)
+	key = binary.BigEndian.AppendUint32(key, uint32(tx.LogIndex))
+
+	// a transfer to self is indexed in both directions
+	if tx.Direction == DirectionOut {
+		return append(key, 1)
+	}
+
+	return append(key, 0)
+}
+
+// logQuery returns the query for the logs of the community contracts which are indexed or tracked.
+// The transfers of gratitude apps are followed once the apps are known, see trackGratitudeApps.
+func (c *Community) logQuery() ethereum.FilterQuery {
+	gabi, _ := gateway.GatewayMetaData.GetAbi()
+	fabi, _ := grfactory.GrfactoryMetaData.GetAbi()
+
+	topics := []common.Hash{transferTopic}
+	if gabi != nil {
+		topics = append(topics, gabi.Events["UserOperationEvent"].ID, gabi.Events["AccountDeployed"].ID)
+	}
+
+	if fabi != nil {
+		topics = append(topics, fabi.Events["GratitudeTokenCreated"].ID)
+	}
+
+	addrs := []common.Address{c.EntryPoint}
+	if c.Token != (common.Address{}) {
+		addrs = append(addrs, c.Token)
+	}
+
+	if c.grfaddr != (common.Address{}) {
+		addrs = append(addrs, c.GratitudeFactories()...)
+	}
+
+	return ethereum.FilterQuery{
+		Addresses: addrs,
+		Topics:    [][]common.Hash{topics},
+	}
+}
+
+// Listen listens to the logs of the community contracts, resuming after the last indexed block.
+// A community without an index starts from its deployment or from the current block. Blocks until the context is cancelled.
+func (c *Community) Listen(ctx context.Context) error {
+	from, err := c.listenFrom(ctx)
+	if err != nil {
+		return err
+	}
+
+	// gratitude apps created before the listener starts are searched once, the listener tracks the others
+	if from > 0 {
+		err = c.syncGratitudeApps(ctx, from-1)
+		if err != nil && err != ErrUnknownDeployBlock {
+			// they are searched again when first listed
+			slog.Warn("unable to search gratitude apps", "community", c.Events.Name, slog.ErrorKey, err)
+		}
+	}
+
+	return c.Events.Listen(ctx, from)
+}
+
+// listenFrom returns the block to start listening from
+func (c *Community) listenFrom(ctx context.Context) (uint64, error) {
+	if c.Index != nil {
+		last, ok, err := c.Index.LastBlock()
+		if err != nil {
+			return 0, err
+		}
+
+		if ok {
+			return last + 1, nil
+		}
+	}
+
+	if block := c.deployBlock(ContractGateway); block != nil {
+		return block.Uint64(), nil
+	}
+
+	return c.es.BlockNumber(ctx)
+}
+
+// indexLogs decodes logs of the community contracts into transactions and stores them in the index
+func (c *Community) indexLogs(b events.Batch) error {
+	txs := []Transaction{}
+	for _, l := range b.Logs {
+		if l.Removed {
+			continue
+		}
+
+		ltxs, err := c.decodeLog(l.Log, l.Time)
+		if err != nil {
+			return err
+		}
+
+		txs = append(txs, ltxs...)
+	}
+
+	err := c.Index.Put(txs, b.ToBlock)
+	if err != nil {
+		return err
+	}
+
+	c.activity.publish(txs)
+
+	return nil
+}
+
+// publishPending publishes the transactions of a receipt to the activity streams before they are confirmed and indexed
+func (c *Community) publishPending(receipt *types.Receipt) error {
+	txs := []Transaction{}
+	for _, l := range receipt.Logs {
+		ltxs, err := c.decodeLog(*l, time.Now())
+		if err != nil {
+			return err
+		}
+
+		for i := range ltxs {
+			ltxs[i].Pending = true
+		}
+
+		txs = append(txs, ltxs...)
+	}
+
+	c.activity.publish(txs)
+
+	return nil
+}
+
+// decodeLog decodes a log of the community contracts into the transactions of the accounts it involves
+func (c *Community) decodeLog(l types.Log, t time.Time) ([]Transaction, error) {
+	gabi, err := gateway.GatewayMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(l.Topics) == 0 {
+		return nil, nil
+	}
+
+	tx := Transaction{
+		Hash:     l.TxHash,
+		Block:    l.BlockNumber,
+		LogIndex: l.Index,
+		Time:     t,
+	}
+
+	switch {
+	case l.Topics[0] == transferTopic && len(l.Topics) == 3 && l.Address == c.Token:
+		token := l.Address
+
+		tx.Type = TxTransfer
+		tx.Token = &token
+		tx.From = common.BytesToAddress(l.Topics[1].Bytes())
+		tx.To = common.BytesToAddress(l.Topics[2].Bytes())
+		tx.Value = (*hexutil.Big)(new(big.Int).SetBytes(l.Data))
+
+		out, in := tx, tx
+		out.Direction, out.Account = DirectionOut, tx.From
+		in.Direction, in.Account = DirectionIn, tx.To
+
+		return []Transaction{out, in}, nil
+	case l.Topics[0] == gabi.Events["UserOperationEvent"].ID && l.Address == c.EntryPoint:
+		ev, err := c.Gateway.ParseUserOperationEvent(l)
+		if err != nil {
+			return nil, err
+		}
+
+		tx.Type = TxUserOp
+		tx.Direction = DirectionOut
+		tx.From = ev.Sender
+		tx.To = ev.Paymaster
+		tx.Value = (*hexutil.Big)(ev.ActualGasCost)
+		tx.Success = &ev.Success
+		tx.Account = ev.Sender
+
+		return []Transaction{tx}, nil
+	case l.Topics[0] == gabi.Events["AccountDeployed"].ID && l.Address == c.EntryPoint:
+		ev, err := c.Gateway.ParseAccountDeployed(l)
+		if err != nil {
+			return nil, err
+		}
+
+		tx.Type = TxAccount
+		tx.From = ev.Factory
+		tx.To = ev.Sender
+		tx.Account = ev.Sender
+
+		return []Transaction{tx}, nil
+	}
+
+	return nil, nil
+}
+
+// Transactions returns a page of the indexed transactions of an account
+func (c *Community) Transactions(account common.Address, q TransactionQuery) (*TransactionPage, error) {
+	if c.Index == nil {
+		return nil, ErrNotIndexed
+	}
+
+	return c.Index.Transactions(account, q)
+}
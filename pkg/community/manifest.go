@@ -0,0 +1,297 @@
+package community
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"runtime/debug"
+	"time"
+
+	"github.com/daobrussels/smartcontracts/pkg/contracts/accfactory"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	// ManifestVersion is the version of the manifest format
+	ManifestVersion = 1
+
+	smartcontractsModule = "github.com/daobrussels/smartcontracts"
+)
+
+// names of the community contracts
+const (
+	ContractGateway          = "gateway"
+	ContractPaymaster        = "paymaster"
+	ContractAccountFactory   = "accountFactory"
+	ContractGratitudeFactory = "gratitudeFactory"
+	ContractProfileFactory   = "profileFactory"
+)
+
+var (
+	ErrNotMigratable      = errors.New("contract cannot be migrated")
+	ErrAccountNotFound    = errors.New("account not found")
+	ErrDeploymentReverted = errors.New("deployment reverted")
+)
+
+// ContractRecord records how a community contract was deployed
+type ContractRecord struct {
+	Address  common.Address `json:"address"`
+	Version  string         `json:"version"` // version of the smartcontracts module the contract was deployed from
+	DeployTx common.Hash    `json:"deployTx"`
+	Block    uint64         `json:"block"` // 0 while the deployment is pending
+}
+
+// Manifest records the deployment history of the community contracts
+type Manifest struct {
+	Version   int                         `json:"version"`
+	Contracts map[string]ContractRecord   `json:"contracts"`
+	Previous  map[string][]ContractRecord `json:"previous,omitempty"` // replaced contracts, most recent last
+}
+
+// ContractsVersion returns the version of the smartcontracts module this binary was built with
+func ContractsVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+
+	for _, dep := range info.Deps {
+		if dep.Path == smartcontractsModule {
+			return dep.Version
+		}
+	}
+
+	return "unknown"
+}
+
+// Manifest returns the deployment manifest of the community, nil if it was deployed without one
+func (c *Community) Manifest() *Manifest {
+	return c.manifest
+}
+
+// record records a deployment in the manifest and saves the progress as soon as it is sent, then waits for it to be mined.
+// A deployment which is interrupted while pending is confirmed on resume instead of being sent again.
+func (c *Community) record(ctx context.Context, name string, addr common.Address, tx *types.Transaction) error {
+	if c.DryRun {
+		return nil
+	}
+
+	if c.manifest == nil {
+		c.manifest = &Manifest{
+			Version:   ManifestVersion,
+			Contracts: map[string]ContractRecord{},
+		}
+	}
+
+	// a migration keeps the contract it replaces
+	if prev, ok := c.manifest.Contracts[name]; ok && prev.Address != addr {
+		if c.manifest.Previous == nil {
+			c.manifest.Previous = map[string][]ContractRecord{}
+		}
+
+		c.manifest.Previous[name] = append(c.manifest.Previous[name], prev)
+	}
+
+	c.manifest.Contracts[name] = ContractRecord{
+		Address:  addr,
+		Version:  ContractsVersion(),
+		DeployTx: tx.Hash(),
+	}
+
+	err := c.saveProgress()
+	if err != nil {
+		return err
+	}
+
+	return c.confirm(ctx, name)
+}
+
+// pending returns whether the deployment of a contract was sent without being confirmed
+func (c *Community) pending(name string) bool {
+	if c.manifest == nil {
+		return false
+	}
+
+	r, ok := c.manifest.Contracts[name]
+
+	return ok && r.Block == 0 && r.DeployTx != (common.Hash{})
+}
+
+// confirm waits for the recorded deployment of a contract to be mined and records its block
+func (c *Community) confirm(ctx context.Context, name string) error {
+	r := c.manifest.Contracts[name]
+
+	receipt, err := c.waitReceipt(ctx, r.DeployTx)
+	if err != nil {
+		return err
+	}
+
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return fmt.Errorf("%s: %w", name, ErrDeploymentReverted)
+	}
+
+	r.Block = receipt.BlockNumber.Uint64()
+	c.manifest.Contracts[name] = r
+
+	return c.saveProgress()
+}
+
+// waitReceipt waits for the receipt of a transaction which was sent
+func (c *Community) waitReceipt(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		receipt, err := c.es.Client().TransactionReceipt(ctx, hash)
+		if err == nil {
+			return receipt, nil
+		}
+
+		if !errors.Is(err, ethereum.NotFound) {
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// saveProgress passes the addresses of the community to the callback of the deployment in progress
+func (c *Community) saveProgress() error {
+	if c.progress == nil {
+		return nil
+	}
+
+	return c.progress(c.ExportAddress())
+}
+
+// Migrate deploys a new version of a contract and replaces it in the community, the gateway cannot be replaced.
+// The replaced contract is kept in the manifest, a replaced paymaster keeps its deposit until it is withdrawn.
+// The optional callback is called with the addresses once the deployment is sent and once it is mined, so that an
+// interrupted migration is confirmed when it is run again instead of deploying another contract.
+func (c *Community) Migrate(ctx context.Context, name string, step func(CommunityAddress) error) error {
+	m, ok := map[string]struct {
+		bind   func(common.Address) error
+		deploy func(context.Context) error
+	}{
+		ContractPaymaster:        {c.bindPaymaster, c.DeployPaymaster},
+		ContractAccountFactory:   {c.bindAccountFactory, c.DeployAccountFactory},
+		ContractGratitudeFactory: {c.bindGratitudeFactory, c.DeployGratitudeFactory},
+		ContractProfileFactory:   {c.bindProfileFactory, c.DeployProfileFactory},
+	}[name]
+	if !ok {
+		return ErrNotMigratable
+	}
+
+	if c.DryRun {
+		return m.deploy(ctx)
+	}
+
+	c.progress = step
+	defer func() { c.progress = nil }()
+
+	if c.pending(name) {
+		err := c.confirm(ctx, name)
+		if !errors.Is(err, ErrDeploymentReverted) {
+			return err
+		}
+
+		// the contract was never created, the replaced one is restored before deploying again
+		prev := c.manifest.Previous[name]
+		if len(prev) == 0 {
+			return err
+		}
+
+		c.manifest.Contracts[name] = prev[len(prev)-1]
+		c.manifest.Previous[name] = prev[:len(prev)-1]
+
+		err = m.bind(c.manifest.Contracts[name].Address)
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.manifest == nil {
+		c.manifest = &Manifest{
+			Version:   ManifestVersion,
+			Contracts: map[string]ContractRecord{},
+		}
+	}
+
+	// communities deployed before manifests existed only know their addresses
+	if _, ok := c.manifest.Contracts[name]; !ok {
+		c.manifest.Contracts[name] = ContractRecord{Address: c.contractAddress(name)}
+	}
+
+	return m.deploy(ctx)
+}
+
+// AccountFactories returns the current account factory followed by the ones it replaced, most recent first
+func (c *Community) AccountFactories() []common.Address {
+	return c.withReplaced(ContractAccountFactory, c.afaddr)
+}
+
+// GratitudeFactories returns the current gratitude factory followed by the ones it replaced, most recent first
+func (c *Community) GratitudeFactories() []common.Address {
+	return c.withReplaced(ContractGratitudeFactory, c.grfaddr)
+}
+
+// withReplaced returns the current address of a contract followed by the addresses it replaced, most recent first
+func (c *Community) withReplaced(name string, current common.Address) []common.Address {
+	addrs := []common.Address{current}
+
+	if c.manifest == nil {
+		return addrs
+	}
+
+	prev := c.manifest.Previous[name]
+	for i := len(prev) - 1; i >= 0; i-- {
+		addrs = append(addrs, prev[i].Address)
+	}
+
+	return addrs
+}
+
+// FindAccount returns the address of an existing account, accounts created by replaced factories are found as well
+func (c *Community) FindAccount(ctx context.Context, owner common.Address, salt *big.Int) (*common.Address, error) {
+	for _, factory := range c.AccountFactories() {
+		f, err := accfactory.NewAccfactory(factory, c.es.Client())
+		if err != nil {
+			return nil, err
+		}
+
+		addr, err := f.GetAddress(&bind.CallOpts{Context: ctx}, owner, salt)
+		if err != nil {
+			return nil, err
+		}
+
+		code, err := c.es.CodeAt(ctx, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(code) > 0 {
+			return &addr, nil
+		}
+	}
+
+	return nil, ErrAccountNotFound
+}
+
+// contractAddress returns the current address of a community contract by name
+func (c *Community) contractAddress(name string) common.Address {
+	for _, contract := range c.Contracts() {
+		if contract.Name == name {
+			return contract.Address
+		}
+	}
+
+	return common.Address{}
+}
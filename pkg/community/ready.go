@@ -0,0 +1,117 @@
+package community
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+)
+
+// names of the readiness checks of a community
+const (
+	CheckRPC       = "rpc"
+	CheckChainID   = "chain_id"
+	CheckCode      = "code"
+	CheckSupply    = "supply_balance"
+	CheckPaymaster = "paymaster_deposit"
+)
+
+// ReadyThresholds are the funds a community needs to be ready, it is not ready with no funds at all when they are nil
+type ReadyThresholds struct {
+	MinBalance *big.Int // balance of the supply wallet, in wei
+	MinDeposit *big.Int // deposit of the paymaster, in wei
+}
+
+// Check is the result of a readiness check
+type Check struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Value string `json:"value,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// Readiness is whether a community can serve requests, along with the checks which decided it
+type Readiness struct {
+	Ready  bool    `json:"ready"`
+	Checks []Check `json:"checks"`
+}
+
+// add records a check, the community is ready as long as every check passed
+func (r *Readiness) add(c Check) {
+	r.Checks = append(r.Checks, c)
+	r.Ready = r.Ready && c.OK
+}
+
+// Ready checks that the rpc endpoint is reachable and on the configured chain, that the contracts are deployed
+// and that the supply wallet and the paymaster have funds. The other checks are skipped when the endpoint is unreachable.
+func (c *Community) Ready(ctx context.Context, t ReadyThresholds) Readiness {
+	r := Readiness{Ready: true, Checks: []Check{}}
+
+	id, err := c.es.ChainID(ctx)
+	if err != nil {
+		r.add(Check{Name: CheckRPC, Error: err.Error()})
+		return r
+	}
+
+	r.add(Check{Name: CheckRPC, OK: true})
+
+	chain := Check{Name: CheckChainID, OK: true, Value: id.String()}
+	if id.Cmp(big.NewInt(int64(c.Chain.ChainID))) != 0 {
+		chain.OK = false
+		chain.Error = fmt.Sprintf("expected chain %d", c.Chain.ChainID)
+	}
+
+	r.add(chain)
+
+	r.add(c.checkCode(ctx))
+
+	balance, err := c.es.BalanceAt(ctx, c.address)
+	r.add(checkFunds(CheckSupply, balance, err, t.MinBalance))
+
+	deposit, err := c.Paymaster.GetDeposit(&bind.CallOpts{Context: ctx})
+	r.add(checkFunds(CheckPaymaster, deposit, err, t.MinDeposit))
+
+	return r
+}
+
+// checkCode checks that every community contract is deployed, its value lists the missing ones
+func (c *Community) checkCode(ctx context.Context) Check {
+	contracts, err := c.VerifyCode(ctx)
+	if err != nil {
+		return Check{Name: CheckCode, Error: err.Error()}
+	}
+
+	missing := []string{}
+	for _, contract := range contracts {
+		if !contract.Deployed {
+			missing = append(missing, contract.Name)
+		}
+	}
+
+	if len(missing) > 0 {
+		return Check{Name: CheckCode, Error: fmt.Sprintf("no code at %s", strings.Join(missing, ", "))}
+	}
+
+	return Check{Name: CheckCode, OK: true}
+}
+
+// checkFunds checks that an amount was read and is at least the minimum, or positive without one
+func checkFunds(name string, amount *big.Int, err error, min *big.Int) Check {
+	if err != nil {
+		return Check{Name: name, Error: err.Error()}
+	}
+
+	ok := amount.Sign() > 0
+	if min != nil {
+		ok = amount.Cmp(min) >= 0
+	}
+
+	check := Check{Name: name, OK: ok, Value: amount.String()}
+	if !ok {
+		check.Error = "insufficient funds"
+	}
+
+	return check
+}
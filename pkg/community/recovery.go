@@ -0,0 +1,207 @@
+package community
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var (
+	ErrInvalidThreshold = errors.New("invalid guardian threshold")
+)
+
+// GuardianSet are the addresses allowed to recover an account and how many of them must approve
+type GuardianSet struct {
+	Guardians []common.Address `json:"guardians"`
+	Threshold int              `json:"threshold"`
+	Explicit  bool             `json:"explicit,omitempty"` // the threshold was chosen by the owner, it follows the majority otherwise
+}
+
+// Recovery keeps the guardians of accounts. When a path is provided the state is persisted to that file.
+// Guardians cannot approve a recovery yet, the accounts of the community have no way to change their owner.
+type Recovery struct {
+	mu   sync.Mutex
+	path string
+	Sets map[common.Address]*GuardianSet `json:"sets"`
+}
+
+// NewRecovery instantiates the recovery state, loading it from the file at path if it exists
+func NewRecovery(path string) (*Recovery, error) {
+	r := newRecovery(path)
+
+	if path == "" {
+		return r, nil
+	}
+
+	err := loadJSON(path, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// newRecovery instantiates an empty recovery state
+func newRecovery(path string) *Recovery {
+	return &Recovery{
+		path: path,
+		Sets: map[common.Address]*GuardianSet{},
+	}
+}
+
+// Guardians returns the guardians of an account
+func (r *Recovery) Guardians(account common.Address) GuardianSet {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	set, ok := r.Sets[account]
+	if !ok {
+		return GuardianSet{Guardians: []common.Address{}}
+	}
+
+	return GuardianSet{
+		Guardians: append([]common.Address{}, set.Guardians...),
+		Threshold: set.Threshold,
+		Explicit:  set.Explicit,
+	}
+}
+
+// AddGuardian adds a guardian to an account, a threshold of 0 keeps the one chosen by the owner or follows the majority
+func (r *Recovery) AddGuardian(account, guardian common.Address, threshold int) (GuardianSet, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	set := &GuardianSet{}
+	if current, ok := r.Sets[account]; ok {
+		set.Guardians = append(set.Guardians, current.Guardians...)
+		set.Threshold = current.Threshold
+		set.Explicit = current.Explicit
+	}
+
+	if !containsAddress(set.Guardians, guardian) {
+		set.Guardians = append(set.Guardians, guardian)
+	}
+
+	err := set.setThreshold(threshold)
+	if err != nil {
+		return GuardianSet{}, err
+	}
+
+	r.Sets[account] = set
+
+	return *set, r.save()
+}
+
+// RemoveGuardian removes a guardian from an account
+func (r *Recovery) RemoveGuardian(account, guardian common.Address) (GuardianSet, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	set, ok := r.Sets[account]
+	if !ok {
+		return GuardianSet{Guardians: []common.Address{}}, nil
+	}
+
+	guardians := []common.Address{}
+	for _, g := range set.Guardians {
+		if g != guardian {
+			guardians = append(guardians, g)
+		}
+	}
+
+	set.Guardians = guardians
+	if !set.Explicit {
+		set.Threshold = len(guardians)/2 + 1
+	}
+
+	if set.Threshold > len(guardians) {
+		set.Threshold = len(guardians)
+	}
+
+	if len(guardians) == 0 {
+		delete(r.Sets, account)
+	}
+
+	return *set, r.save()
+}
+
+// save persists the state if a path was provided, must be called with the lock held
+func (r *Recovery) save() error {
+	return saveJSON(r.path, r)
+}
+
+// setThreshold sets the number of approvals required. Without one, the threshold chosen earlier is kept
+// or a majority of the guardians is required.
+func (s *GuardianSet) setThreshold(threshold int) error {
+	explicit := threshold != 0 || s.Explicit
+
+	switch {
+	case threshold != 0:
+	case s.Explicit:
+		threshold = s.Threshold
+	default:
+		threshold = len(s.Guardians)/2 + 1
+	}
+
+	if threshold < 0 || threshold > len(s.Guardians) {
+		return ErrInvalidThreshold
+	}
+
+	s.Threshold = threshold
+	s.Explicit = explicit
+
+	return nil
+}
+
+// AddGuardian adds a guardian to an account owned by the caller
+func (c *Community) AddGuardian(ctx context.Context, caller, account, guardian common.Address, threshold int) (GuardianSet, error) {
+	ok, err := c.IsAccountOwner(ctx, caller, account)
+	if err != nil {
+		return GuardianSet{}, err
+	}
+
+	if !ok {
+		return GuardianSet{}, ErrNotAccountOwner
+	}
+
+	return c.Recovery.AddGuardian(account, guardian, threshold)
+}
+
+// RemoveGuardian removes a guardian from an account owned by the caller
+func (c *Community) RemoveGuardian(ctx context.Context, caller, account, guardian common.Address) (GuardianSet, error) {
+	ok, err := c.IsAccountOwner(ctx, caller, account)
+	if err != nil {
+		return GuardianSet{}, err
+	}
+
+	if !ok {
+		return GuardianSet{}, ErrNotAccountOwner
+	}
+
+	return c.Recovery.RemoveGuardian(account, guardian)
+}
+
+// containsAddress returns whether the address is in the list
+func containsAddress(addrs []common.Address, addr common.Address) bool {
+	for _, a := range addrs {
+		if a == addr {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseABI parses a json abi definition
+func parseABI(def string) (*abi.ABI, error) {
+	parsed, err := abi.JSON(strings.NewReader(def))
+	if err != nil {
+		return nil, err
+	}
+
+	return &parsed, nil
+}
@@ -0,0 +1,591 @@
+package community
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/daobrussels/cw/pkg/breaker"
+	"github.com/daobrussels/cw/pkg/common/ethrequest"
+	"github.com/daobrussels/cw/pkg/events"
+	"github.com/daobrussels/cw/pkg/metrics"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/fsnotify/fsnotify"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	// ConfigSuffix is the suffix of community config files
+	ConfigSuffix = ".community.json"
+
+	// drainInterval is how often pending transactions are checked while draining
+	drainInterval = 500 * time.Millisecond
+)
+
+var (
+	ErrCommunityNotFound = errors.New("community not found")
+	ErrMissingRPC        = errors.New("missing chain rpc")
+)
+
+type contextKey string
+
+const contextKeyCommunity contextKey = "community"
+
+// Registry holds all the communities served by a station, communities can live on different chains
+type Registry struct {
+	key     *ecdsa.PrivateKey
+	address common.Address
+
+	// DataDir is where the state of each community is persisted, state is kept in memory when empty
+	DataDir string
+
+	// BalanceTTL is how long account balances are cached, DefaultBalanceTTL when zero
+	BalanceTTL time.Duration
+
+	// RPC sets the timeout and the retries of the calls to the rpc endpoints
+	RPC ethrequest.Config
+
+	// Confirmations is how many blocks must follow a block before its logs are indexed
+	Confirmations uint64
+
+	// Breaker pauses the spending of every community, nil when the station cannot be paused
+	Breaker *breaker.Breaker
+
+	// Thresholds are the funds every community needs to be ready
+	Thresholds ReadyThresholds
+
+	mu          sync.RWMutex
+	services    map[string]*ethrequest.EthService // one service per rpc endpoint
+	communities map[string]*Community
+	defaultID   string
+
+	indexes   map[string]*Index    // indexes outlive reloads of their community
+	stores    map[string]*stores   // as do their recovery, sessions and controls
+	listenCtx context.Context      // set once the registry listens to the communities
+	listeners map[string]*listener // listener of each community
+}
+
+// stores hold the state of a community which is persisted in the data directory
+type stores struct {
+	recovery *Recovery
+	sessions *Sessions
+	controls *Controls
+}
+
+// listener is a running community listener
+type listener struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// stop stops the listener and waits for the batch it is processing
+func (l *listener) stop() {
+	l.cancel()
+	<-l.done
+}
+
+// NewRegistry instantiates an empty registry, communities will be operated by the provided key
+func NewRegistry(key *ecdsa.PrivateKey, address common.Address) *Registry {
+	return &Registry{
+		key:           key,
+		address:       address,
+		services:      map[string]*ethrequest.EthService{},
+		communities:   map[string]*Community{},
+		indexes:       map[string]*Index{},
+		stores:        map[string]*stores{},
+		listeners:     map[string]*listener{},
+		RPC:           ethrequest.DefaultConfig(),
+		Confirmations: events.DefaultConfirmations,
+	}
+}
+
+// ConfigID returns the id of a community from the path of its config file
+func ConfigID(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), ConfigSuffix)
+}
+
+// ReadConfig reads a *.community.json file
+func ReadConfig(path string) (*CommunityAddress, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var addr CommunityAddress
+	err = json.Unmarshal(b, &addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(addr.Chain.RPC) == 0 {
+		return nil, fmt.Errorf("%s: %w", path, ErrMissingRPC)
+	}
+
+	return &addr, nil
+}
+
+// Load reads a community config file and adds or replaces the community in the registry
+func (r *Registry) Load(path string) (*Community, error) {
+	addr, err := ReadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Add(ConfigID(path), *addr)
+}
+
+// LoadDir loads all the community config files in a directory
+func (r *Registry) LoadDir(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+ConfigSuffix))
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		_, err := r.Load(path)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Add instantiates a community and adds it to the registry under the provided id, replacing a previous version.
+// The first community added is the default one.
+func (r *Registry) Add(id string, addr CommunityAddress) (*Community, error) {
+	if len(addr.Chain.RPC) == 0 {
+		return nil, fmt.Errorf("%s: %w", id, ErrMissingRPC)
+	}
+
+	es, err := r.service(addr.Chain.RPC[0])
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := New(es, r.key, r.address, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.BalanceTTL > 0 {
+		c.BalanceTTL = r.BalanceTTL
+	}
+
+	c.Breaker = r.Breaker
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	st, err := r.store(id)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Recovery = st.recovery
+	c.Sessions = st.sessions
+	c.Controls = st.controls
+
+	c.Events.Name = id
+	c.Events.Confirmations = r.Confirmations
+
+	// the history of a community without a token would silently miss its transfers
+	if c.Token == (common.Address{}) {
+		slog.Warn("community has no token, its transactions are not indexed", "community", id)
+	} else {
+		c.Index, err = r.index(id)
+		if err != nil {
+			return nil, err
+		}
+
+		c.Events.Subscribe(c.indexLogs)
+	}
+
+	r.communities[id] = c
+	if r.defaultID == "" {
+		r.defaultID = id
+	}
+
+	if r.listenCtx != nil {
+		r.listen(id, c)
+	}
+
+	return c, nil
+}
+
+// Remove removes a community from the registry, the default community is replaced by the first of the others
+func (r *Registry) Remove(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if l, ok := r.listeners[id]; ok {
+		l.stop()
+		delete(r.listeners, id)
+	}
+
+	if idx, ok := r.indexes[id]; ok {
+		idx.Close()
+		delete(r.indexes, id)
+	}
+
+	delete(r.stores, id)
+	delete(r.communities, id)
+
+	if r.defaultID == id {
+		r.defaultID = ""
+
+		for other := range r.communities {
+			if r.defaultID == "" || other < r.defaultID {
+				r.defaultID = other
+			}
+		}
+	}
+}
+
+// Get returns the community with the provided id
+func (r *Registry) Get(id string) (*Community, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	c, ok := r.communities[id]
+	return c, ok
+}
+
+// Default returns the first community that was added to the registry
+func (r *Registry) Default() (*Community, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	c, ok := r.communities[r.defaultID]
+	return c, ok
+}
+
+// IDs returns the sorted ids of all communities in the registry
+func (r *Registry) IDs() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ids := make([]string, 0, len(r.communities))
+	for id := range r.communities {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	return ids
+}
+
+// Export returns the addresses of all communities in the registry by id
+func (r *Registry) Export() map[string]CommunityAddress {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	addrs := make(map[string]CommunityAddress, len(r.communities))
+	for id, c := range r.communities {
+		addrs[id] = c.ExportAddress()
+	}
+
+	return addrs
+}
+
+// Watch reloads community config files in the directory as they are added, modified or removed.
+// Blocks until the context is cancelled.
+func (r *Registry) Watch(ctx context.Context, dir string) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	err = w.Add(dir)
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+
+			slog.Error("community registry watcher", err)
+		case ev, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+
+			if !strings.HasSuffix(ev.Name, ConfigSuffix) {
+				continue
+			}
+
+			id := ConfigID(ev.Name)
+
+			switch {
+			case ev.Has(fsnotify.Remove), ev.Has(fsnotify.Rename):
+				r.Remove(id)
+				slog.Info("community removed", "community", id)
+			case ev.Has(fsnotify.Create), ev.Has(fsnotify.Write):
+				_, err := r.Load(ev.Name)
+				if err != nil {
+					// files are often written in several steps, the next write event will retry
+					slog.Warn("unable to load community", "community", id, slog.ErrorKey, err)
+					continue
+				}
+
+				slog.Info("community loaded", "community", id)
+			}
+		}
+	}
+}
+
+// Listen starts indexing the logs of every community, communities added later are indexed as well.
+// Listeners stop when the context is cancelled.
+func (r *Registry) Listen(ctx context.Context) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.listenCtx = ctx
+
+	for id, c := range r.communities {
+		r.listen(id, c)
+	}
+}
+
+// listen starts the listener of a community, replacing the listener of a previous version, must be called with the lock held
+func (r *Registry) listen(id string, c *Community) {
+	if l, ok := r.listeners[id]; ok {
+		l.stop()
+	}
+
+	ctx, cancel := context.WithCancel(r.listenCtx)
+
+	l := &listener{cancel, make(chan struct{})}
+	r.listeners[id] = l
+
+	go func() {
+		defer close(l.done)
+
+		err := c.Listen(ctx)
+		if err != nil {
+			slog.Error("community listener stopped", err, "community", id)
+		}
+	}()
+}
+
+// index returns the index of a community, opening it if needed, must be called with the lock held
+func (r *Registry) index(id string) (*Index, error) {
+	idx, ok := r.indexes[id]
+	if ok {
+		return idx, nil
+	}
+
+	path := ""
+	if r.DataDir != "" {
+		path = filepath.Join(r.DataDir, id+".index")
+	}
+
+	idx, err := OpenIndex(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r.indexes[id] = idx
+
+	return idx, nil
+}
+
+// store returns the stores of a community, opening them if needed, must be called with the lock held
+func (r *Registry) store(id string) (*stores, error) {
+	st, ok := r.stores[id]
+	if ok {
+		return st, nil
+	}
+
+	if r.DataDir == "" {
+		st = &stores{newRecovery(""), newSessions(""), newControls("")}
+		r.stores[id] = st
+
+		return st, nil
+	}
+
+	recovery, err := NewRecovery(filepath.Join(r.DataDir, id+".recovery.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := NewSessions(filepath.Join(r.DataDir, id+".sessions.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	controls, err := NewControls(filepath.Join(r.DataDir, id+".controls.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	st = &stores{recovery, sessions, controls}
+	r.stores[id] = st
+
+	return st, nil
+}
+
+// Close stops the listeners, once they are done with the batch they are indexing,
+// and closes all the indexes and eth services used by the registry
+func (r *Registry) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, l := range r.listeners {
+		l.stop()
+	}
+
+	for _, idx := range r.indexes {
+		idx.Close()
+	}
+
+	for _, es := range r.services {
+		es.Close()
+	}
+
+	r.listeners = map[string]*listener{}
+	r.indexes = map[string]*Index{}
+	r.stores = map[string]*stores{}
+	r.services = map[string]*ethrequest.EthService{}
+}
+
+// service returns the eth service for an rpc endpoint, communities on the same chain share a service
+func (r *Registry) service(endpoint string) (*ethrequest.EthService, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	es, ok := r.services[endpoint]
+	if ok {
+		return es, nil
+	}
+
+	es, err := ethrequest.NewEthService(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	es.Wallet = r.address
+	es.Config = r.RPC
+	es.Breaker = r.Breaker
+
+	r.services[endpoint] = es
+
+	return es, nil
+}
+
+// WithCommunity returns a context which carries the community
+func WithCommunity(ctx context.Context, c *Community) context.Context {
+	return context.WithValue(ctx, contextKeyCommunity, c)
+}
+
+// FromContext returns the community carried by the context if exists
+func FromContext(ctx context.Context) (*Community, bool) {
+	c, ok := ctx.Value(contextKeyCommunity).(*Community)
+	return c, ok
+}
+
+// Drain waits for the transactions sent by the station to be mined, until the context is done.
+// Returns the transactions which are still pending.
+func (r *Registry) Drain(ctx context.Context) []ethrequest.PendingTx {
+	ticker := time.NewTicker(drainInterval)
+	defer ticker.Stop()
+
+	for {
+		pending := r.pending()
+		if len(pending) == 0 || ctx.Err() != nil {
+			return pending
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		}
+	}
+}
+
+// pending returns the transactions which are not mined yet on every chain
+func (r *Registry) pending() []ethrequest.PendingTx {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	pending := []ethrequest.PendingTx{}
+	for _, es := range r.services {
+		pending = append(pending, es.Pending()...)
+	}
+
+	return pending
+}
+
+// ReportMetrics records the paymaster deposit of each community and the balance of the wallet on each chain
+func (r *Registry) ReportMetrics(ctx context.Context) {
+	r.mu.RLock()
+	communities := make(map[string]*Community, len(r.communities))
+	for id, c := range r.communities {
+		communities[id] = c
+	}
+	r.mu.RUnlock()
+
+	chains := map[int]bool{}
+
+	for id, c := range communities {
+		deposit, err := c.Paymaster.GetDeposit(&bind.CallOpts{Context: ctx})
+		if err != nil {
+			slog.Error("unable to read the paymaster deposit", err, "community", id)
+		} else {
+			metrics.PaymasterDeposit.WithLabelValues(id).Set(metrics.Wei(deposit))
+		}
+
+		if chains[c.Chain.ChainID] {
+			continue
+		}
+
+		balance, err := c.es.BalanceAt(ctx, r.address)
+		if err != nil {
+			slog.Error("unable to read the wallet balance", err, "community", id)
+			continue
+		}
+
+		chains[c.Chain.ChainID] = true
+
+		metrics.WalletBalance.WithLabelValues(strconv.Itoa(c.Chain.ChainID)).Set(metrics.Wei(balance))
+	}
+}
+
+// Ready checks whether every community can serve requests, the registry is not ready without any community
+func (r *Registry) Ready(ctx context.Context) (bool, map[string]Readiness) {
+	r.mu.RLock()
+	communities := make(map[string]*Community, len(r.communities))
+	for id, c := range r.communities {
+		communities[id] = c
+	}
+	r.mu.RUnlock()
+
+	ready := len(communities) > 0
+	results := make(map[string]Readiness, len(communities))
+
+	for id, c := range communities {
+		res := c.Ready(ctx, r.Thresholds)
+
+		ready = ready && res.Ready
+		results[id] = res
+	}
+
+	return ready, results
+}
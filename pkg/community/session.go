@@ -0,0 +1,376 @@
+package community
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/daobrussels/smartcontracts/pkg/contracts/account"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	// erc20TransferABI is the only call a session key is allowed to make
+	erc20TransferABI = `[{"inputs":[{"internalType":"address","name":"to","type":"address"},{"internalType":"uint256","name":"amount","type":"uint256"}],"name":"transfer","outputs":[{"internalType":"bool","name":"","type":"bool"}],"stateMutability":"nonpayable","type":"function"}]`
+
+	// MaxSessionDuration is the longest a session key can be valid for
+	MaxSessionDuration = 7 * 24 * time.Hour
+
+	// SessionSettleTimeout is how long to wait for a session operation to be mined before its spend is kept as is
+	SessionSettleTimeout = 10 * time.Minute
+)
+
+var (
+	ErrInvalidSession  = errors.New("invalid session key")
+	ErrSessionExpired  = errors.New("session key expired")
+	ErrSessionNotFound = errors.New("session key not found")
+	ErrOutOfScope      = errors.New("operation is out of the session key scope")
+
+	ErrSessionKeysUnsupported = errors.New("the accounts of the community do not support session keys")
+)
+
+// SessionKey is a temporary key allowed to transfer a limited amount of a token to a set of recipients on behalf of an account
+type SessionKey struct {
+	Key        common.Address   `json:"key"`
+	Token      common.Address   `json:"token"`
+	Limit      *big.Int         `json:"limit"`
+	Spent      *big.Int         `json:"spent"`
+	Recipients []common.Address `json:"recipients"` // any recipient is allowed when empty
+	Expiry     time.Time        `json:"expiry"`
+}
+
+// Sessions keeps the session keys registered for accounts.
+// When a path is provided the state is persisted to that file.
+type Sessions struct {
+	mu   sync.Mutex
+	path string
+	Keys map[common.Address][]*SessionKey `json:"keys"`
+}
+
+// NewSessions instantiates the session keys, loading them from the file at path if it exists
+func NewSessions(path string) (*Sessions, error) {
+	s := newSessions(path)
+
+	if path == "" {
+		return s, nil
+	}
+
+	err := loadJSON(path, s)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// newSessions instantiates an empty set of session keys
+func newSessions(path string) *Sessions {
+	return &Sessions{
+		path: path,
+		Keys: map[common.Address][]*SessionKey{},
+	}
+}
+
+// List returns the session keys of an account which have not expired
+func (s *Sessions) List(account common.Address) []SessionKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := []SessionKey{}
+	for _, k := range s.Keys[account] {
+		if time.Now().Before(k.Expiry) {
+			keys = append(keys, *k)
+		}
+	}
+
+	return keys
+}
+
+// Register adds a session key to an account, replacing any session with the same key
+func (s *Sessions) Register(account common.Address, key SessionKey) error {
+	if key.Limit == nil || key.Limit.Sign() <= 0 {
+		return ErrInvalidSession
+	}
+
+	if !key.Expiry.After(time.Now()) || time.Until(key.Expiry) > MaxSessionDuration {
+		return ErrInvalidSession
+	}
+
+	key.Spent = big.NewInt(0)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Keys[account] = append(s.remove(account, key.Key), &key)
+
+	return s.save()
+}
+
+// Revoke removes a session key from an account
+func (s *Sessions) Revoke(account, key common.Address) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Keys[account] = s.remove(account, key)
+	if len(s.Keys[account]) == 0 {
+		delete(s.Keys, account)
+	}
+
+	return s.save()
+}
+
+// Spend checks that a transfer is within the scope of a session key and records it
+func (s *Sessions) Spend(account, key, token, to common.Address, amount *big.Int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var session *SessionKey
+	for _, k := range s.Keys[account] {
+		if k.Key == key {
+			session = k
+			break
+		}
+	}
+
+	if session == nil {
+		return ErrSessionNotFound
+	}
+
+	if time.Now().After(session.Expiry) {
+		return ErrSessionExpired
+	}
+
+	if token != session.Token {
+		return ErrOutOfScope
+	}
+
+	if len(session.Recipients) > 0 && !containsAddress(session.Recipients, to) {
+		return ErrOutOfScope
+	}
+
+	spent := new(big.Int).Add(session.Spent, amount)
+	if spent.Cmp(session.Limit) > 0 {
+		return ErrOutOfScope
+	}
+
+	session.Spent = spent
+
+	return s.save()
+}
+
+// Refund gives back an amount recorded by Spend when the operation could not be submitted or failed on chain
+func (s *Sessions) Refund(account, key common.Address, amount *big.Int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, k := range s.Keys[account] {
+		if k.Key == key {
+			k.Spent = new(big.Int).Sub(k.Spent, amount)
+			break
+		}
+	}
+
+	return s.save()
+}
+
+// remove returns the session keys of an account without the provided key, must be called with the lock held
+func (s *Sessions) remove(account, key common.Address) []*SessionKey {
+	keys := []*SessionKey{}
+	for _, k := range s.Keys[account] {
+		// expired keys are cleaned up along the way
+		if k.Key != key && time.Now().Before(k.Expiry) {
+			keys = append(keys, k)
+		}
+	}
+
+	return keys
+}
+
+// save persists the state if a path was provided, must be called with the lock held
+func (s *Sessions) save() error {
+	return saveJSON(s.path, s)
+}
+
+// RegisterSessionKey registers a session key for an account owned by the caller
+func (c *Community) RegisterSessionKey(ctx context.Context, caller, account common.Address, key SessionKey) error {
+	if !c.SessionKeys {
+		return ErrSessionKeysUnsupported
+	}
+
+	ok, err := c.IsAccountOwner(ctx, caller, account)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return ErrNotAccountOwner
+	}
+
+	return c.Sessions.Register(account, key)
+}
+
+// RevokeSessionKey revokes a session key of an account owned by the caller
+func (c *Community) RevokeSessionKey(ctx context.Context, caller, account, key common.Address) error {
+	ok, err := c.IsAccountOwner(ctx, caller, account)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return ErrNotAccountOwner
+	}
+
+	return c.Sessions.Revoke(account, key)
+}
+
+// SubmitSessionOp validates that a user operation signed by a session key stays within its scope and submits it.
+// Only communities whose accounts accept signatures from registered session keys can submit them.
+// The spend is refunded once the operation is mined if it did not succeed on chain.
+func (c *Community) SubmitSessionOp(ctx context.Context, op UserOp) error {
+	if !c.SessionKeys {
+		return ErrSessionKeysUnsupported
+	}
+
+	gop := op.Gateway()
+
+	hash, err := c.Gateway.GetUserOpHash(&bind.CallOpts{Context: ctx}, gop)
+	if err != nil {
+		return err
+	}
+
+	key, err := recoverOpSigner(hash[:], gop.Signature)
+	if err != nil {
+		return ErrInvalidSession
+	}
+
+	token, to, amount, err := decodeSessionTransfer(gop.CallData)
+	if err != nil {
+		return err
+	}
+
+	err = c.Sessions.Spend(gop.Sender, key, token, to, amount)
+	if err != nil {
+		return err
+	}
+
+	tx, err := c.submitUserOp(ctx, op)
+	if err != nil {
+		// the transfer did not happen, it should not count against the limit
+		c.Sessions.Refund(gop.Sender, key, amount)
+		return err
+	}
+
+	if c.DryRun {
+		// the operation is never mined
+		return c.Sessions.Refund(gop.Sender, key, amount)
+	}
+
+	go c.settleSession(gop.Sender, key, amount, hash, tx)
+
+	return nil
+}
+
+// settleSession waits for a session operation to be mined and refunds its spend when it did not succeed
+func (c *Community) settleSession(account, key common.Address, amount *big.Int, hash common.Hash, tx *types.Transaction) {
+	ctx, cancel := context.WithTimeout(context.Background(), SessionSettleTimeout)
+	defer cancel()
+
+	receipt, err := bind.WaitMined(ctx, c.es.Client(), tx)
+	if err != nil {
+		// the outcome is unknown, keeping the spend ensures the limit cannot be exceeded
+		slog.Warn("unable to settle a session operation", "tx", tx.Hash().Hex(), slog.ErrorKey, err)
+		return
+	}
+
+	c.opMined(receipt)
+
+	if c.opSucceeded(receipt, hash) {
+		return
+	}
+
+	err = c.Sessions.Refund(account, key, amount)
+	if err != nil {
+		slog.Error("unable to refund a session key", err, "account", account.Hex(), "key", key.Hex())
+	}
+}
+
+// recoverOpSigner returns the address which signed a user operation hash as an ethereum signed message
+func recoverOpSigner(hash, signature []byte) (common.Address, error) {
+	if len(signature) != crypto.SignatureLength {
+		return common.Address{}, ErrInvalidSession
+	}
+
+	sig := bytes.Clone(signature)
+	if sig[crypto.RecoveryIDOffset] >= 27 {
+		sig[crypto.RecoveryIDOffset] -= 27
+	}
+
+	pub, err := crypto.SigToPub(accounts.TextHash(hash), sig)
+	if err != nil {
+		return common.Address{}, err
+	}
+
+	return crypto.PubkeyToAddress(*pub), nil
+}
+
+// decodeSessionTransfer decodes call data which executes a single token transfer from an account
+func decodeSessionTransfer(calldata []byte) (common.Address, common.Address, *big.Int, error) {
+	accabi, err := account.AccountMetaData.GetAbi()
+	if err != nil {
+		return common.Address{}, common.Address{}, nil, err
+	}
+
+	execute := accabi.Methods["execute"]
+	if len(calldata) < 4 || !bytes.Equal(calldata[:4], execute.ID) {
+		return common.Address{}, common.Address{}, nil, ErrOutOfScope
+	}
+
+	args, err := execute.Inputs.Unpack(calldata[4:])
+	if err != nil {
+		return common.Address{}, common.Address{}, nil, ErrOutOfScope
+	}
+
+	token := args[0].(common.Address)
+	value := args[1].(*big.Int)
+	data := args[2].([]byte)
+
+	// session keys cannot move native currency
+	if value.Sign() != 0 {
+		return common.Address{}, common.Address{}, nil, ErrOutOfScope
+	}
+
+	to, amount, ok := decodeTransfer(data)
+	if !ok {
+		return common.Address{}, common.Address{}, nil, ErrOutOfScope
+	}
+
+	return token, to, amount, nil
+}
+
+// decodeTransfer decodes the recipient and amount of an erc20 transfer, it returns false for any other call
+func decodeTransfer(data []byte) (common.Address, *big.Int, bool) {
+	erc20, err := parseABI(erc20TransferABI)
+	if err != nil {
+		return common.Address{}, nil, false
+	}
+
+	transfer := erc20.Methods["transfer"]
+	if len(data) < 4 || !bytes.Equal(data[:4], transfer.ID) {
+		return common.Address{}, nil, false
+	}
+
+	args, err := transfer.Inputs.Unpack(data[4:])
+	if err != nil {
+		return common.Address{}, nil, false
+	}
+
+	return args[0].(common.Address), args[1].(*big.Int), true
+}
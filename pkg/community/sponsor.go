@@ -0,0 +1,284 @@
+package community
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/daobrussels/smartcontracts/pkg/contracts/accfactory"
+	"github.com/daobrussels/smartcontracts/pkg/contracts/account"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	// DefaultSponsorValidity is how long a sponsorship signature is accepted by the paymaster
+	DefaultSponsorValidity = 10 * time.Minute
+
+	// sponsorClockSkew allows for bundlers whose clock is slightly behind ours
+	sponsorClockSkew = 30 * time.Second
+)
+
+var (
+	ErrSponsorshipDenied    = errors.New("sponsorship denied")
+	ErrNoVerifyingPaymaster = errors.New("the community has no verifying paymaster")
+)
+
+// SponsorLimits caps the gas of the user operations which the station sponsors, nil limits are not enforced
+type SponsorLimits struct {
+	CallGas              *big.Int
+	VerificationGas      *big.Int
+	PreVerificationGas   *big.Int
+	MaxFeePerGas         *big.Int // in wei
+	MaxPriorityFeePerGas *big.Int // in wei
+}
+
+// DefaultSponsorLimits returns limits which cover an account creation followed by a few token transfers
+func DefaultSponsorLimits() SponsorLimits {
+	return SponsorLimits{
+		CallGas:              big.NewInt(500000),
+		VerificationGas:      big.NewInt(1000000),
+		PreVerificationGas:   big.NewInt(100000),
+		MaxFeePerGas:         big.NewInt(500000000000), // 500 gwei
+		MaxPriorityFeePerGas: big.NewInt(50000000000),  // 50 gwei
+	}
+}
+
+var (
+	uint48Ty, _  = abi.NewType("uint48", "", nil)
+	uint256Ty, _ = abi.NewType("uint256", "", nil)
+	addressTy, _ = abi.NewType("address", "", nil)
+	bytes32Ty, _ = abi.NewType("bytes32", "", nil)
+
+	// validity window appended to the paymaster address in paymasterAndData
+	validityArgs = abi.Arguments{
+		{Type: uint48Ty},
+		{Type: uint48Ty},
+	}
+
+	// fields of a user operation which are hashed by the getHash of the verifying paymaster
+	sponsorHashArgs = abi.Arguments{
+		{Type: addressTy}, // sender
+		{Type: uint256Ty}, // nonce
+		{Type: bytes32Ty}, // keccak256(initCode)
+		{Type: bytes32Ty}, // keccak256(callData)
+		{Type: uint256Ty}, // callGasLimit
+		{Type: uint256Ty}, // verificationGasLimit
+		{Type: uint256Ty}, // preVerificationGas
+		{Type: uint256Ty}, // maxFeePerGas
+		{Type: uint256Ty}, // maxPriorityFeePerGas
+		{Type: uint256Ty}, // chainId
+		{Type: addressTy}, // paymaster
+		{Type: uint48Ty},  // validUntil
+		{Type: uint48Ty},  // validAfter
+	}
+)
+
+// Sponsorship is a signed approval from the station to pay for a user operation
+type Sponsorship struct {
+	PaymasterAndData hexutil.Bytes `json:"paymasterAndData"`
+	ValidUntil       uint64        `json:"validUntil"`
+	ValidAfter       uint64        `json:"validAfter"`
+}
+
+// SponsorOp approves a user operation sent by the provided owner and signs the paymasterAndData of the verifying paymaster.
+// The paymaster must be an ERC-4337 VerifyingPaymaster whose signer is the supply wallet, the paymaster of the community
+// is a deposit paymaster which does not check signatures.
+// The resulting user operation can be submitted to any bundler within the validity window.
+func (c *Community) SponsorOp(ctx context.Context, owner common.Address, op UserOp) (*Sponsorship, error) {
+	err := c.Breaker.Check()
+	if err != nil {
+		return nil, err
+	}
+
+	if !c.Controls.Sponsoring() {
+		return nil, ErrSponsorshipPaused
+	}
+
+	if c.VerifyingPaymaster == (common.Address{}) {
+		return nil, ErrNoVerifyingPaymaster
+	}
+
+	err = c.approveSponsorship(ctx, owner, op)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	validAfter := uint64(now.Add(-sponsorClockSkew).Unix())
+	validUntil := uint64(now.Add(c.SponsorValidity).Unix())
+
+	hash, err := c.SponsorHash(op, validUntil, validAfter)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := crypto.Sign(accounts.TextHash(hash.Bytes()), c.key)
+	if err != nil {
+		return nil, err
+	}
+
+	// the contract expects an ethereum style recovery id
+	sig[crypto.RecoveryIDOffset] += 27
+
+	validity, err := validityArgs.Pack(new(big.Int).SetUint64(validUntil), new(big.Int).SetUint64(validAfter))
+	if err != nil {
+		return nil, err
+	}
+
+	data := append(c.VerifyingPaymaster.Bytes(), validity...)
+	data = append(data, sig...)
+
+	return &Sponsorship{
+		PaymasterAndData: data,
+		ValidUntil:       validUntil,
+		ValidAfter:       validAfter,
+	}, nil
+}
+
+// approveSponsorship checks whether the station is willing to pay for the user operation: its gas is capped,
+// it only calls the community token or the allowed targets and it is sent by the owner of the account
+func (c *Community) approveSponsorship(ctx context.Context, owner common.Address, op UserOp) error {
+	gop := op.Gateway()
+
+	l := c.SponsorLimits
+	if exceeds(gop.CallGasLimit, l.CallGas) || exceeds(gop.VerificationGasLimit, l.VerificationGas) || exceeds(gop.PreVerificationGas, l.PreVerificationGas) ||
+		exceeds(gop.MaxFeePerGas, l.MaxFeePerGas) || exceeds(gop.MaxPriorityFeePerGas, l.MaxPriorityFeePerGas) {
+		return ErrSponsorshipDenied
+	}
+
+	targets, err := decodeCallTargets(gop.CallData)
+	if err != nil {
+		return ErrSponsorshipDenied
+	}
+
+	for _, target := range targets {
+		if target != c.Token && !containsAddress(c.SponsorTargets, target) {
+			return ErrSponsorshipDenied
+		}
+	}
+
+	if len(gop.InitCode) > 0 {
+		// the account is being created by our own account factory for the owner
+		created, err := decodeInitCodeOwner(c.afaddr, gop.InitCode)
+		if err != nil || created != owner {
+			return ErrSponsorshipDenied
+		}
+
+		return nil
+	}
+
+	// only the owner of the account can request sponsorship
+	ok, err := c.IsAccountOwner(ctx, owner, op.Sender)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return ErrSponsorshipDenied
+	}
+
+	return nil
+}
+
+// exceeds returns whether a value is above a limit, there is no limit when it is nil
+func exceeds(v, limit *big.Int) bool {
+	return limit != nil && v.Cmp(limit) > 0
+}
+
+// decodeInitCodeOwner returns the owner of an account created by the provided factory with initCode
+func decodeInitCodeOwner(factory common.Address, initCode []byte) (common.Address, error) {
+	if len(initCode) < common.AddressLength || common.BytesToAddress(initCode[:common.AddressLength]) != factory {
+		return common.Address{}, ErrSponsorshipDenied
+	}
+
+	fabi, err := accfactory.AccfactoryMetaData.GetAbi()
+	if err != nil {
+		return common.Address{}, err
+	}
+
+	data := initCode[common.AddressLength:]
+
+	create := fabi.Methods["createAccount"]
+	if len(data) < 4 || !bytes.Equal(data[:4], create.ID) {
+		return common.Address{}, ErrSponsorshipDenied
+	}
+
+	args, err := create.Inputs.Unpack(data[4:])
+	if err != nil {
+		return common.Address{}, ErrSponsorshipDenied
+	}
+
+	return args[0].(common.Address), nil
+}
+
+// decodeCallTargets returns the contracts called by the call data of an account, which cannot send native currency
+func decodeCallTargets(calldata []byte) ([]common.Address, error) {
+	if len(calldata) == 0 {
+		return nil, nil
+	}
+
+	accabi, err := account.AccountMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(calldata) < 4 {
+		return nil, ErrSponsorshipDenied
+	}
+
+	method, err := accabi.MethodById(calldata[:4])
+	if err != nil {
+		return nil, ErrSponsorshipDenied
+	}
+
+	args, err := method.Inputs.Unpack(calldata[4:])
+	if err != nil {
+		return nil, ErrSponsorshipDenied
+	}
+
+	switch method.Name {
+	case "execute":
+		if args[1].(*big.Int).Sign() != 0 {
+			return nil, ErrSponsorshipDenied
+		}
+
+		return []common.Address{args[0].(common.Address)}, nil
+	case "executeBatch":
+		return args[0].([]common.Address), nil
+	}
+
+	return nil, ErrSponsorshipDenied
+}
+
+// SponsorHash returns the hash which the verifying paymaster checks the signature of to approve a user operation
+func (c *Community) SponsorHash(op UserOp, validUntil, validAfter uint64) (common.Hash, error) {
+	gop := op.Gateway()
+
+	b, err := sponsorHashArgs.Pack(
+		gop.Sender,
+		gop.Nonce,
+		[32]byte(crypto.Keccak256Hash(gop.InitCode)),
+		[32]byte(crypto.Keccak256Hash(gop.CallData)),
+		gop.CallGasLimit,
+		gop.VerificationGasLimit,
+		gop.PreVerificationGas,
+		gop.MaxFeePerGas,
+		gop.MaxPriorityFeePerGas,
+		big.NewInt(int64(c.Chain.ChainID)),
+		c.VerifyingPaymaster,
+		new(big.Int).SetUint64(validUntil),
+		new(big.Int).SetUint64(validAfter),
+	)
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	return crypto.Keccak256Hash(b), nil
+}
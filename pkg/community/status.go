@@ -0,0 +1,74 @@
+package community
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ContractCode reports whether a community contract has code on chain
+type ContractCode struct {
+	Name     string         `json:"name"`
+	Address  common.Address `json:"address"`
+	Deployed bool           `json:"deployed"`
+}
+
+// Status is a summary of the funds and ownership of a community
+type Status struct {
+	Supply           common.Address `json:"supply"`
+	SupplyBalance    string         `json:"supplyBalance"`
+	PaymasterDeposit string         `json:"paymasterDeposit"`
+	PaymasterOwner   common.Address `json:"paymasterOwner"`
+}
+
+// Contracts returns the community contract addresses by name
+func (c *Community) Contracts() []ContractCode {
+	return []ContractCode{
+		{Name: ContractGateway, Address: c.EntryPoint},
+		{Name: ContractPaymaster, Address: c.paddr},
+		{Name: ContractAccountFactory, Address: c.afaddr},
+		{Name: ContractGratitudeFactory, Address: c.grfaddr},
+		{Name: ContractProfileFactory, Address: c.prfaddr},
+	}
+}
+
+// VerifyCode checks that code exists at every community contract address
+func (c *Community) VerifyCode(ctx context.Context) ([]ContractCode, error) {
+	contracts := c.Contracts()
+
+	for i, contract := range contracts {
+		code, err := c.es.CodeAt(ctx, contract.Address)
+		if err != nil {
+			return nil, err
+		}
+
+		contracts[i].Deployed = len(code) > 0
+	}
+
+	return contracts, nil
+}
+
+// Status returns the balance of the supply wallet, the paymaster deposit and its owner
+func (c *Community) Status(ctx context.Context) (*Status, error) {
+	balance, err := c.es.BalanceAt(ctx, c.address)
+	if err != nil {
+		return nil, err
+	}
+
+	deposit, err := c.Paymaster.GetDeposit(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return nil, err
+	}
+
+	owner, err := c.Paymaster.Owner(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Status{
+		Supply:           c.address,
+		SupplyBalance:    balance.String(),
+		PaymasterDeposit: deposit.String(),
+		PaymasterOwner:   owner,
+	}, nil
+}
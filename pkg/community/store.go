@@ -0,0 +1,60 @@
+package community
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// loadJSON reads the file at path into v, a missing file leaves v untouched
+func loadJSON(path string, v any) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
+
+// saveJSON writes v to the file at path, nothing is written when path is empty.
+// The file is replaced atomically, a crash leaves either the previous or the new state.
+func saveJSON(path string, v any) error {
+	if path == "" {
+		return nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	// the temporary file must be on the same file system for the rename to be atomic
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(b)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	err = f.Sync()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,384 @@
+package community
+
+import (
+	"context"
+	"errors"
+	"math/big"
+
+	"github.com/daobrussels/smartcontracts/pkg/contracts/paymaster"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	// oracleABI is the interface expected by the paymaster for token price oracles
+	oracleABI = `[{"inputs":[{"internalType":"uint256","name":"ethOutput","type":"uint256"}],"name":"getTokenValueOfEth","outputs":[{"internalType":"uint256","name":"tokenInput","type":"uint256"}],"stateMutability":"view","type":"function"}]`
+
+	// erc20ApproveABI lets the paymaster pull the tokens which are deposited
+	erc20ApproveABI = `[{"inputs":[{"internalType":"address","name":"spender","type":"address"},{"internalType":"uint256","name":"amount","type":"uint256"}],"name":"approve","outputs":[{"internalType":"bool","name":"","type":"bool"}],"stateMutability":"nonpayable","type":"function"}]`
+
+	// paymasterVerificationMul is the number of times the verification gas is charged when a paymaster is used
+	paymasterVerificationMul = 3
+)
+
+var (
+	ErrTokenPaymasterDisabled = errors.New("token paymaster is not configured")
+	ErrNoTokenOracle          = errors.New("token paymaster has no price oracle")
+	ErrNoTreasury             = errors.New("token paymaster has no treasury")
+)
+
+// TokenPaymasterConfig configures the paymaster to charge gas in a community token.
+// The paymaster prices gas with the oracle and charges it to the token deposit of the account, see TokenDepositCalls.
+type TokenPaymasterConfig struct {
+	Token    common.Address `json:"token"`    // community token used to pay for gas
+	Decimals int            `json:"decimals"` // decimals of the community token
+	Oracle   common.Address `json:"oracle"`   // price oracle registered on the paymaster with RegisterPaymasterToken
+	Treasury common.Address `json:"treasury"` // collected fees are swept here
+}
+
+// validate checks that the paymaster can price the token and sweep its fees, it rejects the token without an oracle or a treasury
+func (t *TokenPaymasterConfig) validate() error {
+	if t.Token == (common.Address{}) {
+		return ErrTokenPaymasterDisabled
+	}
+
+	if t.Oracle == (common.Address{}) {
+		return ErrNoTokenOracle
+	}
+
+	if t.Treasury == (common.Address{}) {
+		return ErrNoTreasury
+	}
+
+	return nil
+}
+
+// TokenQuote is the amount of community tokens charged for a user operation
+type TokenQuote struct {
+	Token            common.Address `json:"token"`
+	GasCost          string         `json:"gasCost"`     // maximum cost in wei
+	TokenAmount      string         `json:"tokenAmount"` // maximum cost in tokens
+	PaymasterAndData hexutil.Bytes  `json:"paymasterAndData"`
+	Deposit          TokenDeposit   `json:"deposit"` // deposit of the sender, it must be locked and cover the amount
+}
+
+// TokenDeposit is the amount of community tokens an account deposited in the paymaster to pay for gas
+type TokenDeposit struct {
+	Amount string `json:"amount"`
+	Locked bool   `json:"locked"` // only locked deposits pay for gas
+}
+
+// TokenAccounting summarises the gas paid in community tokens
+type TokenAccounting struct {
+	Token      common.Address `json:"token"`
+	Treasury   common.Address `json:"treasury"`
+	Collected  string         `json:"collected"` // fees collected by the paymaster which have not been swept yet
+	Deposit    string         `json:"deposit"`   // native deposit of the paymaster in the gateway
+	PostOpCost string         `json:"postOpCost"`
+}
+
+// paymasterAndData returns the paymasterAndData used for operations submitted by the station
+func (c *Community) paymasterAndData() []byte {
+	if c.TokenPaymaster == nil {
+		return c.paddr.Bytes()
+	}
+
+	// the token paymaster expects the token address right after its own
+	return append(c.paddr.Bytes(), c.TokenPaymaster.Token.Bytes()...)
+}
+
+// RegisterPaymasterToken adds the community token and its oracle to the paymaster
+func (c *Community) RegisterPaymasterToken(ctx context.Context) error {
+	if c.TokenPaymaster == nil {
+		return ErrTokenPaymasterDisabled
+	}
+
+	auth, err := c.NewTransactor(ctx)
+	if err != nil {
+		return err
+	}
+
+	// get the next nonce for the main wallet
+	nonce, err := c.NextNonce(ctx)
+	if err != nil {
+		return err
+	}
+
+	// set default parameters
+	setDefaultParameters(auth, nonce)
+
+	_, err = c.Paymaster.AddToken(auth, c.TokenPaymaster.Token, c.TokenPaymaster.Oracle)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// QuoteTokenOp returns the maximum amount of community tokens the user operation can be charged
+func (c *Community) QuoteTokenOp(ctx context.Context, op UserOp) (*TokenQuote, error) {
+	if c.TokenPaymaster == nil {
+		return nil, ErrTokenPaymasterDisabled
+	}
+
+	gop := op.Gateway()
+
+	postOp, err := c.Paymaster.COSTOFPOST(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return nil, err
+	}
+
+	// same computation as the gateway's required prefund, plus the post operation
+	gas := new(big.Int).Mul(gop.VerificationGasLimit, big.NewInt(paymasterVerificationMul))
+	gas.Add(gas, gop.CallGasLimit)
+	gas.Add(gas, gop.PreVerificationGas)
+	gas.Add(gas, postOp)
+
+	cost := new(big.Int).Mul(gas, gop.MaxFeePerGas)
+
+	amount, err := c.TokenValueOfWei(ctx, cost)
+	if err != nil {
+		return nil, err
+	}
+
+	deposit, err := c.TokenDepositOf(ctx, gop.Sender)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenQuote{
+		Token:            c.TokenPaymaster.Token,
+		GasCost:          cost.String(),
+		TokenAmount:      amount.String(),
+		PaymasterAndData: c.paymasterAndData(),
+		Deposit:          *deposit,
+	}, nil
+}
+
+// TokenDepositOf returns the community tokens an account deposited in the paymaster
+func (c *Community) TokenDepositOf(ctx context.Context, account common.Address) (*TokenDeposit, error) {
+	if c.TokenPaymaster == nil {
+		return nil, ErrTokenPaymasterDisabled
+	}
+
+	opts := &bind.CallOpts{Context: ctx}
+
+	amount, err := c.Paymaster.Balances(opts, c.TokenPaymaster.Token, account)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock, err := c.Paymaster.UnlockBlock(opts, account)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenDeposit{
+		Amount: amount.String(),
+		Locked: unlock.Sign() == 0,
+	}, nil
+}
+
+// TokenDepositCalls returns the calls an account executes to deposit its own community tokens in the paymaster
+// and lock them, so that they pay for its next operations
+func (c *Community) TokenDepositCalls(account common.Address, amount *big.Int) ([]Call, error) {
+	if c.TokenPaymaster == nil {
+		return nil, ErrTokenPaymasterDisabled
+	}
+
+	approve, err := tokenApproveData(c.paddr, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	pabi, err := paymaster.PaymasterMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+
+	deposit, err := pabi.Pack("addDepositFor", c.TokenPaymaster.Token, account, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	lock, err := pabi.Pack("lockTokenDeposit")
+	if err != nil {
+		return nil, err
+	}
+
+	return []Call{
+		{To: c.TokenPaymaster.Token, Data: approve},
+		{To: c.paddr, Data: deposit},
+		{To: c.paddr, Data: lock},
+	}, nil
+}
+
+// DepositTokensFor deposits community tokens of the supply wallet in the paymaster on behalf of an account,
+// deposits made for another account are locked until that account unlocks them
+func (c *Community) DepositTokensFor(ctx context.Context, account common.Address, amount *big.Int) error {
+	if c.TokenPaymaster == nil {
+		return ErrTokenPaymasterDisabled
+	}
+
+	approve, err := tokenApproveData(c.paddr, amount)
+	if err != nil {
+		return err
+	}
+
+	auth, err := c.NewTransactor(ctx)
+	if err != nil {
+		return err
+	}
+
+	// get the next nonce for the main wallet
+	nonce, err := c.NextNonce(ctx)
+	if err != nil {
+		return err
+	}
+
+	// set default parameters
+	setDefaultParameters(auth, nonce)
+
+	token := bind.NewBoundContract(c.TokenPaymaster.Token, abi.ABI{}, c.es.Client(), c.es.Client(), nil)
+
+	tx, err := token.RawTransact(auth, approve)
+	if err != nil {
+		return err
+	}
+
+	// the deposit is estimated against the allowance, which is never set in a dry run
+	if c.DryRun {
+		c.dryRunUnestimated = append(c.dryRunUnestimated, UnestimatedTx{
+			To:     c.paddr,
+			Method: "addDepositFor",
+			Reason: "the approval of the paymaster must be mined first",
+		})
+
+		return nil
+	}
+
+	receipt, err := bind.WaitMined(ctx, c.es.Client(), tx)
+	if err != nil {
+		return err
+	}
+
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return errors.New("approval of the paymaster reverted")
+	}
+
+	setDefaultParameters(auth, nonce+1)
+
+	_, err = c.Paymaster.AddDepositFor(auth, c.TokenPaymaster.Token, account, amount)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// tokenApproveData returns the call data which allows a spender to transfer an amount of tokens
+func tokenApproveData(spender common.Address, amount *big.Int) ([]byte, error) {
+	erc20, err := parseABI(erc20ApproveABI)
+	if err != nil {
+		return nil, err
+	}
+
+	return erc20.Pack("approve", spender, amount)
+}
+
+// TokenValueOfWei converts an amount of wei to community tokens with the oracle, the price the paymaster charges
+func (c *Community) TokenValueOfWei(ctx context.Context, wei *big.Int) (*big.Int, error) {
+	if c.TokenPaymaster == nil {
+		return nil, ErrTokenPaymasterDisabled
+	}
+
+	parsed, err := parseABI(oracleABI)
+	if err != nil {
+		return nil, err
+	}
+
+	oracle := bind.NewBoundContract(c.TokenPaymaster.Oracle, *parsed, c.es.Client(), nil, nil)
+
+	var out []any
+	err = oracle.Call(&bind.CallOpts{Context: ctx}, &out, "getTokenValueOfEth", wei)
+	if err != nil {
+		return nil, err
+	}
+
+	return *abi.ConvertType(out[0], new(*big.Int)).(**big.Int), nil
+}
+
+// TokenAccounting returns the fees collected by the token paymaster
+func (c *Community) TokenAccounting(ctx context.Context) (*TokenAccounting, error) {
+	if c.TokenPaymaster == nil {
+		return nil, ErrTokenPaymasterDisabled
+	}
+
+	collected, err := c.collectedTokenFees(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deposit, err := c.Paymaster.GetDeposit(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return nil, err
+	}
+
+	postOp, err := c.Paymaster.COSTOFPOST(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenAccounting{
+		Token:      c.TokenPaymaster.Token,
+		Treasury:   c.TokenPaymaster.Treasury,
+		Collected:  collected.String(),
+		Deposit:    deposit.String(),
+		PostOpCost: postOp.String(),
+	}, nil
+}
+
+// SweepTokenFees transfers the fees collected by the paymaster to the treasury, returns the amount swept
+func (c *Community) SweepTokenFees(ctx context.Context) (*big.Int, error) {
+	if c.TokenPaymaster == nil {
+		return nil, ErrTokenPaymasterDisabled
+	}
+
+	collected, err := c.collectedTokenFees(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if collected.Sign() == 0 {
+		return collected, nil
+	}
+
+	auth, err := c.NewTransactor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// get the next nonce for the main wallet
+	nonce, err := c.NextNonce(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// set default parameters
+	setDefaultParameters(auth, nonce)
+
+	_, err = c.Paymaster.WithdrawTokensTo(auth, c.TokenPaymaster.Token, c.TokenPaymaster.Treasury, collected)
+	if err != nil {
+		return nil, err
+	}
+
+	return collected, nil
+}
+
+// collectedTokenFees returns the token balance the paymaster holds on behalf of its owner
+func (c *Community) collectedTokenFees(ctx context.Context) (*big.Int, error) {
+	return c.Paymaster.Balances(&bind.CallOpts{Context: ctx}, c.TokenPaymaster.Token, c.address)
+}
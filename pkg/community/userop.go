@@ -0,0 +1,61 @@
+package community
+
+import (
+	"math/big"
+
+	"github.com/daobrussels/smartcontracts/pkg/contracts/account"
+	"github.com/daobrussels/smartcontracts/pkg/contracts/gateway"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// UserOp is the json representation of an ERC-4337 user operation
+type UserOp struct {
+	Sender               common.Address `json:"sender"`
+	Nonce                *hexutil.Big   `json:"nonce"`
+	InitCode             hexutil.Bytes  `json:"initCode"`
+	CallData             hexutil.Bytes  `json:"callData"`
+	CallGasLimit         *hexutil.Big   `json:"callGasLimit"`
+	VerificationGasLimit *hexutil.Big   `json:"verificationGasLimit"`
+	PreVerificationGas   *hexutil.Big   `json:"preVerificationGas"`
+	MaxFeePerGas         *hexutil.Big   `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas *hexutil.Big   `json:"maxPriorityFeePerGas"`
+	PaymasterAndData     hexutil.Bytes  `json:"paymasterAndData"`
+	Signature            hexutil.Bytes  `json:"signature"`
+}
+
+// Gateway converts the user operation to the type expected by the gateway contract
+func (op *UserOp) Gateway() gateway.UserOperation {
+	return gateway.UserOperation{
+		Sender:               op.Sender,
+		Nonce:                toBig(op.Nonce),
+		InitCode:             op.InitCode,
+		CallData:             op.CallData,
+		CallGasLimit:         toBig(op.CallGasLimit),
+		VerificationGasLimit: toBig(op.VerificationGasLimit),
+		PreVerificationGas:   toBig(op.PreVerificationGas),
+		MaxFeePerGas:         toBig(op.MaxFeePerGas),
+		MaxPriorityFeePerGas: toBig(op.MaxPriorityFeePerGas),
+		PaymasterAndData:     op.PaymasterAndData,
+		Signature:            op.Signature,
+	}
+}
+
+// toBig returns the big.Int value of a hexutil.Big, nil values are treated as 0
+func toBig(b *hexutil.Big) *big.Int {
+	if b == nil {
+		return big.NewInt(0)
+	}
+
+	return b.ToInt()
+}
+
+// ExecuteCallData returns the call data for an account to call the target contract
+func ExecuteCallData(target common.Address, value *big.Int, data []byte) ([]byte, error) {
+	abi, err := account.AccountMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+
+	return abi.Pack("execute", target, value, data)
+}
@@ -11,6 +11,10 @@ const (
 	PubKeyHeader = "X-PubKey"
 	// AddressHeader is the header that contains the address of the sender
 	AddressHeader = "X-Address"
+	// RequestIDHeader is the header that contains the id of the request, it is echoed in the response
+	RequestIDHeader = "X-Request-ID"
+	// ExpiryHeader is the header that contains the expiry of a signed request without a body
+	ExpiryHeader = "X-Expiry"
 )
 
 type ContextKey string
@@ -0,0 +1,217 @@
+package events
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/daobrussels/cw/pkg/common/ethrequest"
+	"github.com/daobrussels/cw/pkg/metrics"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	// DefaultInterval is how often the chain is polled for new logs
+	DefaultInterval = 5 * time.Second
+
+	// DefaultBatchSize is the maximum number of blocks queried at once
+	DefaultBatchSize = 1000
+
+	// DefaultConfirmations is how many blocks are left between the head of the chain and the logs which are handled
+	DefaultConfirmations = 12
+)
+
+// Log is a log emitted on chain along with the time of its block
+type Log struct {
+	types.Log
+	Time time.Time `json:"time"`
+}
+
+// Batch are the logs of a range of blocks, in the order they were emitted
+type Batch struct {
+	FromBlock uint64
+	ToBlock   uint64
+	Logs      []Log
+}
+
+// Handler receives batches in order, a returned error causes the batch to be delivered again
+type Handler func(b Batch) error
+
+// Listener polls the chain for the logs matching a query and hands them to its subscribers
+type Listener struct {
+	es *ethrequest.EthService
+
+	qmu   sync.Mutex
+	query ethereum.FilterQuery
+
+	// Name identifies the listener in its metrics
+	Name string
+
+	Interval  time.Duration
+	BatchSize uint64
+
+	// Confirmations keeps the most recent blocks from being handled, their logs could still be removed by a reorganisation
+	Confirmations uint64
+
+	mu   sync.RWMutex
+	subs []Handler
+}
+
+// NewListener instantiates a listener for the logs matching the addresses and topics of the query, block ranges are ignored
+func NewListener(es *ethrequest.EthService, query ethereum.FilterQuery) *Listener {
+	return &Listener{
+		es:            es,
+		query:         query,
+		Interval:      DefaultInterval,
+		BatchSize:     DefaultBatchSize,
+		Confirmations: DefaultConfirmations,
+	}
+}
+
+// Subscribe adds a handler which receives all logs from now on
+func (l *Listener) Subscribe(h Handler) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.subs = append(l.subs, h)
+}
+
+// Watch adds contracts to the addresses of the query, their logs are handled from the next batch on.
+// Subscribers can call it while handling a batch.
+func (l *Listener) Watch(addrs ...common.Address) {
+	l.qmu.Lock()
+	defer l.qmu.Unlock()
+
+	l.query.Addresses = append(append([]common.Address{}, l.query.Addresses...), addrs...)
+}
+
+// Listen polls the chain for logs starting at the provided block.
+// The position only moves forward once all subscribers have handled a range. Blocks until the context is cancelled.
+func (l *Listener) Listen(ctx context.Context, from uint64) error {
+	ticker := time.NewTicker(l.Interval)
+	defer ticker.Stop()
+
+	for {
+		next, err := l.poll(ctx, from)
+		if err != nil {
+			// the range is retried on the next tick
+			slog.Warn("unable to poll logs", "listener", l.Name, "from", from, slog.ErrorKey, err)
+		}
+
+		from = next
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll handles the logs from the provided block up to the confirmed head of the chain and returns the next block to poll from
+func (l *Listener) poll(ctx context.Context, from uint64) (uint64, error) {
+	head, err := l.es.BlockNumber(ctx)
+	if err != nil {
+		return from, err
+	}
+
+	// only blocks with enough confirmations are handled
+	if head < l.Confirmations {
+		return from, nil
+	}
+
+	head -= l.Confirmations
+
+	l.reportLag(head, from)
+
+	for from <= head {
+		if ctx.Err() != nil {
+			return from, nil
+		}
+
+		to := from + l.BatchSize - 1
+		if to > head {
+			to = head
+		}
+
+		l.qmu.Lock()
+		q := l.query
+		l.qmu.Unlock()
+
+		q.FromBlock = new(big.Int).SetUint64(from)
+		q.ToBlock = new(big.Int).SetUint64(to)
+
+		logs, err := l.es.FilterLogs(ctx, q)
+		if err != nil {
+			return from, err
+		}
+
+		timed, err := l.withTime(ctx, logs)
+		if err != nil {
+			return from, err
+		}
+
+		err = l.dispatch(Batch{from, to, timed})
+		if err != nil {
+			return from, err
+		}
+
+		from = to + 1
+
+		l.reportLag(head, from)
+	}
+
+	return from, nil
+}
+
+// reportLag records how many blocks up to the head remain to be handled
+func (l *Listener) reportLag(head, next uint64) {
+	lag := uint64(0)
+	if next <= head {
+		lag = head - next + 1
+	}
+
+	metrics.ListenerLag.WithLabelValues(l.Name).Set(float64(lag))
+}
+
+// withTime attaches the time of their block to logs
+func (l *Listener) withTime(ctx context.Context, logs []types.Log) ([]Log, error) {
+	times := map[uint64]time.Time{}
+
+	timed := make([]Log, len(logs))
+	for i, lg := range logs {
+		t, ok := times[lg.BlockNumber]
+		if !ok {
+			ts, err := l.es.BlockTime(ctx, lg.BlockNumber)
+			if err != nil {
+				return nil, err
+			}
+
+			t = time.Unix(int64(ts), 0).UTC()
+			times[lg.BlockNumber] = t
+		}
+
+		timed[i] = Log{lg, t}
+	}
+
+	return timed, nil
+}
+
+// dispatch hands a batch to all subscribers
+func (l *Listener) dispatch(b Batch) error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for _, h := range l.subs {
+		err := h(b)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -24,11 +24,12 @@ func NewHandlers(chain cw.ChainConfig, r *response.Responder) *Handlers {
 }
 
 // Hello returns returns the local chain configuration and signs the response.
-// Allows for clients to verify the response and respond using the public key of the sender
+// Allows for clients to verify the response and respond using the public key of the sender.
+// Clients which did not send their public key receive the configuration in the clear.
 func (h *Handlers) Hello(w http.ResponseWriter, r *http.Request) {
-	err := h.responder.EncryptedBody(w, r.Context(), h.chain)
+	err := h.responder.PublicBody(w, r.Context(), h.chain)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.responder.Error(w, r.Context(), err)
 		return
 	}
 }
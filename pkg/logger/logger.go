@@ -0,0 +1,73 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"golang.org/x/exp/slog"
+)
+
+// formats of the log records
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+type contextKey string
+
+const (
+	contextKeyLogger    contextKey = "logger"
+	contextKeyRequestID contextKey = "requestID"
+)
+
+// Setup sets the default logger, records below the level are discarded
+func Setup(w io.Writer, format, level string) error {
+	var l slog.Level
+
+	err := l.UnmarshalText([]byte(level))
+	if err != nil {
+		return err
+	}
+
+	opts := slog.HandlerOptions{Level: l}
+
+	switch format {
+	case FormatText:
+		slog.SetDefault(slog.New(opts.NewTextHandler(w)))
+	case FormatJSON:
+		slog.SetDefault(slog.New(opts.NewJSONHandler(w)))
+	default:
+		return fmt.Errorf("unknown log format %s", format)
+	}
+
+	return nil
+}
+
+// From returns the logger of the context, the default logger when there is none
+func From(ctx context.Context) *slog.Logger {
+	l, ok := ctx.Value(contextKeyLogger).(*slog.Logger)
+	if !ok {
+		return slog.Default()
+	}
+
+	return l
+}
+
+// With returns a context whose logger attaches the provided attributes to every record
+func With(ctx context.Context, args ...any) context.Context {
+	return context.WithValue(ctx, contextKeyLogger, From(ctx).With(args...))
+}
+
+// WithRequestID returns a context carrying a request id, which its logger attaches to every record
+func WithRequestID(ctx context.Context, id string) context.Context {
+	ctx = context.WithValue(ctx, contextKeyRequestID, id)
+
+	return With(ctx, "request_id", id)
+}
+
+// RequestID returns the request id carried by the context
+func RequestID(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(contextKeyRequestID).(string)
+	return id, ok
+}
@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"fmt"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "cw"
+
+// statuses of the transactions sent by the station
+const (
+	TxSubmitted = "submitted"
+	TxMined     = "mined"
+	TxReverted  = "reverted"
+)
+
+var (
+	Requests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Requests handled by route, method and status.",
+	}, []string{"route", "method", "status"})
+
+	RequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to handle requests by route and method.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"route", "method"})
+
+	SignatureFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "signature_failures_total",
+		Help:      "Requests rejected by the signature verification by reason.",
+	}, []string{"reason"})
+
+	RateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_total",
+		Help:      "Requests rejected by the rate limiter by route and reason.",
+	}, []string{"route", "reason"})
+
+	Transactions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "transactions_total",
+		Help:      "Transactions sent to the chain by status: submitted, mined or reverted.",
+	}, []string{"chain", "status"})
+
+	GasSpent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "supply_wallet_gas_spent_wei_total",
+		Help:      "Gas fees paid by the supply wallet in wei.",
+	}, []string{"chain"})
+
+	WalletBalance = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "supply_wallet_balance_wei",
+		Help:      "Native balance of the supply wallet in wei.",
+	}, []string{"chain"})
+
+	PaymasterDeposit = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "paymaster_deposit_wei",
+		Help:      "Deposit of the paymaster of a community in the entry point in wei.",
+	}, []string{"community"})
+
+	RPCErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rpc_errors_total",
+		Help:      "Failed json-rpc calls by endpoint host and method.",
+	}, []string{"endpoint", "method"})
+
+	Paused = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "paused",
+		Help:      "1 while the station is paused and does not spend, 0 otherwise.",
+	})
+
+	ListenerLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "listener_lag_blocks",
+		Help:      "Blocks between the head of the chain and the last block handled by an event listener.",
+	}, []string{"listener"})
+)
+
+// Wei converts an amount in wei for a metric, precision is lost above 2^53
+func Wei(amount *big.Int) float64 {
+	f, _ := new(big.Float).SetInt(amount).Float64()
+	return f
+}
+
+// NewServer returns a server which serves the metrics under /metrics
+func NewServer(port int) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	return &http.Server{
+		Addr:              fmt.Sprintf(":%v", port),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+}
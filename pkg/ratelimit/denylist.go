@@ -0,0 +1,122 @@
+package ratelimit
+
+import (
+	"bufio"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Denylist is a set of ips, public keys and addresses whose requests are rejected, it can be changed at runtime.
+// Entries added at runtime are kept apart from the ones of the file, so that reloading the file does not drop them.
+type Denylist struct {
+	mu      sync.RWMutex
+	entries map[string]bool // loaded from the file
+	added   map[string]bool // added at runtime
+}
+
+// NewDenylist instantiates an empty denylist
+func NewDenylist() *Denylist {
+	return &Denylist{
+		entries: map[string]bool{},
+		added:   map[string]bool{},
+	}
+}
+
+// normalize returns the form of an entry which is compared, hex values are case insensitive
+func normalize(entry string) string {
+	return strings.ToLower(strings.TrimSpace(entry))
+}
+
+// Add denies entries
+func (d *Denylist) Add(entries ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, e := range entries {
+		d.added[normalize(e)] = true
+	}
+}
+
+// Remove allows entries again, entries of the file are denied again when it is reloaded
+func (d *Denylist) Remove(entries ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, e := range entries {
+		delete(d.entries, normalize(e))
+		delete(d.added, normalize(e))
+	}
+}
+
+// Contains returns whether any of the non empty values is denied
+func (d *Denylist) Contains(values ...string) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	for _, v := range values {
+		if v == "" {
+			continue
+		}
+
+		if n := normalize(v); d.entries[n] || d.added[n] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// List returns the denied entries, sorted
+func (d *Denylist) List() []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	list := make([]string, 0, len(d.entries)+len(d.added))
+	for e := range d.entries {
+		list = append(list, e)
+	}
+
+	for e := range d.added {
+		if !d.entries[e] {
+			list = append(list, e)
+		}
+	}
+
+	sort.Strings(list)
+
+	return list
+}
+
+// Load replaces the entries of the file with the ones it now holds, one per line, lines starting with # are ignored
+func (d *Denylist) Load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	entries := map[string]bool{}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := normalize(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		entries[line] = true
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	d.entries = entries
+	d.mu.Unlock()
+
+	return nil
+}
@@ -0,0 +1,173 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+)
+
+// names of the routes with their own limits, requests to other routes only get the default limits
+const (
+	RouteAccount     = "account"     // account and profile creation, paid by the station
+	RouteOp          = "op"          // operation submission, paid by the paymaster
+	RouteSponsor     = "sponsor"     // paymaster sponsorship
+	RouteGratitude   = "gratitude"   // gratitude app creation and minting
+	RouteTransaction = "transaction" // forwarding of signed transactions
+)
+
+var (
+	ErrDenied = errors.New("the sender of the request is denied")
+)
+
+// Limit is a token bucket, which holds up to Burst requests and refills at Rate requests per second
+type Limit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+// Policy is the limits of a route for each kind of requester, requesters without a limit are not limited
+type Policy struct {
+	IP      *Limit `json:"ip,omitempty"`
+	PubKey  *Limit `json:"pubkey,omitempty"`
+	Address *Limit `json:"address,omitempty"` // signer of the request, only known once its signature is verified
+}
+
+// Config is the default policy, applied to every request before its signature is verified, and the policies of routes
+type Config struct {
+	Default Policy            `json:"default"`
+	Routes  map[string]Policy `json:"routes"`
+}
+
+// Requester identifies the sender of a request, unknown parts are empty
+type Requester struct {
+	IP      string
+	PubKey  string
+	Address string
+}
+
+// Store keeps the token buckets, a shared store lets several stations enforce the same limits
+type Store interface {
+	// Take takes a token from the bucket of the key, it returns false along with how long until one is available when empty
+	Take(ctx context.Context, key string, l Limit) (bool, time.Duration, error)
+}
+
+// DefaultConfig returns limits which keep a single requester from draining the supply wallet or the paymaster
+func DefaultConfig() Config {
+	return Config{
+		Default: Policy{
+			IP:     &Limit{Rate: 20, Burst: 40},
+			PubKey: &Limit{Rate: 10, Burst: 20},
+		},
+		Routes: map[string]Policy{
+			RouteAccount: {
+				IP:      &Limit{Rate: 1.0 / 60, Burst: 10},
+				Address: &Limit{Rate: 1.0 / 600, Burst: 3},
+			},
+			RouteOp: {
+				Address: &Limit{Rate: 1, Burst: 5},
+			},
+			RouteSponsor: {
+				Address: &Limit{Rate: 1, Burst: 5},
+			},
+			RouteGratitude: {
+				Address: &Limit{Rate: 0.2, Burst: 5},
+			},
+			RouteTransaction: {
+				IP:     &Limit{Rate: 0.2, Burst: 5},
+				PubKey: &Limit{Rate: 0.2, Burst: 5},
+			},
+		},
+	}
+}
+
+// ReadConfig reads limits from a json file, routes which it does not mention keep their default limits
+func ReadConfig(path string) (Config, error) {
+	conf := DefaultConfig()
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return conf, err
+	}
+
+	var file Config
+	err = json.Unmarshal(b, &file)
+	if err != nil {
+		return conf, err
+	}
+
+	if file.Default != (Policy{}) {
+		conf.Default = file.Default
+	}
+
+	for route, p := range file.Routes {
+		conf.Routes[route] = p
+	}
+
+	return conf, nil
+}
+
+// Limiter limits the requests of each requester by route and rejects denied requesters
+type Limiter struct {
+	store Store
+	conf  Config
+
+	// Denylist is the requesters whose requests are rejected
+	Denylist *Denylist
+}
+
+// New instantiates a limiter keeping its buckets in the provided store
+func New(store Store, conf Config) *Limiter {
+	return &Limiter{
+		store:    store,
+		conf:     conf,
+		Denylist: NewDenylist(),
+	}
+}
+
+// Allow takes a token for each part of the requester which the policy of the route limits.
+// It returns ErrDenied when the requester is denied, and false with how long until it can retry when it is limited.
+// An empty route applies the default policy.
+func (l *Limiter) Allow(ctx context.Context, route string, req Requester) (bool, time.Duration, error) {
+	if l.Denylist.Contains(req.IP, req.PubKey, req.Address) {
+		return false, 0, ErrDenied
+	}
+
+	p := l.conf.Default
+	if route != "" {
+		var ok bool
+
+		p, ok = l.conf.Routes[route]
+		if !ok {
+			return true, 0, nil
+		}
+	}
+
+	limits := []struct {
+		kind  string
+		value string
+		limit *Limit
+	}{
+		{"ip", req.IP, p.IP},
+		{"pubkey", req.PubKey, p.PubKey},
+		{"address", req.Address, p.Address},
+	}
+
+	for _, lim := range limits {
+		if lim.limit == nil || lim.value == "" {
+			continue
+		}
+
+		ok, retry, err := l.store.Take(ctx, route+"|"+lim.kind+"|"+normalize(lim.value), *lim.limit)
+		if err != nil {
+			return false, 0, err
+		}
+
+		if !ok {
+			return false, retry, nil
+		}
+	}
+
+	return true, 0, nil
+}
@@ -3,19 +3,33 @@ package router
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/daobrussels/cw/pkg/auth"
+	"github.com/daobrussels/cw/pkg/breaker"
 	"github.com/daobrussels/cw/pkg/common/request"
+	"github.com/daobrussels/cw/pkg/common/response"
+	"github.com/daobrussels/cw/pkg/community"
 	"github.com/daobrussels/cw/pkg/cw"
+	"github.com/daobrussels/cw/pkg/logger"
+	"github.com/daobrussels/cw/pkg/metrics"
+	"github.com/daobrussels/cw/pkg/ratelimit"
+	"github.com/daobrussels/cw/pkg/server"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
 )
 
 var (
-	options sync.Map
-
 	allMethods = []string{
 		http.MethodGet,
 		http.MethodPost,
@@ -32,47 +46,352 @@ var (
 		"Accept-Encoding",
 		cw.SignatureHeader,
 		cw.PubKeyHeader,
+		cw.RequestIDHeader,
+		cw.AddressHeader,
+		cw.ExpiryHeader,
+	}
+
+	exposedHeaders = []string{
+		cw.SignatureHeader,
+		cw.PubKeyHeader,
+		cw.RequestIDHeader,
 	}
 )
 
-// HealthMiddleware is a middleware that responds to health checks
-func HealthMiddleware(next http.Handler) http.Handler {
+// maxRequestIDLength is the maximum length of a request id provided by a client
+const maxRequestIDLength = 128
+
+// statuses reported by the health checks
+const (
+	HealthOK          = "ok"
+	HealthDegraded    = "degraded"    // the station serves reads but does not send transactions
+	HealthUnavailable = "unavailable" // a community cannot serve requests
+)
+
+const (
+	// readyTimeout bounds the checks of a readiness probe
+	readyTimeout = 10 * time.Second
+
+	// readyTTL is how long the result of the checks is reused, probes are public and the checks call the chain
+	readyTTL = 5 * time.Second
+)
+
+// Health is the body of a health check response
+type Health struct {
+	Status      string                         `json:"status"`
+	Pause       *breaker.State                 `json:"pause,omitempty"`
+	Communities map[string]community.Readiness `json:"communities,omitempty"`
+}
+
+// createHealthMiddleware responds to health checks.
+// /health/live only tells that the station is up, /health reports it degraded while it is paused
+// and /health/ready checks the chain and the funds of every community.
+func createHealthMiddleware(reg *community.Registry) func(next http.Handler) http.Handler {
+	var (
+		mu      sync.Mutex
+		checked time.Time
+		ready   bool
+		results map[string]community.Readiness
+	)
+
+	// check runs the readiness checks unless they ran recently, concurrent probes wait for the same checks.
+	// The checks are shared by the probes, a probe which hangs up does not cancel them.
+	check := func() (bool, map[string]community.Readiness) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if time.Since(checked) < readyTTL {
+			return ready, results
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), readyTimeout)
+		defer cancel()
+
+		ready, results = reg.Ready(ctx)
+		checked = time.Now()
+
+		return ready, results
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := Health{Status: HealthOK}
+			status := http.StatusOK
+
+			switch r.URL.Path {
+			case "/health/live":
+				w.WriteHeader(http.StatusOK)
+				return
+			case "/health":
+			case "/health/ready":
+				var ready bool
+
+				ready, h.Communities = check()
+				if !ready {
+					h.Status = HealthUnavailable
+					status = http.StatusServiceUnavailable
+				}
+			default:
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if state := reg.Breaker.State(); state.Paused {
+				h.Pause = &state
+
+				if h.Status == HealthOK {
+					h.Status = HealthDegraded
+				}
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(h)
+		})
+	}
+}
+
+// RequestIDMiddleware tags a request with an id, the one provided by the client when it is sane.
+// The id is returned in the response and attached to every record logged while serving the request.
+func RequestIDMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path == "/health" {
-			w.WriteHeader(http.StatusOK)
-			return
+		start := time.Now()
+
+		id := r.Header.Get(cw.RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+
+		w.Header().Set(cw.RequestIDHeader, id)
+
+		ctx := logger.WithRequestID(r.Context(), id)
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		logger.From(ctx).Info("request served",
+			"method", r.Method,
+			"route", chi.RouteContext(r.Context()).RoutePattern(),
+			"path", r.URL.Path,
+			"status", status,
+			"duration", time.Since(start),
+		)
+	})
+}
+
+// validRequestID returns whether a request id can be used as is, it ends up in logs and headers
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
 		}
+	}
 
-		next.ServeHTTP(w, r)
+	return true
+}
+
+// MetricsMiddleware records the count and latency of requests by route
+func MetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		// the pattern is known once the request has been routed
+		route := chi.RouteContext(r.Context()).RoutePattern()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		metrics.Requests.WithLabelValues(route, r.Method, strconv.Itoa(status)).Inc()
+		metrics.RequestDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
 	})
 }
 
+// createRateLimitMiddleware rejects requests from denied requesters and limits requests with the policy of a route.
+// The empty route applies the default policy, before the signature is verified the signer of a request is unknown.
+// Requests are let through when the store of the limiter fails.
+func createRateLimitMiddleware(rl *ratelimit.Limiter, route string) func(next http.Handler) http.Handler {
+	name := route
+	if name == "" {
+		name = "default"
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			req := ratelimit.Requester{
+				IP:     clientIP(r),
+				PubKey: r.Header.Get(cw.PubKeyHeader),
+			}
+
+			if addr, ok := cw.GetAddressFromContext(r.Context()); ok {
+				req.Address = addr
+			}
+
+			ok, retry, err := rl.Allow(r.Context(), route, req)
+			switch {
+			case errors.Is(err, ratelimit.ErrDenied):
+				metrics.RateLimited.WithLabelValues(name, "denied").Inc()
+				response.WriteError(w, response.Forbidden(err))
+				return
+			case err != nil:
+				logger.From(r.Context()).Error("unable to apply the rate limit", err, "route", name)
+			case !ok:
+				metrics.RateLimited.WithLabelValues(name, "limited").Inc()
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+				response.WriteError(w, response.RateLimited(retry))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientIP returns the ip of the client of a request
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		// RealIP sets the remote address without a port
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// createStreamMiddleware lifts the write timeout of long lived streams and ends them when done is closed
+func createStreamMiddleware(done <-chan struct{}) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !isStream(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// must happen before the response writer is wrapped by other middleware
+			http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+			ctx, cancel := context.WithCancel(r.Context())
+			defer cancel()
+
+			go func() {
+				select {
+				case <-done:
+					cancel()
+				case <-ctx.Done():
+				}
+			}()
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// isStream returns whether a request opens a server-sent events stream or a websocket
+func isStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream") ||
+		strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// createDefaultCommunityMiddleware scopes requests to the default community of the registry
+func createDefaultCommunityMiddleware(reg *community.Registry) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c, ok := reg.Default()
+			if !ok {
+				response.WriteError(w, response.NotFound(community.ErrCommunityNotFound))
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(community.WithCommunity(r.Context(), c)))
+		})
+	}
+}
+
+// createCommunityMiddleware scopes requests to the community matching the {id} url parameter
+func createCommunityMiddleware(reg *community.Registry) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c, ok := reg.Get(chi.URLParam(r, "id"))
+			if !ok {
+				response.WriteError(w, response.NotFound(community.ErrCommunityNotFound))
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(community.WithCommunity(r.Context(), c)))
+		})
+	}
+}
+
 type secureRequest struct {
 	Secure string `json:"secure"`
 }
 
-// SignatureMiddleware is a middleware that checks the signature of the request against the request body
+// createSignatureMiddleware verifies the signature of signed requests and puts their signer in the context.
+// Requests with a body are signed and encrypted in the body, requests without one sign their method and uri in headers.
+// Unsigned requests are let through, the policy of their route decides whether they are served.
 func createSignatureMiddleware(hexkey string) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// retrieve request signature
+			signature := r.Header.Get(cw.SignatureHeader)
+
 			pubkey := r.Header.Get(cw.PubKeyHeader)
 			if pubkey == "" {
-				w.WriteHeader(http.StatusUnauthorized)
+				// responses to signed requests are encrypted for the public key of the client
+				if signature != "" {
+					metrics.SignatureFailures.WithLabelValues("missing_pubkey").Inc()
+					response.WriteError(w, response.ErrUnauthorized)
+					return
+				}
+
+				next.ServeHTTP(w, r)
 				return
 			}
 
 			ctx := context.WithValue(r.Context(), cw.ContextKeyPubKey, pubkey)
 
-			if r.Method == http.MethodGet || strings.Contains(r.URL.Path, "/gateway") {
-				// GET requests are not signed
+			if signature == "" {
 				next.ServeHTTP(w, r.WithContext(ctx))
 				return
 			}
 
-			// retrieve request signature
-			signature := r.Header.Get(cw.SignatureHeader)
-			if signature == "" {
-				w.WriteHeader(http.StatusUnauthorized)
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				req, err := request.ParseQuery(r.Header.Get(cw.AddressHeader), r.Header.Get(cw.ExpiryHeader), r.Method, r.URL.RequestURI())
+				if err != nil {
+					metrics.SignatureFailures.WithLabelValues("invalid_expiry").Inc()
+					response.WriteError(w, response.ErrUnauthorized)
+					return
+				}
+
+				addr, ok := verify(req, signature)
+				if !ok {
+					response.WriteError(w, response.ErrUnauthorized)
+					return
+				}
+
+				ctx = context.WithValue(ctx, cw.ContextKeyAddress, addr.Hex())
+
+				next.ServeHTTP(w, r.WithContext(ctx))
 				return
 			}
 
@@ -80,26 +399,22 @@ func createSignatureMiddleware(hexkey string) func(next http.Handler) http.Handl
 			var sec secureRequest
 			err := json.NewDecoder(r.Body).Decode(&sec)
 			if err != nil {
-				w.WriteHeader(http.StatusBadRequest)
+				metrics.SignatureFailures.WithLabelValues("invalid_body").Inc()
+				response.WriteError(w, response.BadRequest(err))
 				return
 			}
 
 			// decrypt secure request
 			req, err := request.Decrypt(hexkey, sec.Secure)
 			if err != nil {
-				w.WriteHeader(http.StatusUnauthorized)
-				return
-			}
-
-			// verify signature
-			if !req.VerifySignature(signature) {
-				w.WriteHeader(http.StatusUnauthorized)
+				metrics.SignatureFailures.WithLabelValues("decryption").Inc()
+				response.WriteError(w, response.ErrUnauthorized)
 				return
 			}
 
-			addr, err := req.RecoverAddress(signature)
-			if err != nil {
-				w.WriteHeader(http.StatusUnauthorized)
+			addr, ok := verify(req, signature)
+			if !ok {
+				response.WriteError(w, response.ErrUnauthorized)
 				return
 			}
 
@@ -113,57 +428,169 @@ func createSignatureMiddleware(hexkey string) func(next http.Handler) http.Handl
 	}
 }
 
-// OptionsMiddleware ensures that we return the correct headers for CORS requests
-func OptionsMiddleware(h http.Handler) http.Handler {
-	fn := func(w http.ResponseWriter, r *http.Request) {
-		ctx, _ := r.Context().Value(chi.RouteCtxKey).(*chi.Context)
+// verify verifies the signature of a request and returns its signer
+func verify(req *request.Request, signature string) (*common.Address, bool) {
+	if !req.VerifySignature(signature) {
+		metrics.SignatureFailures.WithLabelValues("invalid_signature").Inc()
+		return nil, false
+	}
 
-		var path string
-		if r.URL.RawPath != "" {
-			path = r.URL.RawPath
-		} else {
-			path = r.URL.Path
-		}
+	addr, err := req.RecoverAddress(signature)
+	if err != nil {
+		metrics.SignatureFailures.WithLabelValues("unrecoverable_address").Inc()
+		return nil, false
+	}
 
-		var methodsStr string
-		cached, ok := options.Load(path)
-		if ok {
-			methodsStr = cached.(string)
-		} else {
-			var methods []string
-			for _, method := range allMethods {
-				nctx := chi.NewRouteContext()
-				if ctx.Routes.Match(nctx, method, path) {
-					methods = append(methods, method)
+	return addr, true
+}
+
+// createPolicyMiddleware serves the requests which the policy of the routes allows
+func createPolicyMiddleware(p auth.Policy, roles *auth.Roles) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !p.Signed {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			addr, ok := cw.GetAddressFromContext(r.Context())
+			if !ok {
+				reason := "missing_signature"
+				if _, ok := cw.GetPubKeyFromContext(r.Context()); !ok {
+					reason = "missing_pubkey"
 				}
+
+				metrics.SignatureFailures.WithLabelValues(reason).Inc()
+				response.WriteError(w, response.ErrUnauthorized)
+				return
 			}
 
-			methods = append(methods, http.MethodOptions)
-			methodsStr = strings.Join(methods, ", ")
-			options.Store(path, methodsStr)
-		}
+			if p.Role != "" && !roles.Has(p.Role, addr) {
+				response.WriteError(w, response.Forbidden(auth.ErrMissingRole))
+				return
+			}
 
-		// allowed methods
-		w.Header().Set("Allow", methodsStr)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
 
-		// allowed methods for CORS
-		w.Header().Set("Access-Control-Allow-Methods", methodsStr)
+// createOptionsMiddleware sets the allowed methods of the route and the CORS headers of the policy, and answers preflight requests.
+// The allowed methods are cached by route pattern, so that the cache is bounded by the routes of the station.
+func createOptionsMiddleware(conf server.CORS) func(next http.Handler) http.Handler {
+	headers := strings.Join(append(append([]string{}, acceptedHeaders...), conf.Headers...), ", ")
+	exposed := strings.Join(exposedHeaders, ", ")
 
-		// allowed origins
-		w.Header().Set("Access-Control-Allow-Origin", "*")
+	var (
+		mu      sync.RWMutex
+		methods = map[string]string{}
+	)
 
-		// allowed headers
-		w.Header().Set("Access-Control-Allow-Headers", strings.Join(acceptedHeaders, ", "))
+	// allowed returns the methods allowed on the route of the path
+	allowed := func(routes chi.Routes, method, path string) string {
+		pattern, ok := routePattern(routes, method, path)
+		if !ok {
+			return http.MethodOptions
+		}
 
-		// actually handle the request
-		if r.Method != http.MethodOptions {
-			h.ServeHTTP(w, r)
-			return
+		mu.RLock()
+		m, ok := methods[pattern]
+		mu.RUnlock()
+
+		if ok {
+			return m
+		}
+
+		var list []string
+		for _, method := range allMethods {
+			if routes.Match(chi.NewRouteContext(), method, path) {
+				list = append(list, method)
+			}
 		}
 
-		// handle OPTIONS requests
-		w.WriteHeader(http.StatusOK)
+		m = strings.Join(append(list, http.MethodOptions), ", ")
+
+		mu.Lock()
+		methods[pattern] = m
+		mu.Unlock()
+
+		return m
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, _ := r.Context().Value(chi.RouteCtxKey).(*chi.Context)
+
+			path := r.URL.Path
+			if r.URL.RawPath != "" {
+				path = r.URL.RawPath
+			}
+
+			// preflight requests announce the method of the request which follows
+			method := r.Method
+			if method == http.MethodOptions {
+				method = r.Header.Get("Access-Control-Request-Method")
+			}
+
+			methodsStr := allowed(ctx.Routes, method, path)
+
+			// allowed methods
+			w.Header().Set("Allow", methodsStr)
+
+			origin, ok := conf.AllowedOrigin(r.Header.Get("Origin"))
+
+			// the response depends on the origin unless every origin is allowed
+			if origin != server.AnyOrigin {
+				w.Header().Add("Vary", "Origin")
+			}
+
+			if ok {
+				// allowed origins
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+
+				// allowed methods for CORS
+				w.Header().Set("Access-Control-Allow-Methods", methodsStr)
+
+				// allowed headers
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+
+				// headers readable by browsers
+				w.Header().Set("Access-Control-Expose-Headers", exposed)
+
+				if conf.Credentials {
+					w.Header().Set("Access-Control-Allow-Credentials", "true")
+				}
+
+				if age := int(conf.MaxAge.Seconds()); age > 0 {
+					w.Header().Set("Access-Control-Max-Age", strconv.Itoa(age))
+				}
+			}
+
+			// actually handle the request
+			if r.Method != http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// handle OPTIONS requests, preflights from origins which are not allowed are refused
+			if !ok && r.Header.Get("Origin") != "" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			w.WriteHeader(http.StatusOK)
+		})
+	}
+}
+
+// routePattern returns the pattern of the route matching the path, trying the method first and then every other method
+func routePattern(routes chi.Routes, method, path string) (string, bool) {
+	for _, m := range append([]string{method}, allMethods...) {
+		rctx := chi.NewRouteContext()
+		if routes.Match(rctx, m, path) {
+			return rctx.RoutePattern(), true
+		}
 	}
 
-	return http.HandlerFunc(fn)
+	return "", false
 }
@@ -1,15 +1,19 @@
 package router
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 
-	"github.com/daobrussels/cw/pkg/common/ethrequest"
+	"github.com/daobrussels/cw/pkg/admin"
+	"github.com/daobrussels/cw/pkg/auth"
 	"github.com/daobrussels/cw/pkg/common/response"
 	"github.com/daobrussels/cw/pkg/common/supply"
 	"github.com/daobrussels/cw/pkg/community"
 	"github.com/daobrussels/cw/pkg/hello"
 	"github.com/daobrussels/cw/pkg/push"
+	"github.com/daobrussels/cw/pkg/ratelimit"
 	"github.com/daobrussels/cw/pkg/server"
 	"github.com/daobrussels/cw/pkg/token"
 	"github.com/daobrussels/cw/pkg/transaction"
@@ -18,66 +22,206 @@ import (
 )
 
 type Router struct {
-	s  *supply.Supply
-	es *ethrequest.EthService
-	c  *community.Community
+	s     *supply.Supply
+	reg   *community.Registry
+	conf  server.Config
+	rl    *ratelimit.Limiter
+	roles *auth.Roles
+	audit *admin.AuditLog
+
+	srv  *http.Server
+	done chan struct{} // closed on shutdown so that long lived streams end
 }
 
 func NewServer(s *supply.Supply,
-	es *ethrequest.EthService,
-	c *community.Community) server.Server {
-	return &Router{
-		s,
-		es,
-		c,
+	reg *community.Registry, conf server.Config, rl *ratelimit.Limiter, roles *auth.Roles, audit *admin.AuditLog) server.Server {
+	r := &Router{
+		s:     s,
+		reg:   reg,
+		conf:  conf,
+		rl:    rl,
+		roles: roles,
+		audit: audit,
+		done:  make(chan struct{}),
 	}
+
+	r.srv = &http.Server{
+		ReadHeaderTimeout: conf.ReadHeaderTimeout,
+		ReadTimeout:       conf.ReadTimeout,
+		WriteTimeout:      conf.WriteTimeout,
+		IdleTimeout:       conf.IdleTimeout,
+	}
+
+	r.srv.RegisterOnShutdown(func() {
+		close(r.done)
+	})
+
+	return r
 }
 
 // implement the Server interface
 func (r *Router) Start(port int) error {
 	responder := response.NewResponder(r.s)
 
+	// the default community serves the routes which are not scoped to a community
+	c, ok := r.reg.Default()
+	if !ok {
+		return errors.New("no community loaded")
+	}
+
 	cr := chi.NewRouter()
 
 	// configure middleware
-	cr.Use(OptionsMiddleware)
-	cr.Use(HealthMiddleware)
+	if r.conf.TrustProxy {
+		cr.Use(middleware.RealIP)
+	}
+
+	cr.Use(createOptionsMiddleware(r.conf.CORS))
+	cr.Use(createHealthMiddleware(r.reg))
+	cr.Use(RequestIDMiddleware)
+	cr.Use(MetricsMiddleware)
+	cr.Use(createRateLimitMiddleware(r.rl, ""))
+	cr.Use(createStreamMiddleware(r.done))
 	cr.Use(middleware.Compress(9))
 	cr.Use(createSignatureMiddleware(r.s.PrivateHexKey))
 
 	// instantiate handlers
-	hello := hello.NewHandlers(r.c.Chain, responder)
-	transaction := transaction.NewHandlers(&r.c.Chain, r.s, r.es)
-	community := community.NewHandlers(responder, r.c)
+	hello := hello.NewHandlers(c.Chain, responder)
+	transaction := transaction.NewHandlers(&c.Chain, r.s, c.EthService())
+	communities := community.NewHandlers(responder, r.reg, r.conf.CORS)
 	token := token.NewHandlers()
 	push := push.NewHandlers()
+	admin := admin.NewHandlers(responder, r.rl.Denylist, r.reg.Breaker, r.audit)
 
-	// configure routes
-	cr.Get("/hello", hello.Hello)
+	policy := func(p auth.Policy) func(http.Handler) http.Handler {
+		return createPolicyMiddleware(p, r.roles)
+	}
+
+	// configure routes, every route declares who can call it
+	cr.With(policy(auth.Public)).Get("/hello", hello.Hello)
 
-	cr.Post("/transaction", transaction.Send)
+	cr.With(policy(auth.Signed), createRateLimitMiddleware(r.rl, ratelimit.RouteTransaction)).Post("/transaction", transaction.Send)
 
 	cr.Route("/community", func(cr chi.Router) {
-		cr.Get("/", community.Config)
+		cr.Use(policy(auth.Signed))
+		cr.Use(createDefaultCommunityMiddleware(r.reg))
 
-		cr.Route("/account", func(cr chi.Router) {
-			cr.Post("/", community.CreateAccount)        // create an account and return address
-			cr.Post("/profile", community.CreateAccount) // attach a profile and return address
-		})
+		communityRoutes(cr, communities, r.rl)
+	})
+
+	cr.Route("/communities", func(cr chi.Router) {
+		cr.With(policy(auth.Public)).Get("/", communities.Communities)
+
+		cr.Route("/{id}", func(cr chi.Router) {
+			cr.Use(policy(auth.Signed))
+			cr.Use(createCommunityMiddleware(r.reg))
 
-		cr.Post("/op", community.SubmitOp) // submit an operation
+			communityRoutes(cr, communities, r.rl)
+		})
 	})
 
 	cr.Route("/token", func(cr chi.Router) {
+		cr.Use(policy(auth.Signed))
+
 		cr.Post("/mint", token.Mint)
 		cr.Post("/burn", token.Burn)
 	})
 
 	cr.Route("/push", func(cr chi.Router) {
+		cr.Use(policy(auth.Signed))
+
 		cr.Put("/associate", push.Associate)
 		cr.Delete("/dissociate", push.Dissociate)
 	})
 
+	cr.Route("/admin", func(cr chi.Router) {
+		cr.Use(policy(auth.RequireRole(auth.RoleAdmin)))
+
+		cr.Get("/denylist", admin.Denylist) // list the denied ips, public keys and addresses
+		cr.Put("/denylist", admin.Ban)      // deny ips, public keys or addresses
+		cr.Delete("/denylist", admin.Unban) // allow ips, public keys or addresses again
+
+		cr.Get("/pause", admin.PauseState) // whether the station is paused, and why
+		cr.Put("/pause", admin.Pause)      // pause or resume every transaction of the station
+
+		cr.Route("/communities/{id}", func(cr chi.Router) {
+			cr.Use(createCommunityMiddleware(r.reg))
+
+			cr.Get("/", admin.Status)                      // funds, ownership and controls of the community
+			cr.Post("/paymaster/deposit", admin.Deposit)   // fund the paymaster from the supply wallet
+			cr.Post("/paymaster/withdraw", admin.Withdraw) // withdraw from the paymaster deposit
+			cr.Put("/limits/mint", admin.MintLimit)        // limit a single gratitude mint
+			cr.Put("/sponsorship", admin.Sponsorship)      // pause or resume sponsorship by the paymaster
+			cr.Get("/ops/pending", admin.PendingOps)       // operations sent which are not mined yet
+			cr.Post("/keys/rotate", admin.RotateKey)       // hand the paymaster over to a new supply key
+		})
+	})
+
 	// start the server
-	return http.ListenAndServe(fmt.Sprintf(":%v", port), cr)
+	r.srv.Addr = fmt.Sprintf(":%v", port)
+	r.srv.Handler = cr
+
+	var err error
+	if r.conf.TLS() {
+		err = r.srv.ListenAndServeTLS(r.conf.CertFile, r.conf.KeyFile)
+	} else {
+		err = r.srv.ListenAndServe()
+	}
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
+
+// Shutdown stops accepting requests and waits for the requests in flight, such as transactions waiting to be mined.
+// Long lived streams are ended, clients resume them from the last event they received.
+func (r *Router) Shutdown(ctx context.Context) error {
+	return r.srv.Shutdown(ctx)
+}
+
+// communityRoutes configures the routes of a single community
+func communityRoutes(cr chi.Router, community *community.Handlers, rl *ratelimit.Limiter) {
+	limit := func(route string) func(http.Handler) http.Handler {
+		return createRateLimitMiddleware(rl, route)
+	}
+
+	cr.Get("/", community.Config)
+
+	cr.Route("/account", func(cr chi.Router) {
+		cr.With(limit(ratelimit.RouteAccount)).Post("/", community.CreateAccount)        // create an account and return address
+		cr.With(limit(ratelimit.RouteAccount)).Post("/profile", community.CreateAccount) // attach a profile and return address
+
+		cr.Get("/{account}/guardians", community.Guardians) // list the guardians of an account
+		cr.Put("/guardians", community.AddGuardian)         // add a guardian to an account
+		cr.Delete("/guardians", community.RemoveGuardian)   // remove a guardian from an account
+
+		cr.Get("/{account}/sessions", community.SessionKeys) // list the session keys of an account
+		cr.Put("/sessions", community.RegisterSessionKey)    // register a scoped session key
+		cr.Delete("/sessions", community.RevokeSessionKey)   // revoke a session key
+	})
+
+	cr.Route("/accounts/{address}", func(cr chi.Router) {
+		cr.Get("/transactions", community.Transactions) // transaction history of an account
+		cr.Get("/balances", community.Balances)         // native, community token and gratitude balances
+		cr.Get("/activity", community.Activity)         // stream of transactions over sse or websocket
+	})
+
+	cr.With(limit(ratelimit.RouteOp)).Post("/op", community.SubmitOp)                // submit an operation
+	cr.With(limit(ratelimit.RouteOp)).Post("/op/session", community.SubmitSessionOp) // submit an operation signed by a session key
+
+	cr.Route("/gratitude", func(cr chi.Router) {
+		cr.With(limit(ratelimit.RouteGratitude)).Post("/", community.CreateGratitudeApp) // create a gratitude app and return address
+		cr.With(limit(ratelimit.RouteGratitude)).Post("/mint", community.MintGratitude)  // mint gratitude tokens to recipients
+		cr.Post("/transfer", community.TransferGratitude)                                // transfer gratitude tokens
+		cr.Get("/apps/{owner}", community.GratitudeApps)                                 // list the apps of an owner
+		cr.Get("/tokens/{address}", community.GratitudeTokens)                           // list the gratitude tokens held by an address
+	})
+
+	cr.Route("/paymaster", func(cr chi.Router) {
+		cr.With(limit(ratelimit.RouteSponsor)).Post("/sponsor", community.Sponsor) // sign paymasterAndData for a user operation
+		cr.Post("/quote", community.QuoteToken)                                    // quote gas in community tokens
+		cr.Get("/accounting", community.TokenAccounting)                           // fees collected in community tokens
+	})
 }
@@ -1,5 +1,96 @@
 package server
 
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+// AnyOrigin allows every origin to call the station
+const AnyOrigin = "*"
+
+var (
+	ErrCredentialsAnyOrigin = errors.New("credentials cannot be allowed for any origin")
+	ErrEmptyOrigin          = errors.New("empty origin")
+)
+
 type Server interface {
 	Start(port int) error
+	Shutdown(ctx context.Context) error
+}
+
+// Config configures the timeouts and tls of an http server
+type Config struct {
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration // long lived streams are exempt
+	IdleTimeout       time.Duration
+
+	// CertFile and KeyFile enable tls when both are set
+	CertFile string
+	KeyFile  string
+
+	// TrustProxy takes the ip of clients from the X-Forwarded-For or X-Real-IP headers set by a reverse proxy
+	TrustProxy bool
+
+	// CORS is which browser origins can call the station
+	CORS CORS
+}
+
+// CORS is the cross-origin policy which browsers apply to the responses of the station
+type CORS struct {
+	Origins     []string      // origins allowed to call the station, such as https://wallet.example.org, AnyOrigin allows all
+	Headers     []string      // request headers allowed on top of the ones the station reads
+	Credentials bool          // whether browsers send cookies and authorization headers, not allowed for any origin
+	MaxAge      time.Duration // how long browsers cache a preflight response, 0 leaves it to the browser
+}
+
+// Validate returns an error for a policy which browsers would reject
+func (c CORS) Validate() error {
+	for _, o := range c.Origins {
+		if o == "" {
+			return ErrEmptyOrigin
+		}
+
+		if o == AnyOrigin && c.Credentials {
+			return ErrCredentialsAnyOrigin
+		}
+	}
+
+	return nil
+}
+
+// AllowedOrigin returns the value of the Access-Control-Allow-Origin header for a request from an origin,
+// false when the origin is not allowed. Origins are compared without case.
+func (c CORS) AllowedOrigin(origin string) (string, bool) {
+	for _, o := range c.Origins {
+		if o == AnyOrigin {
+			return AnyOrigin, true
+		}
+
+		if origin != "" && strings.EqualFold(o, origin) {
+			return origin, true
+		}
+	}
+
+	return "", false
+}
+
+// DefaultConfig returns timeouts which leave room for requests waiting on a transaction to be mined
+func DefaultConfig() Config {
+	return Config{
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      2 * time.Minute,
+		IdleTimeout:       2 * time.Minute,
+		CORS: CORS{
+			Origins: []string{AnyOrigin},
+		},
+	}
+}
+
+// TLS returns whether the server should serve tls
+func (c Config) TLS() bool {
+	return c.CertFile != "" && c.KeyFile != ""
 }
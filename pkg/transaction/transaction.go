@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/daobrussels/cw/pkg/common/ethrequest"
+	"github.com/daobrussels/cw/pkg/common/response"
 	"github.com/daobrussels/cw/pkg/common/supply"
 	"github.com/daobrussels/cw/pkg/common/transaction"
 	"github.com/daobrussels/cw/pkg/cw"
@@ -30,14 +31,13 @@ func (h *Handlers) Send(w http.ResponseWriter, r *http.Request) {
 
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		response.WriteError(w, response.BadRequest(err))
 		return
 	}
 
-	err = h.tr.Forward(req.TX)
+	err = h.tr.Forward(r.Context(), req.TX)
 	if err != nil {
-		println(err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
+		response.WriteError(w, err)
 		return
 	}
 }
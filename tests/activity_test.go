@@ -0,0 +1,236 @@
+package tests
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/daobrussels/cw/pkg/common/response"
+	"github.com/daobrussels/cw/pkg/common/supply"
+	"github.com/daobrussels/cw/pkg/community"
+	"github.com/daobrussels/cw/pkg/cw"
+	"github.com/daobrussels/cw/pkg/server"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/websocket"
+)
+
+func TestActivity(t *testing.T) {
+	station, err := supply.New(reqprivhexkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	account := common.HexToAddress(nobalancehexaddr)
+	owner := common.HexToAddress(nobalancehexaddr2)
+
+	// the account reports its owner on every call
+	c := stubCommunity(t, opStub{hash: common.BytesToHash(owner.Bytes())}, common.HexToAddress("0x1"), nil)
+
+	c.Index, err = community.OpenIndex("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Index.Close()
+
+	h := community.NewHandlers(response.NewResponder(station), nil, server.CORS{Origins: []string{"https://wallet.example.org"}})
+
+	router := chi.NewRouter()
+	router.Get("/accounts/{address}/activity", h.Activity)
+
+	stream := func(signer common.Address) *httptest.ResponseRecorder {
+		// streams last until the client goes away
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		ctx = community.WithCommunity(ctx, c)
+		ctx = context.WithValue(ctx, cw.ContextKeyPubKey, reqpubhexkey)
+		ctx = context.WithValue(ctx, cw.ContextKeyAddress, signer.Hex())
+
+		req := httptest.NewRequest(http.MethodGet, "/accounts/"+account.Hex()+"/activity", nil).WithContext(ctx)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		return w
+	}
+
+	t.Run("test the owner follows the activity of an account", func(t *testing.T) {
+		w := stream(owner)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected the stream to be served, got %d", w.Code)
+		}
+	})
+
+	t.Run("test others cannot follow the activity of an account", func(t *testing.T) {
+		w := stream(common.HexToAddress(txreceivingAddress))
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("expected %d, got %d", http.StatusForbidden, w.Code)
+		}
+	})
+	t.Run("test operations of the station are streamed once mined then once confirmed", func(t *testing.T) {
+		hash := common.BytesToHash(owner.Bytes())
+
+		op := userOpEvent(t, common.HexToAddress("0x1"), hash, account, true)
+		op.BlockNumber = 1
+
+		// the account reports its owner, the chain is at block 1 which holds the operation
+		stub := opStub{hash: hash, status: 1, logs: []*types.Log{op}}
+		chain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := io.ReadAll(r.Body)
+
+			var msg struct {
+				ID     json.RawMessage `json:"id"`
+				Method string          `json:"method"`
+			}
+			json.Unmarshal(b, &msg)
+
+			switch msg.Method {
+			case "eth_blockNumber":
+				fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":"0x1"}`, msg.ID)
+			case "eth_getLogs":
+				json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": msg.ID, "result": []*types.Log{op}})
+			default:
+				r.Body = io.NopCloser(bytes.NewReader(b))
+				stub.ServeHTTP(w, r)
+			}
+		}))
+		defer chain.Close()
+
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		reg := community.NewRegistry(key, crypto.PubkeyToAddress(key.PublicKey))
+		defer reg.Close()
+
+		reg.Confirmations = 0
+
+		indexed, err := reg.Add("a", community.CommunityAddress{
+			Gateway:          common.HexToAddress("0x1"),
+			Paymaster:        common.HexToAddress("0x2"),
+			AccountFactory:   common.HexToAddress("0x3"),
+			GratitudeFactory: common.HexToAddress("0x4"),
+			ProfileFactory:   common.HexToAddress("0x5"),
+			Token:            common.HexToAddress("0x6"),
+			Chain:            cw.ChainConfig{ChainID: 1, RPC: []string{chain.URL}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := community.WithCommunity(r.Context(), indexed)
+			ctx = context.WithValue(ctx, cw.ContextKeyPubKey, reqpubhexkey)
+			ctx = context.WithValue(ctx, cw.ContextKeyAddress, owner.Hex())
+
+			router.ServeHTTP(w, r.WithContext(ctx))
+		}))
+		defer srv.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/accounts/"+account.Hex()+"/activity", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		body := bufio.NewReader(resp.Body)
+
+		// next returns the id and the name of the next event of the stream
+		next := func() (string, string) {
+			var id, event string
+			for {
+				line, err := body.ReadString('\n')
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				switch {
+				case strings.HasPrefix(line, "id: "):
+					id = strings.TrimSpace(strings.TrimPrefix(line, "id: "))
+				case strings.HasPrefix(line, "event: "):
+					event = strings.TrimSpace(strings.TrimPrefix(line, "event: "))
+				case line == "\n" && event != "":
+					return id, event
+				}
+			}
+		}
+
+		err = indexed.SubmitUserOp(ctx, community.UserOp{Sender: account})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		id, event := next()
+		if event != "pending" || id != "" {
+			t.Fatalf("expected a pending event without id, got %q with id %q", event, id)
+		}
+
+		reg.Listen(ctx)
+
+		id, event = next()
+		if event != "transaction" || id == "" {
+			t.Fatalf("expected a confirmed transaction with an id, got %q with id %q", event, id)
+		}
+	})
+
+	t.Run("test websockets are only opened from allowed origins", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := community.WithCommunity(r.Context(), c)
+			ctx = context.WithValue(ctx, cw.ContextKeyPubKey, reqpubhexkey)
+			ctx = context.WithValue(ctx, cw.ContextKeyAddress, owner.Hex())
+
+			router.ServeHTTP(w, r.WithContext(ctx))
+		}))
+		defer srv.Close()
+
+		url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/accounts/" + account.Hex() + "/activity"
+
+		for _, tc := range []struct {
+			origin string
+			ok     bool
+		}{
+			{"https://wallet.example.org", true},
+			{"https://evil.example.org", false},
+			{"", true}, // clients other than browsers
+		} {
+			header := http.Header{}
+			if tc.origin != "" {
+				header.Set("Origin", tc.origin)
+			}
+
+			conn, resp, err := websocket.DefaultDialer.Dial(url, header)
+			if tc.ok {
+				if err != nil {
+					t.Fatalf("expected a websocket from %q, got %v", tc.origin, err)
+				}
+
+				conn.Close()
+				continue
+			}
+
+			if err == nil || resp.StatusCode != http.StatusForbidden {
+				t.Fatalf("expected a websocket from %q to be refused, got %v", tc.origin, err)
+			}
+		}
+	})
+}
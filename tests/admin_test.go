@@ -0,0 +1,188 @@
+package tests
+
+import (
+	"context"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/daobrussels/cw/pkg/admin"
+	"github.com/daobrussels/cw/pkg/common/response"
+	"github.com/daobrussels/cw/pkg/common/supply"
+	"github.com/daobrussels/cw/pkg/community"
+	"github.com/daobrussels/cw/pkg/cw"
+	"github.com/daobrussels/cw/pkg/ratelimit"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestAdmin(t *testing.T) {
+	t.Run("test audit log", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "audit.log")
+
+		for i, action := range []string{admin.ActionDeposit, admin.ActionBan} {
+			audit, err := admin.OpenAuditLog(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = audit.Record(admin.Entry{Admin: "0xabc", Action: action, Params: map[string]int{"n": i}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			audit.Close()
+		}
+
+		// reopening the log appends to it
+		entries, err := admin.ReadAuditLog(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(entries) != 2 || entries[0].Action != admin.ActionDeposit || entries[1].Action != admin.ActionBan {
+			t.Fatalf("expected both actions in order, got %+v", entries)
+		}
+	})
+
+	t.Run("test mint limit", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "controls.json")
+
+		controls, err := community.NewControls(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		amounts := []*big.Int{big.NewInt(5), big.NewInt(6)}
+
+		err = controls.CheckMint(amounts)
+		if err != nil {
+			t.Fatalf("expected no limit by default, got %v", err)
+		}
+
+		err = controls.SetMint(community.MintLimit{MaxAmount: big.NewInt(10)})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = controls.CheckMint(amounts)
+		if err != community.ErrMintLimit {
+			t.Fatalf("expected %v, got %v", community.ErrMintLimit, err)
+		}
+
+		err = controls.SetMint(community.MintLimit{MaxRecipients: -1})
+		if err != community.ErrInvalidLimit {
+			t.Fatalf("expected %v, got %v", community.ErrInvalidLimit, err)
+		}
+
+		// the limit is persisted
+		controls, err = community.NewControls(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if controls.Mint().MaxAmount.Cmp(big.NewInt(10)) != 0 {
+			t.Fatalf("expected the limit to be loaded, got %v", controls.Mint())
+		}
+	})
+
+	t.Run("test sponsorship pause", func(t *testing.T) {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c := community.Prepare(nil, key, crypto.PubkeyToAddress(key.PublicKey), cw.ChainConfig{ChainID: 1})
+
+		err = c.Controls.PauseSponsorship(true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = c.SponsorOp(context.Background(), common.HexToAddress("0x1"), community.UserOp{})
+		if err != community.ErrSponsorshipPaused {
+			t.Fatalf("expected %v, got %v", community.ErrSponsorshipPaused, err)
+		}
+	})
+
+	t.Run("test bans survive a reload of the denylist", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "denylist")
+
+		err := os.WriteFile(path, []byte("10.0.0.9\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		d := ratelimit.NewDenylist()
+		d.Add("0xDEF")
+
+		err = d.Load(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !d.Contains("0xdef") || !d.Contains("10.0.0.9") {
+			t.Fatalf("expected both entries to be denied, got %v", d.List())
+		}
+
+		d.Remove("0xdef")
+
+		if d.Contains("0xdef") || len(d.List()) != 1 {
+			t.Fatalf("expected the ban to be lifted, got %v", d.List())
+		}
+	})
+	t.Run("test actions are recorded before they are taken", func(t *testing.T) {
+		station, err := supply.New(reqprivhexkey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		path := filepath.Join(t.TempDir(), "audit.log")
+
+		audit, err := admin.OpenAuditLog(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		d := ratelimit.NewDenylist()
+		h := admin.NewHandlers(response.NewResponder(station), d, nil, audit)
+
+		ban := func(entry string) int {
+			ctx := context.WithValue(context.Background(), cw.ContextKeyPubKey, reqpubhexkey)
+			ctx = context.WithValue(ctx, cw.ContextKeyAddress, reqaddress)
+
+			req := httptest.NewRequest(http.MethodPut, "/admin/denylist", strings.NewReader(`{"entries":["`+entry+`"]}`))
+
+			w := httptest.NewRecorder()
+			h.Ban(w, req.WithContext(ctx))
+
+			return w.Code
+		}
+
+		code := ban("10.0.0.1")
+		if code != http.StatusOK || !d.Contains("10.0.0.1") {
+			t.Fatalf("expected the ban to be taken, got %d", code)
+		}
+
+		entries, err := admin.ReadAuditLog(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(entries) != 2 || entries[0].Status != admin.StatusIntent || entries[1].Status != admin.StatusSucceeded {
+			t.Fatalf("expected the intent and the outcome of the ban, got %+v", entries)
+		}
+
+		// the audit log can no longer be written
+		audit.Close()
+
+		code = ban("10.0.0.2")
+		if code != http.StatusInternalServerError || d.Contains("10.0.0.2") {
+			t.Fatalf("expected the ban to be refused, got %d", code)
+		}
+	})
+}
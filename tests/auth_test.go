@@ -0,0 +1,57 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/daobrussels/cw/pkg/auth"
+)
+
+func TestRoles(t *testing.T) {
+	roles := auth.NewRoles()
+
+	t.Run("test grant and revoke", func(t *testing.T) {
+		roles.Grant(auth.RoleAdmin, reqaddress)
+
+		// addresses are case insensitive
+		if !roles.Has(auth.RoleAdmin, "0x35ff694e4161b914ea8344fe3865f19fa31d59c4") {
+			t.Fatal("expected the address to have the role")
+		}
+
+		roles.Revoke(auth.RoleAdmin, reqaddress)
+
+		if roles.Has(auth.RoleAdmin, reqaddress) {
+			t.Fatal("expected the role to be revoked")
+		}
+	})
+
+	t.Run("test load", func(t *testing.T) {
+		roles.Grant(auth.RoleAdmin, txreceivingAddress)
+
+		path := filepath.Join(t.TempDir(), "roles.json")
+
+		err := os.WriteFile(path, []byte(`{"admin": ["`+reqaddress+`"]}`), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = roles.Load(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !roles.Has(auth.RoleAdmin, reqaddress) {
+			t.Fatal("expected the address of the file to have the role")
+		}
+
+		// the file replaces the members
+		if roles.Has(auth.RoleAdmin, txreceivingAddress) {
+			t.Fatal("expected members missing from the file to lose the role")
+		}
+
+		if m := roles.Members(auth.RoleAdmin); len(m) != 1 {
+			t.Fatalf("expected a single admin, got %v", m)
+		}
+	})
+}
@@ -0,0 +1,167 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/daobrussels/cw/pkg/community"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// balanceStub answers the calls of a community without a token, counting the balances read,
+// its chain holds a transfer in every block range
+type balanceStub struct {
+	reads    *atomic.Int32
+	transfer *types.Log
+}
+
+func (s balanceStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var msg struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+	}
+	json.NewDecoder(r.Body).Decode(&msg)
+
+	var result any
+
+	switch msg.Method {
+	case "eth_getBalance":
+		s.reads.Add(1)
+		result = "0x1"
+	case "eth_blockNumber":
+		result = "0x20"
+	case "eth_getBlockByNumber":
+		result = &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(0)}
+	case "eth_getLogs":
+		result = []*types.Log{s.transfer}
+	}
+
+	b, _ := json.Marshal(result)
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":%s}`, msg.ID, b)
+}
+
+func TestBalances(t *testing.T) {
+	ctx := context.Background()
+
+	account := common.HexToAddress(nobalancehexaddr)
+
+	transfer := &types.Log{
+		Address:     common.HexToAddress("0x6"),
+		Topics:      []common.Hash{crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)")), {}, common.BytesToHash(account.Bytes())},
+		Data:        common.LeftPadBytes(big.NewInt(1).Bytes(), 32),
+		BlockNumber: 32,
+	}
+
+	// the community has no manifest, its gratitude apps cannot be searched
+	prepare := func(t *testing.T, reads *atomic.Int32) *community.Community {
+		return stubCommunity(t, balanceStub{reads, transfer}, common.HexToAddress("0x1"), nil)
+	}
+
+	t.Run("test balances are cached", func(t *testing.T) {
+		var reads atomic.Int32
+
+		c := prepare(t, &reads)
+
+		for i := 0; i < 2; i++ {
+			b, err := c.Balances(ctx, account)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if b.Native.Balance != "1" || len(b.Gratitude) != 0 {
+				t.Fatalf("expected a native balance of 1 without gratitude, got %+v", b)
+			}
+		}
+
+		if reads.Load() != 1 {
+			t.Fatalf("expected the balances to be read once, got %d reads", reads.Load())
+		}
+	})
+
+	t.Run("test balances expire", func(t *testing.T) {
+		var reads atomic.Int32
+
+		c := prepare(t, &reads)
+		c.BalanceTTL = 10 * time.Millisecond
+
+		_, err := c.Balances(ctx, account)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		time.Sleep(20 * time.Millisecond)
+
+		_, err = c.Balances(ctx, account)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if reads.Load() != 2 {
+			t.Fatalf("expected the balances to be read again once expired, got %d reads", reads.Load())
+		}
+	})
+
+	t.Run("test balances are invalidated by transfers", func(t *testing.T) {
+		var reads atomic.Int32
+
+		c := prepare(t, &reads)
+		c.Events.Confirmations = 0
+
+		_, err := c.Balances(ctx, account)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+
+		err = c.Events.Listen(lctx, 32)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = c.Balances(ctx, account)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if reads.Load() != 2 {
+			t.Fatalf("expected the balances to be read again after a transfer, got %d reads", reads.Load())
+		}
+	})
+}
+
+func TestFormatUnits(t *testing.T) {
+	tests := []struct {
+		amount   string
+		decimals int
+		expected string
+	}{
+		{"0", 18, "0"},
+		{"1000000000000000000", 18, "1"},
+		{"1500000000000000000", 18, "1.5"},
+		{"1", 18, "0.000000000000000001"},
+		{"123456", 2, "1234.56"},
+		{"-250", 2, "-2.5"},
+		{"42", 0, "42"},
+	}
+
+	for _, tt := range tests {
+		amount, _ := new(big.Int).SetString(tt.amount, 10)
+
+		got := community.FormatUnits(amount, tt.decimals)
+		if got != tt.expected {
+			t.Fatalf("expected %s with %d decimals to be %s, got %s", tt.amount, tt.decimals, tt.expected, got)
+		}
+	}
+}
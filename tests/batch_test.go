@@ -0,0 +1,195 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/daobrussels/cw/pkg/community"
+	"github.com/daobrussels/smartcontracts/pkg/contracts/account"
+	"github.com/daobrussels/smartcontracts/pkg/contracts/gateway"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestCallData(t *testing.T) {
+	abi, err := account.AccountMetaData.GetAbi()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vendor := common.HexToAddress(reqaddress)
+	token := common.HexToAddress(txreceivingAddress)
+
+	t.Run("test a single call is executed directly", func(t *testing.T) {
+		data, err := community.CallData([]community.Call{{To: vendor, Value: (*hexutil.Big)(big.NewInt(1))}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(data[:4], abi.Methods["execute"].ID) {
+			t.Fatalf("expected execute call data, got %x", data[:4])
+		}
+	})
+
+	t.Run("test several calls are executed as a batch", func(t *testing.T) {
+		calls := []community.Call{
+			{To: token, Data: []byte{0x01}},
+			{To: token, Data: []byte{0x02}},
+		}
+
+		data, err := community.CallData(calls)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		method := abi.Methods["executeBatch"]
+		if !bytes.Equal(data[:4], method.ID) {
+			t.Fatalf("expected executeBatch call data, got %x", data[:4])
+		}
+
+		args, err := method.Inputs.Unpack(data[4:])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if dest := args[0].([]common.Address); len(dest) != 2 || dest[1] != token {
+			t.Fatalf("expected 2 calls to the token, got %v", dest)
+		}
+	})
+
+	t.Run("test batched calls cannot transfer value", func(t *testing.T) {
+		_, err := community.CallData([]community.Call{
+			{To: token},
+			{To: vendor, Value: (*hexutil.Big)(big.NewInt(1))},
+		})
+		if err != community.ErrBatchValue {
+			t.Fatalf("expected value in a batch to be rejected, got %v", err)
+		}
+
+		_, err = community.CallData(nil)
+		if err != community.ErrNoCalls {
+			t.Fatalf("expected an empty batch to be rejected, got %v", err)
+		}
+	})
+}
+
+func TestSubmitCalls(t *testing.T) {
+	ctx := context.Background()
+
+	gabi, err := gateway.GatewayMetaData.GetAbi()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entryPoint := common.HexToAddress("0x1")
+	sender := common.HexToAddress(nobalancehexaddr)
+	token := common.HexToAddress(reqaddress)
+	vendor := common.HexToAddress(txreceivingAddress)
+	hash := crypto.Keccak256Hash([]byte("batched operation"))
+
+	approval := &types.Log{Address: token, Topics: []common.Hash{crypto.Keccak256Hash([]byte("Approval(address,address,uint256)"))}}
+	transfer := &types.Log{Address: token, Topics: []common.Hash{crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))}}
+	order := &types.Log{Address: vendor, Topics: []common.Hash{crypto.Keccak256Hash([]byte("Ordered(address)"))}}
+	before := &types.Log{Address: entryPoint, Topics: []common.Hash{gabi.Events["BeforeExecution"].ID}}
+	validation := &types.Log{Address: token, Topics: []common.Hash{crypto.Keccak256Hash([]byte("Validated()"))}}
+
+	submit := func(t *testing.T, success bool, calls []community.Call, logs ...*types.Log) *community.OpResult {
+		logs = append([]*types.Log{validation, before}, logs...)
+		logs = append(logs, userOpEvent(t, entryPoint, hash, sender, success))
+
+		c := stubCommunity(t, opStub{hash: hash, status: types.ReceiptStatusSuccessful, logs: logs}, entryPoint, nil)
+
+		result, err := c.SubmitCalls(ctx, sender, calls)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.UserOpHash != hash || result.Success != success {
+			t.Fatalf("expected operation %s to report success %v, got %+v", hash, success, result)
+		}
+
+		return result
+	}
+
+	t.Run("test logs are attributed to the targets which emitted them", func(t *testing.T) {
+		result := submit(t, true, []community.Call{{To: token}, {To: vendor}}, transfer, order)
+
+		if len(result.Logs) != 2 {
+			t.Fatalf("expected the 2 logs emitted during execution, got %d", len(result.Logs))
+		}
+
+		if len(result.Calls) != 2 || len(result.Calls[0].Logs) != 1 || result.Calls[0].Logs[0].Topics[0] != transfer.Topics[0] {
+			t.Fatalf("expected the transfer to be attributed to the token call, got %+v", result.Calls)
+		}
+
+		if len(result.Calls[1].Logs) != 1 || result.Calls[1].Logs[0].Topics[0] != order.Topics[0] {
+			t.Fatalf("expected the order to be attributed to the vendor call, got %+v", result.Calls)
+		}
+	})
+
+	t.Run("test logs of calls sharing a target are not attributed", func(t *testing.T) {
+		result := submit(t, true, []community.Call{{To: token}, {To: token}, {To: vendor}}, approval, transfer, order)
+
+		if len(result.Logs) != 3 {
+			t.Fatalf("expected the 3 logs emitted during execution, got %d", len(result.Logs))
+		}
+
+		if result.Calls[0].Logs != nil || result.Calls[1].Logs != nil {
+			t.Fatalf("expected the token calls to have no attributed logs, got %+v", result.Calls)
+		}
+
+		if len(result.Calls[2].Logs) != 1 {
+			t.Fatalf("expected the order to be attributed to the vendor call, got %+v", result.Calls[2])
+		}
+	})
+
+	t.Run("test transfers of the same token are attributed by recipient and amount", func(t *testing.T) {
+		erc20, err := abi.JSON(strings.NewReader(`[{"inputs":[{"name":"to","type":"address"},{"name":"amount","type":"uint256"}],"name":"transfer","outputs":[{"name":"","type":"bool"}],"stateMutability":"nonpayable","type":"function"}]`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		transferTo := func(to common.Address, amount int64) (community.Call, *types.Log) {
+			data, err := erc20.Pack("transfer", to, big.NewInt(amount))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			l := &types.Log{
+				Address: token,
+				Topics:  []common.Hash{transfer.Topics[0], common.BytesToHash(sender.Bytes()), common.BytesToHash(to.Bytes())},
+				Data:    common.LeftPadBytes(big.NewInt(amount).Bytes(), 32),
+			}
+
+			return community.Call{To: token, Data: data}, l
+		}
+
+		toVendor, vendorLog := transferTo(vendor, 10)
+		toSender, senderLog := transferTo(sender, 20)
+
+		// the logs are emitted in another order than the calls
+		result := submit(t, true, []community.Call{toVendor, toSender}, senderLog, vendorLog)
+
+		if len(result.Calls) != 2 || len(result.Calls[0].Logs) != 1 || len(result.Calls[1].Logs) != 1 {
+			t.Fatalf("expected a log for each transfer, got %+v", result.Calls)
+		}
+
+		if !bytes.Equal(result.Calls[0].Logs[0].Topics[2].Bytes(), vendorLog.Topics[2].Bytes()) || !bytes.Equal(result.Calls[1].Logs[0].Data, senderLog.Data) {
+			t.Fatalf("expected each transfer to get the log of its recipient and amount, got %+v", result.Calls)
+		}
+	})
+
+	t.Run("test failed operations are reported", func(t *testing.T) {
+		result := submit(t, false, []community.Call{{To: token}, {To: vendor}})
+
+		if len(result.Logs) != 0 || len(result.Calls[0].Logs) != 0 {
+			t.Fatalf("expected a failed operation to have no logs, got %+v", result)
+		}
+	})
+}
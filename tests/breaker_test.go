@@ -0,0 +1,108 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net/http"
+	"testing"
+
+	"github.com/daobrussels/cw/pkg/breaker"
+	"github.com/daobrussels/cw/pkg/common/response"
+	"github.com/daobrussels/cw/pkg/community"
+	"github.com/daobrussels/cw/pkg/cw"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// paused returns whether an error is the one of a paused station
+func paused(err error) bool {
+	var e *response.Error
+	return errors.As(err, &e) && e.Code == response.CodePaused && e.Status == http.StatusServiceUnavailable
+}
+
+func TestBreaker(t *testing.T) {
+	t.Run("test pause and resume", func(t *testing.T) {
+		var nilBreaker *breaker.Breaker
+		nilBreaker.Pause(breaker.SourceAdmin, "drained wallet")
+		if nilBreaker.Check() != nil {
+			t.Fatal("expected a nil breaker to never be paused")
+		}
+		nilBreaker.Resume()
+
+		b := breaker.New(breaker.Thresholds{})
+
+		b.Pause(breaker.SourceAdmin, "drained wallet")
+		b.Pause(breaker.SourceSignal, "again")
+
+		if !paused(b.Check()) {
+			t.Fatalf("expected a paused error, got %v", b.Check())
+		}
+
+		state := b.State()
+		if state.Source != breaker.SourceAdmin || state.Reason != "drained wallet" {
+			t.Fatalf("expected the first pause to be kept, got %+v", state)
+		}
+
+		b.Resume()
+
+		if b.Check() != nil || b.State().Paused {
+			t.Fatal("expected the breaker to be resumed")
+		}
+	})
+
+	t.Run("test reverts trip the breaker", func(t *testing.T) {
+		b := breaker.New(breaker.Thresholds{Reverts: 3})
+
+		b.Reverted()
+		b.Reverted()
+
+		if b.Check() != nil {
+			t.Fatal("expected the breaker to hold below the threshold")
+		}
+
+		b.Reverted()
+
+		if state := b.State(); !state.Paused || state.Source != breaker.SourceAuto {
+			t.Fatalf("expected the breaker to trip, got %+v", state)
+		}
+	})
+
+	t.Run("test spend trips the breaker", func(t *testing.T) {
+		b := breaker.New(breaker.Thresholds{MaxSpend: big.NewInt(100)})
+
+		b.Spent(big.NewInt(60))
+		b.Spent(big.NewInt(40))
+
+		if b.Check() != nil {
+			t.Fatal("expected the breaker to hold up to the threshold")
+		}
+
+		b.Spent(big.NewInt(1))
+
+		if !paused(b.Check()) {
+			t.Fatal("expected the breaker to trip")
+		}
+	})
+
+	t.Run("test a paused community does not spend", func(t *testing.T) {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c := community.Prepare(nil, key, crypto.PubkeyToAddress(key.PublicKey), cw.ChainConfig{ChainID: 1})
+		c.Breaker = breaker.New(breaker.Thresholds{})
+		c.Breaker.Pause(breaker.SourceAdmin, "exploited policy")
+
+		_, err = c.NewTransactor(context.Background())
+		if !paused(err) {
+			t.Fatalf("expected a paused error, got %v", err)
+		}
+
+		_, err = c.SponsorOp(context.Background(), common.HexToAddress("0x1"), community.UserOp{})
+		if !paused(err) {
+			t.Fatalf("expected a paused error, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,176 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/daobrussels/cw/pkg/client"
+	"github.com/daobrussels/cw/pkg/common/request"
+	"github.com/daobrussels/cw/pkg/common/response"
+	"github.com/daobrussels/cw/pkg/common/supply"
+	"github.com/daobrussels/cw/pkg/community"
+	"github.com/daobrussels/cw/pkg/cw"
+	"github.com/daobrussels/cw/pkg/hello"
+)
+
+// newTestStation serves the handshake, an account creation which responds with the signer of the request,
+// a token accounting which fails the first time and operations which time out at the gateway, counting them
+func newTestStation(t *testing.T, s *supply.Supply, ops *atomic.Int32) *httptest.Server {
+	responder := response.NewResponder(s)
+	hello := hello.NewHandlers(cw.ChainConfig{Name: "test", ChainID: 1337}, responder)
+
+	calls := 0
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hello", hello.Hello)
+	mux.HandleFunc("/community/account", func(w http.ResponseWriter, r *http.Request) {
+		var sec struct {
+			Secure string `json:"secure"`
+		}
+
+		err := json.NewDecoder(r.Body).Decode(&sec)
+		if err != nil {
+			responder.Error(w, r.Context(), response.BadRequest(err))
+			return
+		}
+
+		req, err := request.Decrypt(s.PrivateHexKey, sec.Secure)
+		if err != nil || !req.VerifySignature(r.Header.Get(cw.SignatureHeader)) {
+			responder.Error(w, r.Context(), response.ErrUnauthorized)
+			return
+		}
+
+		responder.EncryptedBody(w, r.Context(), response.AddressResponse{Address: req.Address})
+	})
+	mux.HandleFunc("/community/paymaster/accounting", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			responder.Error(w, r.Context(), errors.New("nonce too low"))
+			return
+		}
+
+		responder.EncryptedBody(w, r.Context(), community.TokenAccounting{Collected: "42"})
+	})
+	mux.HandleFunc("/community/op", func(w http.ResponseWriter, r *http.Request) {
+		ops.Add(1)
+
+		// the station may have submitted the operation before the gateway gave up
+		http.Error(w, http.StatusText(http.StatusGatewayTimeout), http.StatusGatewayTimeout)
+	})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), cw.ContextKeyPubKey, r.Header.Get(cw.PubKeyHeader))
+		mux.ServeHTTP(w, r.WithContext(ctx))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestClient(t *testing.T) {
+	station, err := supply.New(reqprivhexkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ops atomic.Int32
+
+	srv := newTestStation(t, station, &ops)
+
+	ctx := context.Background()
+
+	t.Run("test requests before the handshake", func(t *testing.T) {
+		c, err := client.New(srv.URL, txprivhexkey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = c.CreateAccount(ctx)
+		if err != client.ErrNoHandshake {
+			t.Fatalf("expected %v, got %v", client.ErrNoHandshake, err)
+		}
+	})
+
+	t.Run("test handshake with an unexpected station", func(t *testing.T) {
+		c, err := client.New(srv.URL, txprivhexkey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c.Station = txreceivingAddress
+
+		err = c.Hello(ctx)
+		if err != client.ErrUnexpectedServer {
+			t.Fatalf("expected %v, got %v", client.ErrUnexpectedServer, err)
+		}
+	})
+
+	c, err := client.New(srv.URL, txprivhexkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Station = station.Address
+	c.Backoff = time.Millisecond
+
+	t.Run("test handshake", func(t *testing.T) {
+		err := c.Hello(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if c.Chain.ChainID != 1337 {
+			t.Fatalf("expected the chain of the station, got %v", c.Chain)
+		}
+	})
+
+	t.Run("test signed request", func(t *testing.T) {
+		addr, err := c.CreateAccount(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if addr != c.Address() {
+			t.Fatalf("expected the station to recover %s, got %s", c.Address().Hex(), addr.Hex())
+		}
+	})
+
+	t.Run("test retry of a retryable error", func(t *testing.T) {
+		acc, err := c.TokenAccounting(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if acc.Collected != "42" {
+			t.Fatalf("expected the accounting of the second attempt, got %v", acc)
+		}
+	})
+
+	t.Run("test no retry of an operation which timed out", func(t *testing.T) {
+		err := c.SubmitOp(ctx, []byte{0x1})
+
+		var e *response.Error
+		if !errors.As(err, &e) || e.Status != http.StatusGatewayTimeout {
+			t.Fatalf("expected a gateway timeout, got %v", err)
+		}
+
+		if ops.Load() != 1 {
+			t.Fatalf("expected the operation to be submitted once, got %d", ops.Load())
+		}
+	})
+
+	t.Run("test error response", func(t *testing.T) {
+		_, err := c.Balances(ctx, c.Address())
+
+		var e *response.Error
+		if !errors.As(err, &e) || e.Code != response.CodeNotFound {
+			t.Fatalf("expected a not found error, got %v", err)
+		}
+	})
+}
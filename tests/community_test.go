@@ -47,7 +47,7 @@ func TestCommunity(t *testing.T) {
 	t.Run("test community deploy", func(t *testing.T) {
 
 		// deploy community
-		c, err = community.Deploy(es, s.PrivateKey, maddress, conf.Chain)
+		c, err = community.Deploy(ctx, es, s.PrivateKey, maddress, conf.Chain)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -58,7 +58,7 @@ func TestCommunity(t *testing.T) {
 		println(c.EntryPoint.Hex())
 
 		amount := big.NewInt(int64(wei.EthToWei(1)))
-		err = c.FundPaymaster(amount)
+		err = c.FundPaymaster(ctx, amount)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -71,7 +71,7 @@ func TestCommunity(t *testing.T) {
 		owner := common.HexToAddress(nobalancehexaddr)
 
 		// create an account
-		accaddr, err := c.CreateAccount(owner)
+		accaddr, err := c.CreateAccount(ctx, owner)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -79,7 +79,7 @@ func TestCommunity(t *testing.T) {
 		println("Account address:")
 		println(accaddr.Hex())
 
-		grtaddr, err := c.CreateGratitudeApp(*accaddr)
+		grtaddr, err := c.CreateGratitudeApp(ctx, *accaddr)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -88,7 +88,7 @@ func TestCommunity(t *testing.T) {
 		println(grtaddr.Hex())
 
 		// create a profile for the corresponding account
-		profile, err := c.CreateProfile(*accaddr)
+		profile, err := c.CreateProfile(ctx, *accaddr)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -102,7 +102,7 @@ func TestCommunity(t *testing.T) {
 			log.Fatal(err)
 		}
 
-		acccep, err := acc.EntryPoint(&bind.CallOpts{})
+		acccep, err := acc.EntryPoint(&bind.CallOpts{Context: ctx})
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -120,7 +120,7 @@ func TestCommunity(t *testing.T) {
 			log.Fatal(err)
 		}
 
-		pep, err := pr.EntryPoint(&bind.CallOpts{})
+		pep, err := pr.EntryPoint(&bind.CallOpts{Context: ctx})
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -0,0 +1,52 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/daobrussels/cw/pkg/server"
+)
+
+func TestCORS(t *testing.T) {
+	t.Run("test any origin", func(t *testing.T) {
+		conf := server.DefaultConfig().CORS
+
+		origin, ok := conf.AllowedOrigin("https://example.org")
+		if !ok || origin != server.AnyOrigin {
+			t.Fatalf("expected any origin to be allowed by default, got %q %v", origin, ok)
+		}
+	})
+
+	t.Run("test listed origins", func(t *testing.T) {
+		conf := server.CORS{Origins: []string{"https://wallet.example.org"}, Credentials: true}
+
+		err := conf.Validate()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the origin of the request is echoed so that credentials can be sent
+		origin, ok := conf.AllowedOrigin("https://Wallet.example.org")
+		if !ok || origin != "https://Wallet.example.org" {
+			t.Fatalf("expected the origin to be allowed, got %q %v", origin, ok)
+		}
+
+		for _, o := range []string{"https://evil.example.org", ""} {
+			_, ok = conf.AllowedOrigin(o)
+			if ok {
+				t.Fatalf("expected %q not to be allowed", o)
+			}
+		}
+	})
+
+	t.Run("test invalid policies", func(t *testing.T) {
+		err := server.CORS{Origins: []string{server.AnyOrigin}, Credentials: true}.Validate()
+		if err != server.ErrCredentialsAnyOrigin {
+			t.Fatalf("expected %v, got %v", server.ErrCredentialsAnyOrigin, err)
+		}
+
+		err = server.CORS{Origins: []string{""}}.Validate()
+		if err != server.ErrEmptyOrigin {
+			t.Fatalf("expected %v, got %v", server.ErrEmptyOrigin, err)
+		}
+	})
+}
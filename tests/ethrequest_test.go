@@ -0,0 +1,198 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/daobrussels/cw/pkg/common/ethrequest"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestEthServiceCalls(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("test retry of a transient error", func(t *testing.T) {
+		var calls int32
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x2a"}`))
+		}))
+		defer srv.Close()
+
+		es, err := ethrequest.NewEthService(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer es.Close()
+
+		es.Config.Backoff = time.Millisecond
+
+		n, err := es.BlockNumber(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if n != 42 || atomic.LoadInt32(&calls) != 2 {
+			t.Fatalf("expected block 42 on the second call, got %d after %d calls", n, calls)
+		}
+	})
+
+	t.Run("test no retry of a transaction", func(t *testing.T) {
+		var calls int32
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer srv.Close()
+
+		es, err := ethrequest.NewEthService(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer es.Close()
+
+		es.Config.Backoff = time.Millisecond
+
+		_, err = es.SendRawTransaction(ctx, "0x00")
+		if err == nil {
+			t.Fatal("expected the transaction to fail")
+		}
+
+		if atomic.LoadInt32(&calls) != 1 {
+			t.Fatalf("expected a single attempt, got %d", calls)
+		}
+	})
+
+	t.Run("test pending transactions", func(t *testing.T) {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		to := common.HexToAddress("0x1")
+
+		tx, err := types.SignTx(types.NewTransaction(7, to, big.NewInt(0), 21000, big.NewInt(1), nil), types.LatestSignerForChainID(big.NewInt(1)), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the transaction is accepted but never mined
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var msg struct {
+				ID     json.RawMessage `json:"id"`
+				Method string          `json:"method"`
+			}
+			json.NewDecoder(r.Body).Decode(&msg)
+
+			result := "null"
+			if msg.Method == ethrequest.ETHSendRawTransaction {
+				result = `"` + tx.Hash().Hex() + `"`
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":%s}`, msg.ID, result)
+		}))
+		defer srv.Close()
+
+		es, err := ethrequest.NewEthService(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		raw, err := tx.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = es.SendRawTransaction(ctx, hexutil.Encode(raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pending := es.Pending()
+		if len(pending) != 1 || pending[0].Hash != tx.Hash() || pending[0].Nonce != 7 || *pending[0].To != to {
+			t.Fatalf("expected the sent transaction to be pending, got %+v", pending)
+		}
+
+		// closing the service ends the watch of the transaction
+		es.Close()
+
+		deadline := time.Now().Add(time.Second)
+		for len(es.Pending()) > 0 {
+			if time.Now().After(deadline) {
+				t.Fatal("expected the transaction to be dropped once it is no longer watched")
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+
+	// hung calls never get a response until the test ends
+	hung := make(chan struct{})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-hung
+	}))
+	defer srv.Close()
+	defer close(hung)
+
+	t.Run("test timeout of a hung call", func(t *testing.T) {
+		es, err := ethrequest.NewEthService(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer es.Close()
+
+		es.Config = ethrequest.Config{Timeout: 10 * time.Millisecond}
+
+		_, err = es.BlockNumber(ctx)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+		}
+	})
+
+	t.Run("test close cancels calls in flight", func(t *testing.T) {
+		es, err := ethrequest.NewEthService(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		es.Config = ethrequest.Config{}
+
+		errc := make(chan error, 1)
+		go func() {
+			_, err := es.BlockNumber(ctx)
+			errc <- err
+		}()
+
+		time.Sleep(10 * time.Millisecond)
+		es.Close()
+
+		select {
+		case err := <-errc:
+			if err == nil {
+				t.Fatal("expected the call to be cancelled")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected the call to end when the service is closed")
+		}
+	})
+}
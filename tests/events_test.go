@@ -0,0 +1,84 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/daobrussels/cw/pkg/common/ethrequest"
+	"github.com/daobrussels/cw/pkg/events"
+	"github.com/ethereum/go-ethereum"
+)
+
+// headStub answers the calls of a listener on a chain whose head is at the provided block, without any logs
+type headStub struct {
+	head uint64
+}
+
+func (s headStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var msg struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+	}
+	json.NewDecoder(r.Body).Decode(&msg)
+
+	result := `[]`
+	if msg.Method == "eth_blockNumber" {
+		result = fmt.Sprintf(`"0x%x"`, s.head)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":%s}`, msg.ID, result)
+}
+
+func TestListener(t *testing.T) {
+	listen := func(t *testing.T, head uint64) []events.Batch {
+		srv := httptest.NewServer(headStub{head})
+		defer srv.Close()
+
+		es, err := ethrequest.NewEthService(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer es.Close()
+
+		l := events.NewListener(es, ethereum.FilterQuery{})
+
+		batches := []events.Batch{}
+		l.Subscribe(func(b events.Batch) error {
+			batches = append(batches, b)
+			return nil
+		})
+
+		// the first poll happens right away
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		err = l.Listen(ctx, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return batches
+	}
+
+	t.Run("test blocks are handled once confirmed", func(t *testing.T) {
+		batches := listen(t, 20)
+
+		if len(batches) != 1 || batches[0].FromBlock != 0 || batches[0].ToBlock != 20-events.DefaultConfirmations {
+			t.Fatalf("expected blocks 0 to %d, got %+v", 20-events.DefaultConfirmations, batches)
+		}
+	})
+
+	t.Run("test unconfirmed blocks are left", func(t *testing.T) {
+		batches := listen(t, events.DefaultConfirmations-1)
+
+		if len(batches) != 0 {
+			t.Fatalf("expected no blocks to be handled, got %+v", batches)
+		}
+	})
+}
@@ -0,0 +1,258 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/daobrussels/cw/pkg/common/ethrequest"
+	"github.com/daobrussels/cw/pkg/community"
+	"github.com/daobrussels/cw/pkg/cw"
+	"github.com/daobrussels/smartcontracts/pkg/contracts/gratitude"
+	"github.com/daobrussels/smartcontracts/pkg/contracts/grfactory"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// logStub answers eth_call with a fixed result and eth_getLogs with the logs of the factories
+// when the query is filtered by address, with the other logs otherwise. Receipts hold the logs of the apps.
+type logStub struct {
+	call    string
+	factory []*types.Log
+	apps    []*types.Log
+
+	// queried is called with the addresses of the queries filtered by address
+	queried func(addrs []common.Address)
+}
+
+func (s logStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var msg struct {
+		ID     json.RawMessage   `json:"id"`
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	json.NewDecoder(r.Body).Decode(&msg)
+
+	var result any
+
+	switch msg.Method {
+	case "eth_call":
+		result = s.call
+	case "eth_blockNumber":
+		result = "0x20"
+	case "eth_getBlockByNumber":
+		result = &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(0)}
+	case "eth_getTransactionReceipt":
+		logs := []*types.Log{}
+		logs = append(logs, s.apps...)
+		result = &types.Receipt{Status: 1, Logs: logs}
+	case "eth_getLogs":
+		var q struct {
+			Address []common.Address `json:"address"`
+		}
+		json.Unmarshal(msg.Params[0], &q)
+
+		result = s.apps
+		if q.Address != nil {
+			result = s.factory
+
+			if s.queried != nil {
+				s.queried(q.Address)
+			}
+		}
+	}
+
+	b, _ := json.Marshal(result)
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":%s}`, msg.ID, b)
+}
+
+func TestGratitude(t *testing.T) {
+	ctx := context.Background()
+
+	gabi, err := gratitude.GratitudeMetaData.GetAbi()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fabi, err := grfactory.GrfactoryMetaData.GetAbi()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	owner := common.HexToAddress(nobalancehexaddr)
+	other := common.HexToAddress(nobalancehexaddr2)
+
+	addr := community.CommunityAddress{
+		Gateway:          common.HexToAddress("0x1"),
+		Paymaster:        common.HexToAddress("0x2"),
+		AccountFactory:   common.HexToAddress("0x3"),
+		GratitudeFactory: common.HexToAddress("0x4"),
+		ProfileFactory:   common.HexToAddress("0x5"),
+		Chain:            cw.ChainConfig{ChainID: 1},
+		Manifest: &community.Manifest{
+			Contracts: map[string]community.ContractRecord{
+				community.ContractGratitudeFactory: {Address: common.HexToAddress("0x4"), Block: 10},
+			},
+		},
+	}
+
+	newCommunity := func(t *testing.T, stub http.Handler, addr community.CommunityAddress) *community.Community {
+		srv := httptest.NewServer(stub)
+		t.Cleanup(srv.Close)
+
+		es, err := ethrequest.NewEthService(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(es.Close)
+
+		c, err := community.New(es, key, crypto.PubkeyToAddress(key.PublicKey), addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return c
+	}
+
+	newLog := func(address common.Address, tx common.Hash, topics ...common.Hash) *types.Log {
+		return &types.Log{Address: address, Topics: topics, Data: []byte{}, BlockNumber: 11, TxHash: tx}
+	}
+
+	created := fabi.Events["GratitudeTokenCreated"].ID
+	initialized := gabi.Events["GratitudeTokenInitialized"].ID
+	entryPoint := common.BytesToHash(addr.Gateway.Bytes())
+
+	t.Run("test apps are those created by the factories", func(t *testing.T) {
+		app := common.HexToAddress("0xa1")
+
+		stub := logStub{
+			factory: []*types.Log{
+				newLog(addr.GratitudeFactory, common.HexToHash("0x1"), created, common.BytesToHash(owner.Bytes())),
+			},
+			apps: []*types.Log{
+				newLog(app, common.HexToHash("0x1"), initialized, entryPoint, common.BytesToHash(owner.Bytes())),
+				// initialized by a contract which no factory created
+				newLog(common.HexToAddress("0xa2"), common.HexToHash("0x2"), initialized, entryPoint, common.BytesToHash(owner.Bytes())),
+				// created in the same transaction for another owner
+				newLog(common.HexToAddress("0xa3"), common.HexToHash("0x1"), initialized, entryPoint, common.BytesToHash(other.Bytes())),
+			},
+		}
+
+		c := newCommunity(t, stub, addr)
+
+		apps, err := c.GratitudeApps(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(apps) != 1 || apps[0].Address != app || apps[0].Owner != owner {
+			t.Fatalf("expected app %s owned by %s, got %+v", app, owner, apps)
+		}
+	})
+
+	t.Run("test apps need the deploy block of the factory", func(t *testing.T) {
+		noManifest := addr
+		noManifest.Manifest = nil
+
+		c := newCommunity(t, logStub{}, noManifest)
+
+		_, err := c.GratitudeApps(ctx, &owner)
+		if err != community.ErrUnknownDeployBlock {
+			t.Fatalf("expected %v, got %v", community.ErrUnknownDeployBlock, err)
+		}
+	})
+
+	t.Run("test apps created while listening are tracked", func(t *testing.T) {
+		app := common.HexToAddress("0xa1")
+
+		var watched atomic.Bool
+
+		stub := logStub{
+			factory: []*types.Log{
+				newLog(addr.GratitudeFactory, common.HexToHash("0x1"), created, common.BytesToHash(owner.Bytes())),
+			},
+			// the receipt of the transaction which created the app
+			apps: []*types.Log{
+				newLog(app, common.HexToHash("0x1"), initialized, entryPoint, common.BytesToHash(owner.Bytes())),
+			},
+			queried: func(addrs []common.Address) {
+				for _, a := range addrs {
+					if a == app {
+						watched.Store(true)
+					}
+				}
+			},
+		}
+
+		c := newCommunity(t, stub, addr)
+		c.Events.Confirmations = 0
+		c.Events.BatchSize = 10
+
+		ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+
+		err := c.Events.Listen(ctx, 11)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !watched.Load() {
+			t.Fatal("expected the transfers of the app to be followed")
+		}
+
+		apps, err := c.GratitudeApps(context.Background(), &owner)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(apps) != 1 || apps[0].Address != app {
+			t.Fatalf("expected app %s, got %+v", app, apps)
+		}
+	})
+
+	// owner() of both the account and the app returns the owner
+	owned := logStub{call: "0x" + common.Bytes2Hex(common.LeftPadBytes(owner.Bytes(), 32))}
+
+	t.Run("test mints are limited", func(t *testing.T) {
+		c := newCommunity(t, owned, addr)
+
+		err := c.Controls.SetMint(community.MintLimit{MaxAmount: big.NewInt(10)})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = c.MintGratitude(ctx, owner, other, common.HexToAddress("0xa1"), []common.Address{owner}, []*big.Int{big.NewInt(11)})
+		if err != community.ErrMintLimit {
+			t.Fatalf("expected %v, got %v", community.ErrMintLimit, err)
+		}
+	})
+
+	t.Run("test only the account owning the app can mint", func(t *testing.T) {
+		c := newCommunity(t, owned, addr)
+
+		// the caller owns the account, which does not own the app
+		err := c.MintGratitude(ctx, owner, other, common.HexToAddress("0xa1"), []common.Address{owner}, []*big.Int{big.NewInt(1)})
+		if err != community.ErrNotAppOwner {
+			t.Fatalf("expected %v, got %v", community.ErrNotAppOwner, err)
+		}
+
+		err = c.MintGratitude(ctx, other, other, common.HexToAddress("0xa1"), []common.Address{owner}, []*big.Int{big.NewInt(1)})
+		if err != community.ErrNotAccountOwner {
+			t.Fatalf("expected %v, got %v", community.ErrNotAccountOwner, err)
+		}
+	})
+}
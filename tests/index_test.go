@@ -0,0 +1,183 @@
+package tests
+
+import (
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/daobrussels/cw/pkg/community"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+func TestIndex(t *testing.T) {
+	account := common.HexToAddress(nobalancehexaddr)
+	other := common.HexToAddress(nobalancehexaddr2)
+	token := common.HexToAddress(reqaddress)
+	gratitude := common.HexToAddress(txreceivingAddress)
+
+	start := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	// one transfer per block, alternating directions and tokens
+	txs := []community.Transaction{}
+	for i := 0; i < 10; i++ {
+		tx := community.Transaction{
+			Account:   account,
+			Block:     uint64(100 + i),
+			Time:      start.Add(time.Duration(i) * time.Hour),
+			Type:      community.TxTransfer,
+			Direction: community.DirectionOut,
+			Token:     &token,
+			From:      account,
+			To:        other,
+			Value:     (*hexutil.Big)(big.NewInt(int64(i))),
+		}
+
+		if i%2 == 1 {
+			tx.Direction = community.DirectionIn
+			tx.From, tx.To = other, account
+		}
+
+		if i%5 == 4 {
+			tx.Token = &gratitude
+		}
+
+		txs = append(txs, tx)
+	}
+
+	path := filepath.Join(t.TempDir(), "test.index")
+
+	idx, err := community.OpenIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	err = idx.Put(txs, 120)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("test last indexed block", func(t *testing.T) {
+		last, ok, err := idx.LastBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !ok || last != 120 {
+			t.Fatalf("expected last block 120, got %d", last)
+		}
+	})
+
+	t.Run("test pages follow each other most recent first", func(t *testing.T) {
+		blocks := []uint64{}
+
+		q := community.TransactionQuery{Limit: 4}
+		for {
+			page, err := idx.Transactions(account, q)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, tx := range page.Transactions {
+				blocks = append(blocks, tx.Block)
+			}
+
+			if len(page.Transactions) > 4 {
+				t.Fatalf("expected at most 4 transactions on a page, got %d", len(page.Transactions))
+			}
+
+			if page.Next == "" {
+				break
+			}
+
+			q.Cursor = page.Next
+		}
+
+		if len(blocks) != 10 || blocks[0] != 109 || blocks[9] != 100 {
+			t.Fatalf("expected blocks 109 to 100, got %v", blocks)
+		}
+	})
+
+	t.Run("test resume after a transaction", func(t *testing.T) {
+		page, err := idx.Transactions(account, community.TransactionQuery{Limit: 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the third most recent transaction is in block 107
+		missed, err := idx.After(account, page.Transactions[2].Cursor(), 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(missed) != 2 || missed[0].Block != 108 || missed[1].Block != 109 {
+			t.Fatalf("expected blocks 108 and 109, got %v", missed)
+		}
+
+		if page.Next != page.Transactions[2].Cursor() {
+			t.Fatalf("expected the next page to start after the last transaction, got %s", page.Next)
+		}
+	})
+
+	t.Run("test filters", func(t *testing.T) {
+		page, err := idx.Transactions(account, community.TransactionQuery{Direction: community.DirectionIn})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(page.Transactions) != 5 || page.Next != "" {
+			t.Fatalf("expected 5 incoming transactions on a single page, got %d", len(page.Transactions))
+		}
+
+		page, err = idx.Transactions(account, community.TransactionQuery{Token: &gratitude})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(page.Transactions) != 2 {
+			t.Fatalf("expected 2 transactions of the token, got %d", len(page.Transactions))
+		}
+
+		page, err = idx.Transactions(account, community.TransactionQuery{Token: &gratitude, Limit: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		page, err = idx.Transactions(account, community.TransactionQuery{Token: &gratitude, Cursor: page.Next})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(page.Transactions) != 1 || page.Transactions[0].Block != 104 || page.Next != "" {
+			t.Fatalf("expected the oldest transaction of the token on the last page, got %v", page.Transactions)
+		}
+
+		page, err = idx.Transactions(account, community.TransactionQuery{
+			Since: start.Add(2 * time.Hour),
+			Until: start.Add(5 * time.Hour),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(page.Transactions) != 4 || page.Transactions[0].Block != 105 {
+			t.Fatalf("expected blocks 105 to 102, got %v", page.Transactions)
+		}
+
+		page, err = idx.Transactions(other, community.TransactionQuery{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(page.Transactions) != 0 {
+			t.Fatalf("expected no transactions indexed for the other account, got %d", len(page.Transactions))
+		}
+
+		_, err = idx.Transactions(account, community.TransactionQuery{Cursor: "0x01"})
+		if err != community.ErrInvalidCursor {
+			t.Fatalf("expected an invalid cursor, got %v", err)
+		}
+	})
+}
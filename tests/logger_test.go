@@ -0,0 +1,100 @@
+package tests
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/daobrussels/cw/pkg/cw"
+	"github.com/daobrussels/cw/pkg/logger"
+	"github.com/daobrussels/cw/pkg/router"
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/exp/slog"
+)
+
+func TestRequestID(t *testing.T) {
+	def := slog.Default()
+	t.Cleanup(func() {
+		slog.SetDefault(def)
+	})
+
+	var buf bytes.Buffer
+
+	err := logger.Setup(&buf, logger.FormatJSON, "debug")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cr := chi.NewRouter()
+	cr.Use(router.RequestIDMiddleware)
+	cr.Get("/hello", func(w http.ResponseWriter, r *http.Request) {
+		logger.From(r.Context()).Info("handled")
+	})
+
+	// records returns the request ids of the records logged while serving a request
+	records := func() []string {
+		var ids []string
+
+		scanner := bufio.NewScanner(&buf)
+		for scanner.Scan() {
+			var rec map[string]any
+
+			err := json.Unmarshal(scanner.Bytes(), &rec)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			id, _ := rec["request_id"].(string)
+			ids = append(ids, id)
+		}
+
+		buf.Reset()
+
+		return ids
+	}
+
+	t.Run("test provided request id", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/hello", nil)
+		req.Header.Set(cw.RequestIDHeader, "client-42")
+
+		w := httptest.NewRecorder()
+		cr.ServeHTTP(w, req)
+
+		if id := w.Header().Get(cw.RequestIDHeader); id != "client-42" {
+			t.Fatalf("expected the provided request id, got %s", id)
+		}
+
+		ids := records()
+		if len(ids) != 2 {
+			t.Fatalf("expected the handler and the request to be logged, got %d records", len(ids))
+		}
+
+		for _, id := range ids {
+			if id != "client-42" {
+				t.Fatalf("expected records tagged with the request id, got %s", id)
+			}
+		}
+	})
+
+	t.Run("test generated request id", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/hello", nil)
+		req.Header.Set(cw.RequestIDHeader, "not a\nvalid id")
+
+		w := httptest.NewRecorder()
+		cr.ServeHTTP(w, req)
+
+		id := w.Header().Get(cw.RequestIDHeader)
+		if id == "" || id == "not a\nvalid id" {
+			t.Fatalf("expected a generated request id, got %q", id)
+		}
+
+		for _, rid := range records() {
+			if rid != id {
+				t.Fatalf("expected records tagged with %s, got %s", id, rid)
+			}
+		}
+	})
+}
@@ -0,0 +1,341 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/daobrussels/cw/pkg/common/ethrequest"
+	"github.com/daobrussels/cw/pkg/community"
+	"github.com/daobrussels/cw/pkg/cw"
+	"github.com/daobrussels/smartcontracts/pkg/contracts/accfactory"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// countSends counts the transactions sent to the chain answered by the handler
+func countSends(h http.Handler, sent *atomic.Int32) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+
+		var msg struct {
+			Method string `json:"method"`
+		}
+		json.Unmarshal(b, &msg)
+
+		if msg.Method == "eth_sendRawTransaction" {
+			sent.Add(1)
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(b))
+		h.ServeHTTP(w, r)
+	})
+}
+
+func TestResume(t *testing.T) {
+	chain := cw.ChainConfig{ChainID: 1}
+
+	prepare := func(t *testing.T, stub opStub, sent *atomic.Int32) *community.Community {
+		srv := httptest.NewServer(countSends(stub, sent))
+		t.Cleanup(srv.Close)
+
+		es, err := ethrequest.NewEthService(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(es.Close)
+
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return community.Prepare(es, key, crypto.PubkeyToAddress(key.PublicKey), chain)
+	}
+
+	// a deployment of the gateway which was sent before the deploy command stopped
+	interrupted := func(t *testing.T) community.CommunityAddress {
+		var sent atomic.Int32
+
+		c := prepare(t, opStub{pending: true}, &sent)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var progress community.CommunityAddress
+
+		err := c.Resume(ctx, community.CommunityAddress{Chain: chain}, func(addr community.CommunityAddress) error {
+			progress = addr
+			cancel()
+			return nil
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected the deployment to be interrupted, got %v", err)
+		}
+
+		return progress
+	}
+
+	t.Run("test deployments are saved once sent", func(t *testing.T) {
+		progress := interrupted(t)
+
+		if progress.Gateway == (common.Address{}) || progress.Manifest == nil {
+			t.Fatalf("expected the gateway to be saved, got %+v", progress)
+		}
+
+		r := progress.Manifest.Contracts[community.ContractGateway]
+		if r.Address != progress.Gateway || r.DeployTx == (common.Hash{}) || r.Block != 0 {
+			t.Fatalf("expected a pending deployment of the gateway, got %+v", r)
+		}
+	})
+
+	t.Run("test pending deployments are confirmed on resume", func(t *testing.T) {
+		progress := interrupted(t)
+
+		var sent atomic.Int32
+
+		c := prepare(t, opStub{status: 1}, &sent)
+
+		err := c.Resume(context.Background(), progress, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r := c.Manifest().Contracts[community.ContractGateway]
+		if r.Address != progress.Gateway || r.Block != 1 {
+			t.Fatalf("expected the gateway deployment to be confirmed, got %+v", r)
+		}
+
+		// the gateway is not sent again, the other four contracts are deployed
+		if sent.Load() != 4 {
+			t.Fatalf("expected 4 deployments, got %d", sent.Load())
+		}
+	})
+
+	t.Run("test reverted deployments are sent again on resume", func(t *testing.T) {
+		progress := interrupted(t)
+
+		var sent atomic.Int32
+
+		c := prepare(t, opStub{status: 0}, &sent)
+
+		err := c.Resume(context.Background(), progress, nil)
+		if err == nil {
+			t.Fatal("expected the new deployment to revert as well")
+		}
+
+		if sent.Load() != 1 {
+			t.Fatalf("expected the gateway to be deployed again, got %d deployments", sent.Load())
+		}
+	})
+}
+
+func TestMigrate(t *testing.T) {
+	var sent atomic.Int32
+
+	// blocks of the new factory each time the community is saved
+	var saved []uint64
+
+	old := common.HexToAddress("0x3")
+
+	c := stubCommunity(t, countSends(opStub{status: 1}, &sent), common.HexToAddress("0x1"), func(addr *community.CommunityAddress) {
+		addr.Manifest = &community.Manifest{
+			Version: community.ManifestVersion,
+			Contracts: map[string]community.ContractRecord{
+				community.ContractAccountFactory: {Address: old, Block: 5},
+			},
+		}
+	})
+
+	err := c.Migrate(context.Background(), community.ContractAccountFactory, func(addr community.CommunityAddress) error {
+		saved = append(saved, addr.Manifest.Contracts[community.ContractAccountFactory].Block)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(saved) != 2 || saved[0] != 0 || saved[1] != 1 {
+		t.Fatalf("expected the migration to be saved once sent and once mined, got blocks %v", saved)
+	}
+
+	factories := c.AccountFactories()
+	if len(factories) != 2 || factories[0] == old || factories[1] != old {
+		t.Fatalf("expected the new factory followed by the replaced one, got %v", factories)
+	}
+
+	if sent.Load() != 1 {
+		t.Fatalf("expected a single deployment, got %d", sent.Load())
+	}
+}
+
+// accountStub answers the calls of account factories, the account of every factory is at its own address
+type accountStub struct {
+	opStub
+
+	mu       sync.Mutex
+	deployed map[common.Address]bool // whether accounts exist, other addresses have code
+	sent     *types.Transaction      // last transaction sent
+}
+
+// accountAt returns the address of the account created by a factory
+func accountAt(factory common.Address) common.Address {
+	return common.BytesToAddress(crypto.Keccak256(factory.Bytes()))
+}
+
+func (s *accountStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b, _ := io.ReadAll(r.Body)
+
+	var msg struct {
+		ID     json.RawMessage   `json:"id"`
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	json.Unmarshal(b, &msg)
+
+	var result any
+
+	switch msg.Method {
+	case "eth_call":
+		var call struct {
+			To common.Address `json:"to"`
+		}
+		json.Unmarshal(msg.Params[0], &call)
+
+		result = hexutil.Bytes(common.LeftPadBytes(accountAt(call.To).Bytes(), 32))
+	case "eth_getCode":
+		var addr common.Address
+		json.Unmarshal(msg.Params[0], &addr)
+
+		s.mu.Lock()
+		result = hexutil.Bytes{0x60, 0x80}
+		if deployed, ok := s.deployed[addr]; ok && !deployed {
+			result = hexutil.Bytes{}
+		}
+		s.mu.Unlock()
+	case "eth_sendRawTransaction":
+		var raw hexutil.Bytes
+		json.Unmarshal(msg.Params[0], &raw)
+
+		tx := new(types.Transaction)
+		tx.UnmarshalBinary(raw)
+
+		s.mu.Lock()
+		s.sent = tx
+		s.mu.Unlock()
+
+		result = tx.Hash()
+	default:
+		r.Body = io.NopCloser(bytes.NewReader(b))
+		s.opStub.ServeHTTP(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": msg.ID, "result": result})
+}
+
+// last returns the last transaction sent
+func (s *accountStub) last() *types.Transaction {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.sent
+}
+
+// deploy sets whether an account exists
+func (s *accountStub) deploy(account common.Address, deployed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deployed[account] = deployed
+}
+
+func TestCreateAccount(t *testing.T) {
+	ctx := context.Background()
+
+	owner := common.HexToAddress(nobalancehexaddr)
+	old := common.HexToAddress("0x3")
+
+	stub := &accountStub{opStub: opStub{status: 1}, deployed: map[common.Address]bool{}}
+
+	c := stubCommunity(t, stub, common.HexToAddress("0x1"), func(addr *community.CommunityAddress) {
+		addr.Manifest = &community.Manifest{
+			Version: community.ManifestVersion,
+			Contracts: map[string]community.ContractRecord{
+				community.ContractAccountFactory: {Address: old, Block: 5},
+			},
+		}
+	})
+
+	err := c.Migrate(ctx, community.ContractAccountFactory, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	current := c.AccountFactories()[0]
+
+	stub.deploy(accountAt(old), false)
+	stub.deploy(accountAt(current), false)
+
+	t.Run("test accounts of a replaced factory are found after a migration", func(t *testing.T) {
+		stub.deploy(accountAt(old), true)
+		defer stub.deploy(accountAt(old), false)
+
+		migrated := stub.last()
+
+		acc, err := c.CreateAccount(ctx, owner)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if *acc != accountAt(old) {
+			t.Fatalf("expected the account of the replaced factory %s, got %s", accountAt(old), acc)
+		}
+
+		if stub.last() != migrated {
+			t.Fatal("expected no account to be created")
+		}
+	})
+
+	t.Run("test accounts are created by the current factory with the salt of their owner", func(t *testing.T) {
+		acc, err := c.CreateAccount(ctx, owner)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if *acc != accountAt(current) {
+			t.Fatalf("expected the account of the current factory %s, got %s", accountAt(current), acc)
+		}
+
+		fabi, err := accfactory.AccfactoryMetaData.GetAbi()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tx := stub.last()
+
+		if *tx.To() != current {
+			t.Fatalf("expected the account to be created by %s, got %s", current, tx.To())
+		}
+
+		args, err := fabi.Methods["createAccount"].Inputs.Unpack(tx.Data()[4:])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if args[0].(common.Address) != owner || args[1].(*big.Int).Cmp(community.AccountSalt(owner)) != 0 {
+			t.Fatalf("expected an account of %s salted with its address, got %v", owner, args)
+		}
+	})
+}
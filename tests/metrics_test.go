@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/daobrussels/cw/pkg/common/ethrequest"
+	"github.com/daobrussels/cw/pkg/metrics"
+	"github.com/daobrussels/cw/pkg/router"
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics(t *testing.T) {
+	t.Run("test rpc errors", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"header not found"}}`))
+		}))
+		defer srv.Close()
+
+		u, err := url.Parse(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		es, err := ethrequest.NewEthService(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer es.Close()
+
+		before := testutil.ToFloat64(metrics.RPCErrors.WithLabelValues(u.Host, "eth_blockNumber"))
+
+		_, err = es.BlockNumber(context.Background())
+		if err == nil {
+			t.Fatal("expected the call to fail")
+		}
+
+		after := testutil.ToFloat64(metrics.RPCErrors.WithLabelValues(u.Host, "eth_blockNumber"))
+		if after != before+1 {
+			t.Fatalf("expected one more rpc error, got %v then %v", before, after)
+		}
+	})
+
+	t.Run("test requests by route", func(t *testing.T) {
+		cr := chi.NewRouter()
+		cr.Use(router.MetricsMiddleware)
+		cr.Get("/accounts/{address}/balances", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		})
+
+		counter := metrics.Requests.WithLabelValues("/accounts/{address}/balances", http.MethodGet, "404")
+		before := testutil.ToFloat64(counter)
+
+		for _, addr := range []string{"0x01", "0x02"} {
+			cr.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/accounts/"+addr+"/balances", nil))
+		}
+
+		after := testutil.ToFloat64(counter)
+		if after != before+2 {
+			t.Fatalf("expected both requests to count under the route pattern, got %v then %v", before, after)
+		}
+	})
+}
@@ -0,0 +1,357 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/daobrussels/cw/pkg/common/ethrequest"
+	"github.com/daobrussels/cw/pkg/common/response"
+	"github.com/daobrussels/cw/pkg/common/supply"
+	"github.com/daobrussels/cw/pkg/community"
+	"github.com/daobrussels/cw/pkg/cw"
+	"github.com/daobrussels/cw/pkg/server"
+	"github.com/daobrussels/smartcontracts/pkg/contracts/accfactory"
+	"github.com/daobrussels/smartcontracts/pkg/contracts/paymaster"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestSponsor(t *testing.T) {
+	srv := httptest.NewServer(chainStub{chainID: "0x1"})
+	defer srv.Close()
+
+	es, err := ethrequest.NewEthService(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer es.Close()
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	station := crypto.PubkeyToAddress(key.PublicKey)
+
+	addr := community.CommunityAddress{
+		Gateway:            common.HexToAddress("0x1"),
+		Paymaster:          common.HexToAddress("0x2"),
+		AccountFactory:     common.HexToAddress("0x3"),
+		GratitudeFactory:   common.HexToAddress("0x4"),
+		ProfileFactory:     common.HexToAddress("0x5"),
+		Token:              common.HexToAddress("0x6"),
+		VerifyingPaymaster: common.HexToAddress("0x7"),
+		Chain:              cw.ChainConfig{ChainID: 1},
+	}
+
+	c, err := community.New(es, key, station, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	owner := common.HexToAddress(nobalancehexaddr)
+
+	fabi, err := accfactory.AccfactoryMetaData.GetAbi()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	create, err := fabi.Pack("createAccount", owner, common.Big0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transfer, err := community.ExecuteCallData(addr.Token, common.Big0, []byte{0x01})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newOp := func() community.UserOp {
+		return community.UserOp{
+			Sender:               common.HexToAddress(nobalancehexaddr2),
+			Nonce:                (*hexutil.Big)(common.Big0),
+			InitCode:             append(addr.AccountFactory.Bytes(), create...),
+			CallData:             transfer,
+			CallGasLimit:         (*hexutil.Big)(big.NewInt(100000)),
+			VerificationGasLimit: (*hexutil.Big)(big.NewInt(400000)),
+			MaxFeePerGas:         (*hexutil.Big)(big.NewInt(1000000000)),
+		}
+	}
+
+	t.Run("test sponsorship of an account creation", func(t *testing.T) {
+		op := newOp()
+
+		sp, err := c.SponsorOp(ctx, owner, op)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if sp.ValidUntil <= sp.ValidAfter {
+			t.Fatal("validity window is empty")
+		}
+
+		// paymaster address, 2 abi encoded uint48 and a 65 byte signature
+		if len(sp.PaymasterAndData) != 20+64+65 {
+			t.Fatalf("unexpected paymasterAndData length %d", len(sp.PaymasterAndData))
+		}
+
+		if common.BytesToAddress(sp.PaymasterAndData[:20]) != addr.VerifyingPaymaster {
+			t.Fatal("paymasterAndData does not start with the verifying paymaster address")
+		}
+
+		sig := bytes.Clone(sp.PaymasterAndData[84:])
+		if sig[crypto.RecoveryIDOffset] != 27 && sig[crypto.RecoveryIDOffset] != 28 {
+			t.Fatal("signature does not have an ethereum style recovery id")
+		}
+		sig[crypto.RecoveryIDOffset] -= 27
+
+		hash, err := c.SponsorHash(op, sp.ValidUntil, sp.ValidAfter)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pub, err := crypto.SigToPub(accounts.TextHash(hash.Bytes()), sig)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if crypto.PubkeyToAddress(*pub) != station {
+			t.Fatalf("expected the sponsorship to be signed by %s, got %s", station, crypto.PubkeyToAddress(*pub))
+		}
+	})
+
+	denied := []struct {
+		name  string
+		owner common.Address
+		edit  func(op *community.UserOp)
+	}{
+		{"test sponsorship is denied for another owner", common.HexToAddress(nobalancehexaddr2), func(op *community.UserOp) {}},
+		{"test sponsorship is denied for foreign factories", owner, func(op *community.UserOp) {
+			op.InitCode = append(common.HexToAddress(nobalancehexaddr2).Bytes(), create...)
+		}},
+		{"test sponsorship is denied for other targets", owner, func(op *community.UserOp) {
+			op.CallData, _ = community.ExecuteCallData(common.HexToAddress("0x8"), common.Big0, nil)
+		}},
+		{"test sponsorship is denied for native transfers", owner, func(op *community.UserOp) {
+			op.CallData, _ = community.ExecuteCallData(addr.Token, common.Big1, nil)
+		}},
+		{"test sponsorship is denied above the gas limits", owner, func(op *community.UserOp) {
+			op.CallGasLimit = (*hexutil.Big)(big.NewInt(10000000))
+		}},
+		{"test sponsorship is denied above the fee limit", owner, func(op *community.UserOp) {
+			op.MaxFeePerGas = (*hexutil.Big)(new(big.Int).Mul(big.NewInt(1000), big.NewInt(1000000000000)))
+		}},
+		{"test sponsorship is denied above the pre-verification gas limit", owner, func(op *community.UserOp) {
+			op.PreVerificationGas = (*hexutil.Big)(big.NewInt(10000000))
+		}},
+		{"test sponsorship is denied above the priority fee limit", owner, func(op *community.UserOp) {
+			op.MaxPriorityFeePerGas = (*hexutil.Big)(new(big.Int).Mul(big.NewInt(1000), big.NewInt(1000000000000)))
+		}},
+	}
+
+	for _, tc := range denied {
+		t.Run(tc.name, func(t *testing.T) {
+			op := newOp()
+			tc.edit(&op)
+
+			_, err := c.SponsorOp(ctx, tc.owner, op)
+			if err != community.ErrSponsorshipDenied {
+				t.Fatalf("expected sponsorship to be denied, got %v", err)
+			}
+		})
+	}
+
+	t.Run("test sponsorship of allowed targets", func(t *testing.T) {
+		target := common.HexToAddress("0x8")
+
+		c.SponsorTargets = []common.Address{target}
+		defer func() { c.SponsorTargets = nil }()
+
+		op := newOp()
+		op.CallData, err = community.CallData([]community.Call{{To: addr.Token}, {To: target}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := c.SponsorOp(ctx, owner, op)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("test sponsorship needs a verifying paymaster", func(t *testing.T) {
+		c.VerifyingPaymaster = common.Address{}
+		defer func() { c.VerifyingPaymaster = addr.VerifyingPaymaster }()
+
+		_, err := c.SponsorOp(ctx, owner, newOp())
+		if err != community.ErrNoVerifyingPaymaster {
+			t.Fatalf("expected %v, got %v", community.ErrNoVerifyingPaymaster, err)
+		}
+
+		station, err := supply.New(reqprivhexkey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		h := community.NewHandlers(response.NewResponder(station), nil, server.CORS{})
+
+		body, err := json.Marshal(newOp())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rctx := community.WithCommunity(ctx, c)
+		rctx = context.WithValue(rctx, cw.ContextKeyAddress, owner.Hex())
+
+		req := httptest.NewRequest(http.MethodPost, "/paymaster/sponsor", bytes.NewReader(body)).WithContext(rctx)
+		w := httptest.NewRecorder()
+
+		h.Sponsor(w, req)
+
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("expected %d, got %d", http.StatusNotFound, w.Code)
+		}
+	})
+}
+
+func TestTokenPaymaster(t *testing.T) {
+	// the oracle prices 1 native coin at 0.5 tokens of 6 decimals
+	srv := httptest.NewServer(chainStub{chainID: "0x1", deposit: "0x" + common.Bytes2Hex(common.LeftPadBytes(big.NewInt(500000).Bytes(), 32))})
+	defer srv.Close()
+
+	es, err := ethrequest.NewEthService(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer es.Close()
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr := community.CommunityAddress{
+		Gateway:          common.HexToAddress("0x1"),
+		Paymaster:        common.HexToAddress("0x2"),
+		AccountFactory:   common.HexToAddress("0x3"),
+		GratitudeFactory: common.HexToAddress("0x4"),
+		ProfileFactory:   common.HexToAddress("0x5"),
+		TokenPaymaster: &community.TokenPaymasterConfig{
+			Token:    common.HexToAddress("0x6"),
+			Decimals: 6,
+			Oracle:   common.HexToAddress("0x7"),
+			Treasury: common.HexToAddress("0x8"),
+		},
+		Chain: cw.ChainConfig{ChainID: 1},
+	}
+
+	c, err := community.New(es, key, crypto.PubkeyToAddress(key.PublicKey), addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	t.Run("test token quote from the oracle", func(t *testing.T) {
+		amount, err := c.TokenValueOfWei(ctx, big.NewInt(1000000000000000000))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if amount.Cmp(big.NewInt(500000)) != 0 {
+			t.Fatalf("expected 500000, got %s", amount)
+		}
+	})
+
+	t.Run("test token paymaster needs an oracle", func(t *testing.T) {
+		noOracle := addr
+		noOracle.TokenPaymaster = &community.TokenPaymasterConfig{Token: common.HexToAddress("0x6"), Decimals: 6}
+
+		_, err := community.New(es, key, crypto.PubkeyToAddress(key.PublicKey), noOracle)
+		if err != community.ErrNoTokenOracle {
+			t.Fatalf("expected %v, got %v", community.ErrNoTokenOracle, err)
+		}
+	})
+
+	t.Run("test token paymaster needs a treasury", func(t *testing.T) {
+		noTreasury := addr
+		noTreasury.TokenPaymaster = &community.TokenPaymasterConfig{Token: common.HexToAddress("0x6"), Decimals: 6, Oracle: common.HexToAddress("0x7")}
+
+		_, err := community.New(es, key, crypto.PubkeyToAddress(key.PublicKey), noTreasury)
+		if err != community.ErrNoTreasury {
+			t.Fatalf("expected %v, got %v", community.ErrNoTreasury, err)
+		}
+	})
+
+	t.Run("test token deposit calls", func(t *testing.T) {
+		account := common.HexToAddress(nobalancehexaddr)
+
+		calls, err := c.TokenDepositCalls(account, big.NewInt(100))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(calls) != 3 || calls[0].To != addr.TokenPaymaster.Token || calls[1].To != addr.Paymaster || calls[2].To != addr.Paymaster {
+			t.Fatalf("expected an approval of the token followed by a deposit and a lock, got %+v", calls)
+		}
+
+		pabi, err := paymaster.PaymasterMetaData.GetAbi()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		method, err := pabi.MethodById(calls[1].Data[:4])
+		if err != nil || method.Name != "addDepositFor" {
+			t.Fatalf("expected addDepositFor, got %v", method)
+		}
+
+		args, err := method.Inputs.Unpack(calls[1].Data[4:])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if args[0].(common.Address) != addr.TokenPaymaster.Token || args[1].(common.Address) != account || args[2].(*big.Int).Cmp(big.NewInt(100)) != 0 {
+			t.Fatalf("unexpected deposit %v", args)
+		}
+
+		method, err = pabi.MethodById(calls[2].Data[:4])
+		if err != nil || method.Name != "lockTokenDeposit" {
+			t.Fatalf("expected lockTokenDeposit, got %v", method)
+		}
+	})
+}
+
+func TestDepositTokensDryRun(t *testing.T) {
+	c := stubCommunity(t, opStub{pending: true}, common.HexToAddress("0x1"), func(addr *community.CommunityAddress) {
+		addr.TokenPaymaster = &community.TokenPaymasterConfig{
+			Token:    common.HexToAddress("0x6"),
+			Decimals: 6,
+			Oracle:   common.HexToAddress("0x7"),
+			Treasury: common.HexToAddress("0x8"),
+		}
+	})
+	c.DryRun = true
+
+	err := c.DepositTokensFor(context.Background(), common.HexToAddress(nobalancehexaddr), big.NewInt(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the approval is estimated, the deposit depends on it being mined
+	if len(c.DryRunTxs()) != 1 || *c.DryRunTxs()[0].To() != common.HexToAddress("0x6") {
+		t.Fatalf("expected the approval to be estimated, got %+v", c.DryRunTxs())
+	}
+
+	unestimated := c.DryRunUnestimated()
+	if len(unestimated) != 1 || unestimated[0].To != common.HexToAddress("0x2") || unestimated[0].Method != "addDepositFor" {
+		t.Fatalf("expected the deposit to be reported without an estimate, got %+v", unestimated)
+	}
+}
@@ -0,0 +1,111 @@
+package tests
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/daobrussels/cw/pkg/ratelimit"
+)
+
+func TestRateLimit(t *testing.T) {
+	ctx := context.Background()
+
+	conf := ratelimit.Config{
+		Default: ratelimit.Policy{
+			IP: &ratelimit.Limit{Rate: 0.001, Burst: 3},
+		},
+		Routes: map[string]ratelimit.Policy{
+			ratelimit.RouteAccount: {
+				Address: &ratelimit.Limit{Rate: 0.001, Burst: 1},
+			},
+		},
+	}
+
+	t.Run("test limit by ip", func(t *testing.T) {
+		rl := ratelimit.New(ratelimit.NewMemoryStore(), conf)
+
+		req := ratelimit.Requester{IP: "10.0.0.1"}
+
+		for i := 0; i < 3; i++ {
+			ok, _, err := rl.Allow(ctx, "", req)
+			if err != nil || !ok {
+				t.Fatalf("expected request %d to be allowed, got %v %v", i, ok, err)
+			}
+		}
+
+		ok, retry, err := rl.Allow(ctx, "", req)
+		if err != nil || ok {
+			t.Fatalf("expected the request to be limited, got %v %v", ok, err)
+		}
+
+		if retry <= 0 {
+			t.Fatalf("expected a delay before the next request, got %v", retry)
+		}
+
+		// other ips have their own bucket
+		ok, _, _ = rl.Allow(ctx, "", ratelimit.Requester{IP: "10.0.0.2"})
+		if !ok {
+			t.Fatal("expected another ip to be allowed")
+		}
+	})
+
+	t.Run("test limit by route and address", func(t *testing.T) {
+		rl := ratelimit.New(ratelimit.NewMemoryStore(), conf)
+
+		req := ratelimit.Requester{IP: "10.0.0.1", Address: "0xAbC"}
+
+		ok, _, _ := rl.Allow(ctx, ratelimit.RouteAccount, req)
+		if !ok {
+			t.Fatal("expected the first account creation to be allowed")
+		}
+
+		// addresses are case insensitive
+		ok, _, _ = rl.Allow(ctx, ratelimit.RouteAccount, ratelimit.Requester{IP: "10.0.0.3", Address: "0xabc"})
+		if ok {
+			t.Fatal("expected the second account creation of the address to be limited")
+		}
+
+		// routes without a policy are not limited
+		for i := 0; i < 5; i++ {
+			ok, _, _ = rl.Allow(ctx, ratelimit.RouteOp, req)
+			if !ok {
+				t.Fatal("expected a route without a policy to be allowed")
+			}
+		}
+	})
+
+	t.Run("test denylist", func(t *testing.T) {
+		rl := ratelimit.New(ratelimit.NewMemoryStore(), conf)
+
+		path := filepath.Join(t.TempDir(), "denylist")
+
+		err := os.WriteFile(path, []byte("# abusers\n0xDEF\n\n10.0.0.9\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = rl.Denylist.Load(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, _, err = rl.Allow(ctx, "", ratelimit.Requester{IP: "10.0.0.9"})
+		if err != ratelimit.ErrDenied {
+			t.Fatalf("expected %v, got %v", ratelimit.ErrDenied, err)
+		}
+
+		_, _, err = rl.Allow(ctx, ratelimit.RouteAccount, ratelimit.Requester{IP: "10.0.0.1", Address: "0xdef"})
+		if err != ratelimit.ErrDenied {
+			t.Fatalf("expected %v, got %v", ratelimit.ErrDenied, err)
+		}
+
+		rl.Denylist.Remove("0xdef")
+
+		ok, _, err := rl.Allow(ctx, ratelimit.RouteAccount, ratelimit.Requester{IP: "10.0.0.1", Address: "0xdef"})
+		if err != nil || !ok {
+			t.Fatalf("expected a removed address to be allowed, got %v %v", ok, err)
+		}
+	})
+}
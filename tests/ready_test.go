@@ -0,0 +1,132 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/daobrussels/cw/pkg/common/ethrequest"
+	"github.com/daobrussels/cw/pkg/community"
+	"github.com/daobrussels/cw/pkg/cw"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// chainStub answers the calls of the readiness checks
+type chainStub struct {
+	chainID string
+	balance string
+	deposit string
+}
+
+func (s chainStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var msg struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+	}
+	json.NewDecoder(r.Body).Decode(&msg)
+
+	var result string
+
+	switch msg.Method {
+	case "eth_chainId":
+		result = s.chainID
+	case "eth_getCode":
+		result = "0x6080"
+	case "eth_getBalance":
+		result = s.balance
+	case "eth_call":
+		result = s.deposit
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":"%s"}`, msg.ID, result)
+}
+
+func TestReady(t *testing.T) {
+	ctx := context.Background()
+
+	funded := "0x" + common.Bytes2Hex(common.LeftPadBytes([]byte{1}, 32))
+	empty := "0x" + common.Bytes2Hex(make([]byte, 32))
+
+	cases := []struct {
+		name   string
+		stub   chainStub
+		ready  bool
+		failed string
+	}{
+		{"test ready", chainStub{"0x1", "0x10", funded}, true, ""},
+		{"test wrong chain", chainStub{"0x2", "0x10", funded}, false, community.CheckChainID},
+		{"test empty supply wallet", chainStub{"0x1", "0x0", funded}, false, community.CheckSupply},
+		{"test empty paymaster", chainStub{"0x1", "0x10", empty}, false, community.CheckPaymaster},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(tc.stub)
+			defer srv.Close()
+
+			es, err := ethrequest.NewEthService(srv.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer es.Close()
+
+			key, err := crypto.GenerateKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			c, err := community.New(es, key, crypto.PubkeyToAddress(key.PublicKey), community.CommunityAddress{
+				Gateway:          common.HexToAddress("0x1"),
+				Paymaster:        common.HexToAddress("0x2"),
+				AccountFactory:   common.HexToAddress("0x3"),
+				GratitudeFactory: common.HexToAddress("0x4"),
+				ProfileFactory:   common.HexToAddress("0x5"),
+				Chain:            cw.ChainConfig{ChainID: 1},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := c.Ready(ctx, community.ReadyThresholds{})
+			if r.Ready != tc.ready {
+				t.Fatalf("expected ready %v, got %+v", tc.ready, r)
+			}
+
+			for _, check := range r.Checks {
+				if check.OK == (check.Name == tc.failed) {
+					t.Fatalf("expected only %q to fail, got %+v", tc.failed, r.Checks)
+				}
+			}
+		})
+	}
+
+	t.Run("test unreachable rpc", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+		}))
+		defer srv.Close()
+
+		es, err := ethrequest.NewEthService(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer es.Close()
+
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c := community.Prepare(es, key, crypto.PubkeyToAddress(key.PublicKey), cw.ChainConfig{ChainID: 1})
+
+		r := c.Ready(ctx, community.ReadyThresholds{})
+		if r.Ready || len(r.Checks) != 1 || r.Checks[0].Name != community.CheckRPC {
+			t.Fatalf("expected only the rpc check to fail, got %+v", r)
+		}
+	})
+}
@@ -0,0 +1,124 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/daobrussels/cw/pkg/community"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestRecovery(t *testing.T) {
+	account := common.HexToAddress(nobalancehexaddr)
+	guardians := []common.Address{
+		common.HexToAddress(reqaddress),
+		common.HexToAddress(txreceivingAddress),
+		common.HexToAddress("0x0b772F674eD6fB67C5647Be0fbBd2FBe95156D60"),
+	}
+
+	path := filepath.Join(t.TempDir(), "test.recovery.json")
+
+	t.Run("test guardian threshold defaults to a majority", func(t *testing.T) {
+		r, err := community.NewRecovery(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var set community.GuardianSet
+		for _, g := range guardians {
+			set, err = r.AddGuardian(account, g, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if len(set.Guardians) != 3 || set.Threshold != 2 || set.Explicit {
+			t.Fatalf("expected 3 guardians with a majority of 2, got %d and %d", len(set.Guardians), set.Threshold)
+		}
+
+		// the majority follows the guardians
+		set, err = r.RemoveGuardian(account, guardians[2])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(set.Guardians) != 2 || set.Threshold != 2 {
+			t.Fatalf("expected 2 guardians with a majority of 2, got %d and %d", len(set.Guardians), set.Threshold)
+		}
+
+		set, err = r.AddGuardian(account, guardians[2], 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if set.Threshold != 2 {
+			t.Fatalf("expected a majority of 2, got %d", set.Threshold)
+		}
+
+		set, err = r.AddGuardian(account, guardians[0], 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(set.Guardians) != 3 || set.Threshold != 3 || !set.Explicit {
+			t.Fatalf("expected 3 guardians with a threshold of 3, got %d and %d", len(set.Guardians), set.Threshold)
+		}
+
+		_, err = r.AddGuardian(account, guardians[0], 4)
+		if err != community.ErrInvalidThreshold {
+			t.Fatalf("expected an invalid threshold, got %v", err)
+		}
+
+		// a threshold chosen by the owner is kept
+		set, err = r.AddGuardian(account, guardians[1], 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if set.Threshold != 3 {
+			t.Fatalf("expected the threshold of 3 to be kept, got %d", set.Threshold)
+		}
+
+		set, err = r.AddGuardian(account, guardians[0], 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if set.Threshold != 2 {
+			t.Fatalf("expected a threshold of 2, got %d", set.Threshold)
+		}
+	})
+
+	t.Run("test guardians are persisted", func(t *testing.T) {
+		r, err := community.NewRecovery(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		set := r.Guardians(account)
+		if len(set.Guardians) != 3 || set.Threshold != 2 || !set.Explicit {
+			t.Fatalf("expected 3 guardians with a threshold of 2, got %+v", set)
+		}
+	})
+
+	t.Run("test the state is replaced without leaving temporary files", func(t *testing.T) {
+		entries, err := os.ReadDir(filepath.Dir(path))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(entries) != 1 || entries[0].Name() != filepath.Base(path) {
+			t.Fatalf("expected only %s, got %v", filepath.Base(path), entries)
+		}
+
+		info, err := entries[0].Info()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Mode().Perm() != 0600 {
+			t.Fatalf("expected the state to be private, got %v", info.Mode().Perm())
+		}
+	})
+}
@@ -0,0 +1,260 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/daobrussels/cw/pkg/community"
+	"github.com/daobrussels/cw/pkg/cw"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// waitFor polls a condition until it holds or a few seconds went by
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	srv := httptest.NewServer(chainStub{chainID: "0x1"})
+	defer srv.Close()
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr := community.CommunityAddress{
+		Gateway:          common.HexToAddress("0x1"),
+		Paymaster:        common.HexToAddress("0x2"),
+		AccountFactory:   common.HexToAddress("0x3"),
+		GratitudeFactory: common.HexToAddress("0x4"),
+		ProfileFactory:   common.HexToAddress("0x5"),
+		Chain:            cw.ChainConfig{ChainID: 1, RPC: []string{srv.URL}},
+	}
+
+	newRegistry := func(t *testing.T) *community.Registry {
+		r := community.NewRegistry(key, crypto.PubkeyToAddress(key.PublicKey))
+		t.Cleanup(r.Close)
+
+		return r
+	}
+
+	t.Run("test the default community is replaced when it is removed", func(t *testing.T) {
+		r := newRegistry(t)
+
+		for _, id := range []string{"b", "c", "a"} {
+			_, err := r.Add(id, addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		c, ok := r.Default()
+		if !ok || c != mustGet(t, r, "b") {
+			t.Fatal("expected the first community added to be the default one")
+		}
+
+		r.Remove("b")
+
+		c, ok = r.Default()
+		if !ok || c != mustGet(t, r, "a") {
+			t.Fatal("expected the first remaining community to be the default one")
+		}
+
+		r.Remove("a")
+		r.Remove("c")
+
+		_, ok = r.Default()
+		if ok {
+			t.Fatal("expected no default community")
+		}
+	})
+
+	t.Run("test a community needs an rpc endpoint", func(t *testing.T) {
+		r := newRegistry(t)
+
+		noRPC := addr
+		noRPC.Chain.RPC = nil
+
+		_, err := r.Add("a", noRPC)
+		if !errors.Is(err, community.ErrMissingRPC) {
+			t.Fatalf("expected %v, got %v", community.ErrMissingRPC, err)
+		}
+	})
+
+	t.Run("test only communities with a token are indexed", func(t *testing.T) {
+		r := newRegistry(t)
+
+		c, err := r.Add("a", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if c.Index != nil {
+			t.Fatal("expected a community without a token not to be indexed")
+		}
+
+		withToken := addr
+		withToken.Token = common.HexToAddress(reqaddress)
+
+		c, err = r.Add("b", withToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if c.Index == nil {
+			t.Fatal("expected a community with a token to be indexed")
+		}
+	})
+
+	t.Run("test draining waits for the transactions to be mined", func(t *testing.T) {
+		for _, pending := range []bool{false, true} {
+			stub := httptest.NewServer(opStub{status: types.ReceiptStatusSuccessful, pending: pending})
+			defer stub.Close()
+
+			r := newRegistry(t)
+
+			stubbed := addr
+			stubbed.Chain.RPC = []string{stub.URL}
+
+			c, err := r.Add("a", stubbed)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = c.SubmitUserOp(context.Background(), community.UserOp{Sender: common.HexToAddress(nobalancehexaddr)})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			left := r.Drain(ctx)
+			if pending && len(left) != 1 {
+				t.Fatalf("expected the unmined transaction to be left, got %v", left)
+			}
+
+			if !pending && len(left) != 0 {
+				t.Fatalf("expected the transaction to be mined, got %v", left)
+			}
+		}
+	})
+
+	t.Run("test reloads keep the state of a community", func(t *testing.T) {
+		r := newRegistry(t)
+		r.DataDir = t.TempDir()
+
+		c, err := r.Add("a", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = c.Controls.PauseSponsorship(true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		reloaded, err := r.Add("a", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if reloaded == c {
+			t.Fatal("expected a new version of the community")
+		}
+
+		if reloaded.Controls != c.Controls || reloaded.Recovery != c.Recovery || reloaded.Sessions != c.Sessions {
+			t.Fatal("expected the stores to be reused")
+		}
+
+		if reloaded.Controls.Sponsoring() {
+			t.Fatal("expected sponsorship to stay paused")
+		}
+	})
+
+	t.Run("test the watcher follows the config files", func(t *testing.T) {
+		r := newRegistry(t)
+		dir := t.TempDir()
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		done := make(chan error)
+		go func() {
+			done <- r.Watch(ctx, dir)
+		}()
+
+		defer func() {
+			cancel()
+
+			err := <-done
+			if err != nil {
+				t.Fatal(err)
+			}
+		}()
+
+		// let the watcher start before writing
+		time.Sleep(50 * time.Millisecond)
+
+		b, err := json.Marshal(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		path := filepath.Join(dir, "a"+community.ConfigSuffix)
+
+		err = os.WriteFile(path, b, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		waitFor(t, func() bool {
+			_, ok := r.Get("a")
+			return ok
+		})
+
+		// files which are not community configs are ignored
+		err = os.WriteFile(filepath.Join(dir, "b.json"), b, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = os.Remove(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		waitFor(t, func() bool {
+			return len(r.IDs()) == 0
+		})
+	})
+}
+
+// mustGet returns a community of the registry or fails the test
+func mustGet(t *testing.T, r *community.Registry, id string) *community.Community {
+	t.Helper()
+
+	c, ok := r.Get(id)
+	if !ok {
+		t.Fatalf("community %s not found", id)
+	}
+
+	return c
+}
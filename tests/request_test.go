@@ -2,9 +2,12 @@ package tests
 
 import (
 	"encoding/json"
+	"net/http"
 	"testing"
+	"time"
 
 	"github.com/daobrussels/cw/pkg/common/request"
+	"github.com/daobrussels/cw/pkg/common/supply"
 )
 
 const (
@@ -64,4 +67,43 @@ func TestRequest(t *testing.T) {
 			t.Fatal("signature verification failed")
 		}
 	})
+	t.Run("test query signature", func(t *testing.T) {
+		key, err := supply.New(reqprivhexkey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req := request.NewQuery(key.Address, http.MethodGet, "/community/accounts/0x01/balances")
+
+		sig, err := req.GenerateSignature(reqprivhexkey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the station rebuilds the request from the headers
+		parsed, err := request.ParseQuery(key.Address, req.FormatExpiry(), http.MethodGet, "/community/accounts/0x01/balances")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !parsed.VerifySignature(sig) {
+			t.Fatal("signature verification failed")
+		}
+
+		// the signature does not cover other paths
+		other, err := request.ParseQuery(key.Address, req.FormatExpiry(), http.MethodGet, "/community/accounts/0x02/balances")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if other.VerifySignature(sig) {
+			t.Fatal("expected the signature of another path to be rejected")
+		}
+
+		// signatures cannot be valid for long
+		_, err = request.ParseQuery(key.Address, time.Now().Add(time.Hour).Format(time.RFC3339Nano), http.MethodGet, "/")
+		if err != request.ErrInvalidExpiry {
+			t.Fatalf("expected %v, got %v", request.ErrInvalidExpiry, err)
+		}
+	})
 }
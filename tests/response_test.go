@@ -0,0 +1,161 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/daobrussels/cw/pkg/common/response"
+	"github.com/daobrussels/cw/pkg/common/supply"
+	"github.com/daobrussels/cw/pkg/cw"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+func TestResponse(t *testing.T) {
+	s, err := supply.New(reqprivhexkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	responder := response.NewResponder(s)
+
+	// the client uses the same key pair as the station
+	ctx := context.WithValue(context.Background(), cw.ContextKeyPubKey, reqpubhexkey)
+
+	items := []TestData{{Hello: "world"}, {Hello: "again"}}
+	page := &response.Page{Cursor: "0x01", Limit: 2, Total: 5}
+
+	t.Run("test plain list response", func(t *testing.T) {
+		w := httptest.NewRecorder()
+
+		err := responder.BodyMultiple(w, items, page)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var decoded []TestData
+
+		p, err := response.DecodeMultiple(w.Body.Bytes(), "", "", &decoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(decoded) != 2 || decoded[1].Hello != "again" || *p != *page {
+			t.Fatalf("expected the list and page to round trip, got %v and %v", decoded, p)
+		}
+	})
+
+	t.Run("test secure list response", func(t *testing.T) {
+		w := httptest.NewRecorder()
+
+		err := responder.EncryptedBodyMultiple(w, ctx, items, page)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var decoded []TestData
+
+		_, err = response.DecodeMultiple(w.Body.Bytes(), "", reqprivhexkey, &decoded)
+		if err != response.ErrInvalidSignature {
+			t.Fatalf("expected the response to require the signature header, got %v", err)
+		}
+
+		p, err := response.DecodeMultiple(w.Body.Bytes(), w.Header().Get(cw.SignatureHeader), reqprivhexkey, &decoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(decoded) != 2 || decoded[0].Hello != "world" || *p != *page {
+			t.Fatalf("expected the list and page to round trip, got %v and %v", decoded, p)
+		}
+	})
+
+	t.Run("test secure object response", func(t *testing.T) {
+		w := httptest.NewRecorder()
+
+		err := responder.EncryptedBody(w, ctx, items[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var decoded TestData
+
+		err = response.Decode(w.Body.Bytes(), w.Header().Get(cw.SignatureHeader), reqprivhexkey, &decoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if decoded.Hello != "world" {
+			t.Fatalf("expected the object to round trip, got %v", decoded)
+		}
+	})
+
+	t.Run("test secure error response", func(t *testing.T) {
+		w := httptest.NewRecorder()
+
+		responder.Error(w, ctx, errors.New("nonce too low"))
+
+		if w.Code != http.StatusConflict {
+			t.Fatalf("expected status %d, got %d", http.StatusConflict, w.Code)
+		}
+
+		var decoded TestData
+
+		err := response.Decode(w.Body.Bytes(), w.Header().Get(cw.SignatureHeader), reqprivhexkey, &decoded)
+
+		var e *response.Error
+		if !errors.As(err, &e) {
+			t.Fatalf("expected an error response, got %v", err)
+		}
+
+		if e.Code != response.CodeNonceConflict || !e.Retryable {
+			t.Fatalf("expected a retryable nonce conflict, got %v", e)
+		}
+	})
+}
+
+func TestErrorClassification(t *testing.T) {
+	cases := []struct {
+		err       error
+		status    int
+		code      response.ErrorCode
+		retryable bool
+	}{
+		{errors.New("execution reverted: not allowed"), http.StatusUnprocessableEntity, response.CodeReverted, false},
+		{errors.New("nonce too low"), http.StatusConflict, response.CodeNonceConflict, true},
+		{errors.New("replacement transaction underpriced"), http.StatusConflict, response.CodeNonceConflict, true},
+		{context.DeadlineExceeded, http.StatusServiceUnavailable, response.CodeUnavailable, true},
+		{rpc.HTTPError{StatusCode: http.StatusTooManyRequests}, http.StatusTooManyRequests, response.CodeRateLimited, true},
+		{response.BadRequest(errors.New("invalid json")), http.StatusBadRequest, response.CodeBadRequest, false},
+		{errors.New("something unexpected"), http.StatusInternalServerError, response.CodeInternal, false},
+	}
+
+	for _, c := range cases {
+		e := response.FromError(c.err)
+
+		if e.Status != c.status || e.Code != c.code || e.Retryable != c.retryable {
+			t.Fatalf("expected %q to be %d %s retryable %v, got %d %s retryable %v", c.err, c.status, c.code, c.retryable, e.Status, e.Code, e.Retryable)
+		}
+	}
+
+	t.Run("test plain error response", func(t *testing.T) {
+		w := httptest.NewRecorder()
+
+		response.WriteError(w, response.ErrUnauthorized)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("expected status %d, got %d", http.StatusUnauthorized, w.Code)
+		}
+
+		var decoded TestData
+
+		err := response.Decode(w.Body.Bytes(), "", "", &decoded)
+
+		var e *response.Error
+		if !errors.As(err, &e) || e.Code != response.CodeUnauthorized {
+			t.Fatalf("expected an unauthorized error response, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,148 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/daobrussels/cw/pkg/admin"
+	"github.com/daobrussels/cw/pkg/auth"
+	"github.com/daobrussels/cw/pkg/common/response"
+	"github.com/daobrussels/cw/pkg/common/supply"
+	"github.com/daobrussels/cw/pkg/community"
+	"github.com/daobrussels/cw/pkg/cw"
+	"github.com/daobrussels/cw/pkg/ratelimit"
+	"github.com/daobrussels/cw/pkg/router"
+	"github.com/daobrussels/cw/pkg/server"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// startStation serves the routes of a station with a single community and returns its url
+func startStation(t *testing.T) string {
+	chain := httptest.NewServer(chainStub{chainID: "0x1"})
+	t.Cleanup(chain.Close)
+
+	station, err := supply.New(reqprivhexkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reg := community.NewRegistry(key, crypto.PubkeyToAddress(key.PublicKey))
+	t.Cleanup(reg.Close)
+
+	_, err = reg.Add("a", community.CommunityAddress{
+		Gateway:          common.HexToAddress("0x1"),
+		Paymaster:        common.HexToAddress("0x2"),
+		AccountFactory:   common.HexToAddress("0x3"),
+		GratitudeFactory: common.HexToAddress("0x4"),
+		ProfileFactory:   common.HexToAddress("0x5"),
+		Chain:            cw.ChainConfig{Name: "test", ChainID: 1, RPC: []string{chain.URL}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	audit, err := admin.OpenAuditLog(filepath.Join(t.TempDir(), "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { audit.Close() })
+
+	rl := ratelimit.New(ratelimit.NewMemoryStore(), ratelimit.DefaultConfig())
+
+	srv := router.NewServer(station, reg, server.DefaultConfig(), rl, auth.NewRoles(), audit)
+
+	// find a free port for the station
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	go srv.Start(port)
+	t.Cleanup(func() { srv.Shutdown(context.Background()) })
+
+	url := fmt.Sprintf("http://127.0.0.1:%d", port)
+
+	waitFor(t, func() bool {
+		resp, err := http.Get(url + "/hello")
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+
+		return true
+	})
+
+	return url
+}
+
+func TestRouter(t *testing.T) {
+	url := startStation(t)
+
+	station, err := supply.New(reqprivhexkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("test public routes are served without headers", func(t *testing.T) {
+		resp, err := http.Get(url + "/hello")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected %d, got %d", http.StatusOK, resp.StatusCode)
+		}
+
+		if resp.Header.Get(cw.PubKeyHeader) != station.PubHexKey {
+			t.Fatal("expected the public key of the station")
+		}
+
+		var body struct {
+			ResponseType string         `json:"response_type"`
+			Object       cw.ChainConfig `json:"object"`
+		}
+
+		err = json.NewDecoder(resp.Body).Decode(&body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if body.Object.Name != "test" {
+			t.Fatalf("expected the chain config in the clear, got %+v", body)
+		}
+	})
+
+	t.Run("test signed routes require headers", func(t *testing.T) {
+		resp, err := http.Get(url + "/community/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("expected %d, got %d", http.StatusUnauthorized, resp.StatusCode)
+		}
+
+		var body response.Response
+
+		err = json.NewDecoder(resp.Body).Decode(&body)
+		if err != nil || body.Error == nil {
+			t.Fatalf("expected an error response, got %+v", body)
+		}
+	})
+}
@@ -0,0 +1,345 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/daobrussels/cw/pkg/common/ethrequest"
+	"github.com/daobrussels/cw/pkg/community"
+	"github.com/daobrussels/cw/pkg/cw"
+	"github.com/daobrussels/smartcontracts/pkg/contracts/gateway"
+	"github.com/daobrussels/smartcontracts/pkg/contracts/gratitude"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// opStub answers the calls made to submit a user operation and mines every transaction with the provided logs
+type opStub struct {
+	hash    common.Hash // returned by every eth_call, the hash of the user operation
+	status  uint64
+	logs    []*types.Log
+	pending bool // transactions are never mined
+}
+
+func (s opStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var msg struct {
+		ID     json.RawMessage   `json:"id"`
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	json.NewDecoder(r.Body).Decode(&msg)
+
+	var result any
+
+	switch msg.Method {
+	case "eth_chainId":
+		result = "0x1"
+	case "eth_call":
+		result = hexutil.Bytes(s.hash.Bytes())
+	case "eth_getCode":
+		result = "0x6080"
+	case "eth_getTransactionCount":
+		result = "0x0"
+	case "eth_maxPriorityFeePerGas", "eth_gasPrice":
+		result = "0x1"
+	case "eth_estimateGas":
+		result = "0x10000"
+	case "eth_getBlockByNumber":
+		result = &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(0), BaseFee: big.NewInt(1)}
+	case "eth_sendRawTransaction":
+		var raw hexutil.Bytes
+		json.Unmarshal(msg.Params[0], &raw)
+
+		tx := new(types.Transaction)
+		tx.UnmarshalBinary(raw)
+		result = tx.Hash()
+	case "eth_getTransactionReceipt":
+		if s.pending {
+			break
+		}
+
+		var hash common.Hash
+		json.Unmarshal(msg.Params[0], &hash)
+
+		result = &types.Receipt{
+			Status:            s.status,
+			Logs:              append([]*types.Log{}, s.logs...),
+			TxHash:            hash,
+			BlockNumber:       big.NewInt(1),
+			EffectiveGasPrice: big.NewInt(1),
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": msg.ID, "result": result})
+}
+
+// stubCommunity returns a community whose chain is answered by the handler, the configuration can be adjusted by the callback
+func stubCommunity(t *testing.T, handler http.Handler, entryPoint common.Address, configure func(*community.CommunityAddress)) *community.Community {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	es, err := ethrequest.NewEthService(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(es.Close)
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr := community.CommunityAddress{
+		Gateway:          entryPoint,
+		Paymaster:        common.HexToAddress("0x2"),
+		AccountFactory:   common.HexToAddress("0x3"),
+		GratitudeFactory: common.HexToAddress("0x4"),
+		ProfileFactory:   common.HexToAddress("0x5"),
+		Chain:            cw.ChainConfig{ChainID: 1},
+	}
+
+	if configure != nil {
+		configure(&addr)
+	}
+
+	c, err := community.New(es, key, crypto.PubkeyToAddress(key.PublicKey), addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+// userOpEvent returns the log the entry point emits once it executed an operation
+func userOpEvent(t *testing.T, entryPoint common.Address, hash common.Hash, sender common.Address, success bool) *types.Log {
+	gabi, err := gateway.GatewayMetaData.GetAbi()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ev := gabi.Events["UserOperationEvent"]
+
+	data, err := ev.Inputs.NonIndexed().Pack(big.NewInt(0), success, big.NewInt(0), big.NewInt(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &types.Log{
+		Address: entryPoint,
+		Topics:  []common.Hash{ev.ID, hash, common.BytesToHash(sender.Bytes()), {}},
+		Data:    data,
+	}
+}
+
+func TestSessions(t *testing.T) {
+	account := common.HexToAddress(nobalancehexaddr)
+	key := common.HexToAddress(nobalancehexaddr2)
+	token := common.HexToAddress(reqaddress)
+	shop := common.HexToAddress(txreceivingAddress)
+
+	path := filepath.Join(t.TempDir(), "test.sessions.json")
+
+	t.Run("test session keys are validated", func(t *testing.T) {
+		s, err := community.NewSessions(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = s.Register(account, community.SessionKey{Key: key, Token: token, Expiry: time.Now().Add(time.Hour)})
+		if err != community.ErrInvalidSession {
+			t.Fatalf("expected a session without limit to be invalid, got %v", err)
+		}
+
+		err = s.Register(account, community.SessionKey{Key: key, Token: token, Limit: big.NewInt(100), Expiry: time.Now().Add(30 * 24 * time.Hour)})
+		if err != community.ErrInvalidSession {
+			t.Fatalf("expected a session longer than the maximum duration to be invalid, got %v", err)
+		}
+	})
+
+	t.Run("test session keys are scoped", func(t *testing.T) {
+		s, err := community.NewSessions(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = s.Register(account, community.SessionKey{
+			Key:        key,
+			Token:      token,
+			Limit:      big.NewInt(100),
+			Recipients: []common.Address{shop},
+			Expiry:     time.Now().Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = s.Spend(account, key, token, shop, big.NewInt(60))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = s.Spend(account, key, token, shop, big.NewInt(60))
+		if err != community.ErrOutOfScope {
+			t.Fatalf("expected the limit to be enforced, got %v", err)
+		}
+
+		err = s.Spend(account, key, token, account, big.NewInt(1))
+		if err != community.ErrOutOfScope {
+			t.Fatalf("expected the recipients to be enforced, got %v", err)
+		}
+
+		err = s.Spend(account, key, shop, shop, big.NewInt(1))
+		if err != community.ErrOutOfScope {
+			t.Fatalf("expected the token to be enforced, got %v", err)
+		}
+	})
+
+	t.Run("test spent amounts are persisted", func(t *testing.T) {
+		s, err := community.NewSessions(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		keys := s.List(account)
+		if len(keys) != 1 || keys[0].Spent.Cmp(big.NewInt(60)) != 0 {
+			t.Fatalf("expected 1 session key with 60 spent, got %v", keys)
+		}
+
+		err = s.Revoke(account, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = s.Spend(account, key, token, shop, big.NewInt(1))
+		if err != community.ErrSessionNotFound {
+			t.Fatalf("expected a revoked session key to be rejected, got %v", err)
+		}
+	})
+}
+
+func TestSessionOps(t *testing.T) {
+	ctx := context.Background()
+
+	entryPoint := common.HexToAddress("0x1")
+	account := common.HexToAddress(nobalancehexaddr)
+	token := common.HexToAddress(reqaddress)
+	shop := common.HexToAddress(txreceivingAddress)
+	hash := crypto.Keccak256Hash([]byte("session operation"))
+
+	sessionKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	erc20, err := gratitude.GratitudeMetaData.GetAbi()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transfer, err := erc20.Pack("transfer", shop, big.NewInt(60))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calldata, err := community.ExecuteCallData(token, big.NewInt(0), transfer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sig, err := crypto.Sign(accounts.TextHash(hash.Bytes()), sessionKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	op := community.UserOp{Sender: account, CallData: calldata, Signature: sig}
+
+	setup := func(t *testing.T, stub opStub, sessionKeys bool) *community.Community {
+		c := stubCommunity(t, stub, entryPoint, func(addr *community.CommunityAddress) {
+			addr.SessionKeys = sessionKeys
+		})
+
+		err = c.Sessions.Register(account, community.SessionKey{
+			Key:    crypto.PubkeyToAddress(sessionKey.PublicKey),
+			Token:  token,
+			Limit:  big.NewInt(100),
+			Expiry: time.Now().Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return c
+	}
+
+	spent := func(c *community.Community) int64 {
+		return c.Sessions.List(account)[0].Spent.Int64()
+	}
+
+	t.Run("test session keys require accounts which support them", func(t *testing.T) {
+		c := setup(t, opStub{hash: hash, status: types.ReceiptStatusSuccessful}, false)
+
+		err := c.SubmitSessionOp(ctx, op)
+		if err != community.ErrSessionKeysUnsupported {
+			t.Fatalf("expected session keys to be unsupported, got %v", err)
+		}
+	})
+
+	t.Run("test successful operations keep their spend", func(t *testing.T) {
+		c := setup(t, opStub{
+			hash:   hash,
+			status: types.ReceiptStatusSuccessful,
+			logs:   []*types.Log{userOpEvent(t, entryPoint, hash, account, true)},
+		}, true)
+
+		err := c.SubmitSessionOp(ctx, op)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		time.Sleep(2 * time.Second)
+
+		if spent(c) != 60 {
+			t.Fatalf("expected 60 spent, got %d", spent(c))
+		}
+	})
+
+	t.Run("test failed operations are refunded", func(t *testing.T) {
+		c := setup(t, opStub{
+			hash:   hash,
+			status: types.ReceiptStatusSuccessful,
+			logs:   []*types.Log{userOpEvent(t, entryPoint, hash, account, false)},
+		}, true)
+
+		err := c.SubmitSessionOp(ctx, op)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if spent(c) != 60 {
+			t.Fatalf("expected 60 spent until the operation is mined, got %d", spent(c))
+		}
+
+		waitFor(t, func() bool { return spent(c) == 0 })
+	})
+
+	t.Run("test reverted transactions are refunded", func(t *testing.T) {
+		c := setup(t, opStub{hash: hash, status: types.ReceiptStatusFailed}, true)
+
+		err := c.SubmitSessionOp(ctx, op)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		waitFor(t, func() bool { return spent(c) == 0 })
+	})
+}
@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"context"
 	"testing"
 
 	"github.com/daobrussels/cw/pkg/common/ethrequest"
@@ -36,7 +37,7 @@ func TestTransaction(t *testing.T) {
 
 		s := transaction.New(chain, supply, ethservice)
 
-		err = s.Send(txreceivingAddress, 1000000000000000000)
+		err = s.Send(context.Background(), txreceivingAddress, 1000000000000000000)
 		if err != nil {
 			t.Fatal(err)
 		}